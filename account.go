@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Purposes stored in Auth_Tokens.purpose.
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposePasswordReset = "password_reset"
+)
+
+const (
+	verifyEmailTokenTTL   = 48 * time.Hour
+	passwordResetTokenTTL = time.Hour
+)
+
+// errInvalidAuthToken is returned when a token is unknown, expired or used.
+var errInvalidAuthToken = errors.New("invalid or expired token")
+
+// hashAuthToken returns the hex SHA-256 of a raw token. Only the hash is
+// stored, so a leaked Auth_Tokens table cannot be used to take over accounts.
+func hashAuthToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAuthToken issues a new single-use token for the user, replacing any
+// unused token with the same purpose.
+func createAuthToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := hex.EncodeToString(buf)
+
+	if _, err := db.Exec("DELETE FROM Auth_Tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose); err != nil {
+		return "", err
+	}
+	_, err := db.Exec("INSERT INTO Auth_Tokens (user_id, purpose, token_hash, expires_at) VALUES (?, ?, ?, ?)",
+		userID, purpose, hashAuthToken(raw), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// consumeAuthToken marks a valid token as used inside tx and returns the user
+// it belongs to.
+func consumeAuthToken(tx *sql.Tx, raw, purpose string) (int, error) {
+	var tokenID, userID int
+	err := tx.QueryRow(`
+		SELECT token_id, user_id FROM Auth_Tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE`,
+		hashAuthToken(raw), purpose, time.Now(),
+	).Scan(&tokenID, &userID)
+	if err == sql.ErrNoRows {
+		return 0, errInvalidAuthToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE Auth_Tokens SET used_at = ? WHERE token_id = ?", time.Now(), tokenID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// appBaseURL is the frontend URL used to build links in emails.
+func appBaseURL() string {
+	if u := os.Getenv("APP_BASE_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:3001"
+}
+
+// sendVerificationEmail issues a verification token and mails it to the user.
+func sendVerificationEmail(userID int, email string) error {
+	token, err := createAuthToken(userID, tokenPurposeVerifyEmail, verifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(MailMessage{
+		To:      email,
+		Subject: "Verify your GatorNest Inn account",
+		Body: fmt.Sprintf("Welcome to GatorNest Inn!\n\nConfirm your email address by opening the link below within %d hours:\n\n%s/verify-email?token=%s\n",
+			int(verifyEmailTokenTTL.Hours()), appBaseURL(), token),
+	})
+}
+
+// sendPasswordResetEmail issues a reset token and mails it to the user.
+func sendPasswordResetEmail(userID int, email string) error {
+	token, err := createAuthToken(userID, tokenPurposePasswordReset, passwordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(MailMessage{
+		To:      email,
+		Subject: "Reset your GatorNest Inn password",
+		Body: fmt.Sprintf("We received a request to reset your password. Open the link below within %d minutes to choose a new one:\n\n%s/reset-password?token=%s\n\nIf you did not request this, you can ignore this email.\n",
+			int(passwordResetTokenTTL.Minutes()), appBaseURL(), token),
+	})
+}
+
+// verifyEmail handles POST /verify-email
+func verifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeAuthToken(tx, req.Token, tokenPurposeVerifyEmail)
+	if err == errInvalidAuthToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("UPDATE Users SET email_verified = TRUE WHERE user_id = ?", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// resendVerificationEmail handles POST /verify-email/resend
+func resendVerificationEmail(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !isValidEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+
+	// The response is the same whether or not the account exists so the
+	// endpoint cannot be used to discover registered emails.
+	var userID int
+	err := db.QueryRow("SELECT user_id FROM Users WHERE email = ? AND email_verified = FALSE", req.Email).Scan(&userID)
+	if err == nil {
+		if err := sendVerificationEmail(userID, req.Email); err != nil {
+			log.Println("Error sending verification email:", err)
+		}
+	} else if err != sql.ErrNoRows {
+		log.Println("Error looking up user for verification email:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists and is unverified, a verification email has been sent"})
+}
+
+// requestPasswordReset handles POST /password-reset/request
+func requestPasswordReset(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !isValidEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+
+	var userID int
+	err := db.QueryRow("SELECT user_id FROM Users WHERE email = ?", req.Email).Scan(&userID)
+	if err == nil {
+		if err := sendPasswordResetEmail(userID, req.Email); err != nil {
+			log.Println("Error sending password reset email:", err)
+		}
+	} else if err != sql.ErrNoRows {
+		log.Println("Error looking up user for password reset:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset email has been sent"})
+}
+
+// confirmPasswordReset handles POST /password-reset/confirm
+func confirmPasswordReset(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token and password are required"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeAuthToken(tx, req.Token, tokenPurposePasswordReset)
+	if err == errInvalidAuthToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password", "details": err.Error()})
+		return
+	}
+
+	var email string
+	if err := tx.QueryRow("SELECT email FROM Users WHERE user_id = ?", userID).Scan(&email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password", "details": err.Error()})
+		return
+	}
+	// Rolling back leaves the token unused so the user can retry.
+	if err := passwordRules.validate(req.Password, email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	// Following the emailed link also proves ownership of the address.
+	if _, err := tx.Exec("UPDATE Users SET password_hash = ?, email_verified = TRUE WHERE user_id = ?", hashedPassword, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password", "details": err.Error()})
+		return
+	}
+
+	// A successful reset lifts any lockout on the account.
+	if err := clearLoginFailures(lockoutScopeAccount, strings.ToLower(email)); err != nil {
+		log.Println("Error clearing failed logins:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
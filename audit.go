@@ -0,0 +1,30 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+)
+
+// Event types written to Audit_Log.
+const (
+	auditLoginLockout = "login_lockout"
+	auditGuestMerge   = "guest_merge"
+	auditDataExport   = "data_export"
+	auditDataErasure  = "data_erasure"
+
+	auditLoyaltyAdjustment = "loyalty_adjustment"
+	auditReservationWalk   = "reservation_walk"
+	auditNightAudit        = "night_audit"
+)
+
+// recordAudit appends an entry to Audit_Log. userID may be 0 when the event
+// is not tied to a known account. Failures are logged rather than returned so
+// auditing never blocks the request that triggered it.
+func recordAudit(eventType string, userID int, subject, ip, details string) {
+	uid := sql.NullInt64{Int64: int64(userID), Valid: userID > 0}
+	_, err := db.Exec("INSERT INTO Audit_Log (event_type, user_id, subject, ip_address, details) VALUES (?, ?, ?, ?, ?)",
+		eventType, uid, subject, ip, details)
+	if err != nil {
+		log.Printf("Error writing %s audit entry: %v", eventType, err)
+	}
+}
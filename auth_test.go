@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func setupTestAuth(t *testing.T) {
+	t.Helper()
+	jwtSecret = []byte("test-secret")
+	allowedJWTAlgs = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodHS256.Alg()}
+	jwtIssuer = "gatornest-inn"
+	jwtAudience = "gatornest-api"
+	jwtKeys = &keyRing{dir: t.TempDir(), alg: jwt.SigningMethodEdDSA.Alg(), rotation: 30 * 24 * time.Hour}
+	if err := jwtKeys.rotateIfDue(time.Now()); err != nil {
+		t.Fatalf("rotateIfDue: %v", err)
+	}
+}
+
+func TestParseTokenAcceptsIssuedToken(t *testing.T) {
+	setupTestAuth(t)
+
+	tokenString, err := issueToken(42, "guest@example.com", "guest", false)
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		t.Fatalf("parseToken: %v", err)
+	}
+	if claims.UserID != 42 || claims.Email != "guest@example.com" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestParseTokenRejectsInvalidTokens(t *testing.T) {
+	setupTestAuth(t)
+	now := time.Now()
+	valid := jwt.RegisteredClaims{
+		Issuer:    jwtIssuer,
+		Audience:  jwt.ClaimStrings{jwtAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		claims func(rc jwt.RegisteredClaims) Claims
+	}{
+		{"none algorithm", jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, func(rc jwt.RegisteredClaims) Claims {
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"HS512 not allowed", jwt.SigningMethodHS512, jwtSecret, func(rc jwt.RegisteredClaims) Claims {
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"wrong secret", jwt.SigningMethodHS256, []byte("other-secret"), func(rc jwt.RegisteredClaims) Claims {
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"wrong issuer", jwt.SigningMethodHS256, jwtSecret, func(rc jwt.RegisteredClaims) Claims {
+			rc.Issuer = "someone-else"
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"wrong audience", jwt.SigningMethodHS256, jwtSecret, func(rc jwt.RegisteredClaims) Claims {
+			rc.Audience = jwt.ClaimStrings{"pos"}
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"expired", jwt.SigningMethodHS256, jwtSecret, func(rc jwt.RegisteredClaims) Claims {
+			rc.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Hour))
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"missing expiry", jwt.SigningMethodHS256, jwtSecret, func(rc jwt.RegisteredClaims) Claims {
+			rc.ExpiresAt = nil
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"not yet valid", jwt.SigningMethodHS256, jwtSecret, func(rc jwt.RegisteredClaims) Claims {
+			rc.NotBefore = jwt.NewNumericDate(now.Add(time.Hour))
+			return Claims{UserID: 1, RegisteredClaims: rc}
+		}},
+		{"missing user_id", jwt.SigningMethodHS256, jwtSecret, func(rc jwt.RegisteredClaims) Claims {
+			return Claims{RegisteredClaims: rc}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenString, err := jwt.NewWithClaims(test.method, test.claims(valid)).SignedString(test.key)
+			if err != nil {
+				t.Fatalf("Could not sign token: %v", err)
+			}
+			if _, err := parseToken(tokenString); err == nil {
+				t.Errorf("%s: expected token to be rejected", test.name)
+			}
+		})
+	}
+}
+
+func TestKeyRotationKeepsPreviousKeyForVerification(t *testing.T) {
+	setupTestAuth(t)
+
+	oldToken, err := issueToken(7, "staff@example.com", "manager", true)
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+	oldKey := jwtKeys.active()
+
+	// Rotation first publishes the next key while the old one keeps signing.
+	jwtKeys.alg = jwt.SigningMethodRS256.Alg()
+	if err := jwtKeys.rotateIfDue(time.Now().Add(jwtKeys.rotation)); err != nil {
+		t.Fatalf("rotateIfDue: %v", err)
+	}
+	if jwtKeys.active().kid != oldKey.kid {
+		t.Fatalf("expected key %s to keep signing until the next key has been published", oldKey.kid)
+	}
+	if len(jwtKeys.keys) != 2 {
+		t.Fatalf("expected the next key to be published, got %d keys", len(jwtKeys.keys))
+	}
+
+	// Once published for keyPublishLead, the new key signs and the old one
+	// stays verifiable.
+	if err := jwtKeys.rotateIfDue(time.Now().Add(jwtKeys.rotation + keyPublishLead)); err != nil {
+		t.Fatalf("rotateIfDue: %v", err)
+	}
+	newKey := jwtKeys.active()
+	if newKey.kid == oldKey.kid || newKey.method != jwt.SigningMethodRS256 {
+		t.Fatalf("expected a new RS256 key, got %s (%s)", newKey.kid, newKey.method.Alg())
+	}
+	if _, err := parseToken(oldToken); err != nil {
+		t.Errorf("token signed with previous key rejected: %v", err)
+	}
+
+	newToken, err := issueToken(7, "staff@example.com", "manager", true)
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+	if _, err := parseToken(newToken); err != nil {
+		t.Errorf("token signed with new key rejected: %v", err)
+	}
+
+	// Once the new key has been active longer than a token lives, the old
+	// key is retired.
+	if err := jwtKeys.rotateIfDue(time.Now().Add(jwtKeys.rotation + keyPublishLead + tokenTTL + time.Hour)); err != nil {
+		t.Fatalf("rotateIfDue: %v", err)
+	}
+	if jwtKeys.lookup(oldKey.kid) != nil {
+		t.Errorf("expected key %s to be retired", oldKey.kid)
+	}
+}
+
+func TestJWKSListsPublicKeys(t *testing.T) {
+	setupTestAuth(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", getJWKS)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200 but got %d", recorder.Code)
+	}
+
+	var body struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Could not decode JWKS: %v", err)
+	}
+	if len(body.Keys) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(body.Keys))
+	}
+	key := body.Keys[0]
+	if key["kid"] != jwtKeys.active().kid || key["kty"] != "OKP" || key["x"] == "" {
+		t.Errorf("unexpected JWK: %v", key)
+	}
+	if _, ok := key["d"]; ok {
+		t.Errorf("JWKS must not contain private key material")
+	}
+}
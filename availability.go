@@ -0,0 +1,280 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// occupyingStatuses are the Reservations.status values that hold a room for
+// their dates. Cancelled and checked-out stays free the room.
+const occupyingStatuses = "'Pending', 'Confirmed', 'Checked-in'"
+
+// errRoomNotFound is returned by lockRooms when a room does not exist.
+var errRoomNotFound = errors.New("room not found")
+
+// conflictReserved is the roomConflict reason for a room taken by another
+// reservation, the only conflict overbooking can override.
+const conflictReserved = "already reserved for some of these dates"
+
+// stayRange is a stay from CheckIn up to (not including) the night of
+// CheckOut.
+type stayRange struct {
+	CheckIn  time.Time
+	CheckOut time.Time
+}
+
+// parseStay validates check-in and check-out dates in dateLayout.
+func parseStay(checkIn, checkOut string) (stayRange, error) {
+	in, err := time.Parse(dateLayout, checkIn)
+	if err != nil {
+		return stayRange{}, fmt.Errorf("check_in_date must be a date in YYYY-MM-DD format")
+	}
+	out, err := time.Parse(dateLayout, checkOut)
+	if err != nil {
+		return stayRange{}, fmt.Errorf("check_out_date must be a date in YYYY-MM-DD format")
+	}
+	if !out.After(in) {
+		return stayRange{}, fmt.Errorf("check_out_date must be after check_in_date")
+	}
+	return stayRange{CheckIn: in, CheckOut: out}, nil
+}
+
+// Nights is the number of nights in the stay.
+func (s stayRange) Nights() int {
+	return int(s.CheckOut.Sub(s.CheckIn).Hours() / 24)
+}
+
+// overlaps reports whether two stays share a night.
+func (s stayRange) overlaps(o stayRange) bool {
+	return s.CheckIn.Before(o.CheckOut) && o.CheckIn.Before(s.CheckOut)
+}
+
+// lockRooms locks the Rooms rows in id order so concurrent bookings of the
+// same rooms are serialised until tx ends. Every booking path takes these
+// locks before checking availability.
+func lockRooms(tx *sql.Tx, roomIDs []int) error {
+	seen := map[int]bool{}
+	var args []interface{}
+	for _, id := range roomIDs {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+	rows, err := tx.Query("SELECT room_id FROM Rooms WHERE room_id IN ("+placeholders+") ORDER BY room_id FOR UPDATE", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n != len(args) {
+		return errRoomNotFound
+	}
+	return nil
+}
+
+// roomConflict explains why a room cannot be booked for a stay, or returns ""
+// if it is free. Call it after lockRooms for a result that holds until commit.
+// Unexpired holds count, so a booking against its own hold must consume it
+// first. A room out of service, blocks and holds are reported ahead of
+// conflictReserved.
+func roomConflict(q queryExecer, roomID int, stay stayRange) (string, error) {
+	in, out := stay.CheckIn.Format(dateLayout), stay.CheckOut.Format(dateLayout)
+
+	var outOfService, reserved, held, blocked bool
+	err := q.QueryRow("SELECT COALESCE(status = 'Maintenance', FALSE) FROM Rooms WHERE room_id = ?", roomID).Scan(&outOfService)
+	if err == sql.ErrNoRows {
+		return "", errRoomNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if outOfService {
+		return "out of service for maintenance", nil
+	}
+	err = q.QueryRow(`SELECT EXISTS (SELECT 1 FROM Room_Availability WHERE room_id = ? AND status <> 'Available'
+		AND date >= ? AND date < ?)`, roomID, in, out).Scan(&blocked)
+	if err != nil {
+		return "", err
+	}
+	if blocked {
+		return "blocked for maintenance or by the hotel on some of these dates", nil
+	}
+	err = q.QueryRow(`SELECT EXISTS (SELECT 1 FROM Room_Holds WHERE room_id = ? AND expires_at > ?
+		AND check_in_date < ? AND check_out_date > ?)`, roomID, time.Now(), out, in).Scan(&held)
+	if err != nil {
+		return "", err
+	}
+	if held {
+		return "on hold for another guest for some of these dates", nil
+	}
+	err = q.QueryRow(`SELECT EXISTS (SELECT 1 FROM Reservations WHERE room_id = ? AND status IN (`+occupyingStatuses+`)
+		AND check_in_date < ? AND check_out_date > ?)`, roomID, out, in).Scan(&reserved)
+	if err != nil {
+		return "", err
+	}
+	if reserved {
+		return conflictReserved, nil
+	}
+	return "", nil
+}
+
+// roomRate returns the room's nightly price.
+func roomRate(q queryExecer, roomID int) (float64, error) {
+	var rate float64
+	err := q.QueryRow("SELECT price_per_night FROM Rooms WHERE room_id = ?", roomID).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, errRoomNotFound
+	}
+	return rate, err
+}
+
+// bookingTerms returns the status and total price a reservation is created
+// with. Guests always book Pending at the room's rate for the stay; staff may
+// record another status or an agreed price, defaulting to the same.
+func bookingTerms(staff bool, status string, total, rate float64, stay stayRange) (string, float64) {
+	if !staff || status == "" {
+		status = "Pending"
+	}
+	if !staff || total == 0 {
+		total = rate * float64(stay.Nights())
+	}
+	return status, total
+}
+
+// roomTypes are the values of Rooms.room_type.
+var roomTypes = map[string]bool{"Single": true, "Double": true, "Suite": true, "Deluxe": true}
+
+// Room is a row of Rooms.
+type Room struct {
+	RoomID        int     `json:"room_id"`
+	RoomNumber    string  `json:"room_number"`
+	RoomType      string  `json:"room_type"`
+	PricePerNight float64 `json:"price_per_night"`
+	Status        string  `json:"status"`
+	// Overbook is set in search results when the room is already reserved
+	// but can still be booked under the type's overbooking allowance.
+	Overbook bool `json:"overbook,omitempty"`
+}
+
+// roomUnblocked and roomUnreserved are conditions on Rooms r matching the
+// checks in roomConflict, taking the arguments from their *Args functions.
+const (
+	roomUnblocked = `r.status <> 'Maintenance'
+		AND NOT EXISTS (SELECT 1 FROM Room_Availability a WHERE a.room_id = r.room_id
+		    AND a.status <> 'Available' AND a.date >= ? AND a.date < ?)
+		AND NOT EXISTS (SELECT 1 FROM Room_Holds h WHERE h.room_id = r.room_id
+		    AND h.expires_at > ? AND h.check_in_date < ? AND h.check_out_date > ?)`
+	roomUnreserved = `NOT EXISTS (SELECT 1 FROM Reservations res WHERE res.room_id = r.room_id
+		AND res.status IN (` + occupyingStatuses + `) AND res.check_in_date < ? AND res.check_out_date > ?)`
+)
+
+func roomUnblockedArgs(stay stayRange) []interface{} {
+	in, out := stay.CheckIn.Format(dateLayout), stay.CheckOut.Format(dateLayout)
+	return []interface{}{in, out, time.Now(), out, in}
+}
+
+func roomUnreservedArgs(stay stayRange) []interface{} {
+	return []interface{}{stay.CheckOut.Format(dateLayout), stay.CheckIn.Format(dateLayout)}
+}
+
+// freeRoomCount returns how many rooms of a type roomConflict would accept
+// for the stay.
+func freeRoomCount(q queryExecer, roomType string, stay stayRange) (int, error) {
+	args := append([]interface{}{roomType}, roomUnblockedArgs(stay)...)
+	var n int
+	err := q.QueryRow("SELECT COUNT(*) FROM Rooms r WHERE r.room_type = ? AND "+roomUnblocked+" AND "+roomUnreserved,
+		append(args, roomUnreservedArgs(stay)...)...).Scan(&n)
+	return n, err
+}
+
+// availableRooms returns the rooms of a type that roomConflict would accept
+// for the stay, cheapest first. Once the type is sold out it returns the
+// rooms that can still be overbooked, if the allowance has room left.
+func availableRooms(roomType string, stay stayRange) ([]Room, error) {
+	args := append([]interface{}{roomType}, roomUnblockedArgs(stay)...)
+	rooms, err := queryRooms("WHERE r.room_type = ? AND "+roomUnblocked+" AND "+roomUnreserved,
+		append(args, roomUnreservedArgs(stay)...)...)
+	if err != nil || len(rooms) > 0 {
+		return rooms, err
+	}
+
+	remaining, err := overbookingCapacity(db, roomType, stay)
+	if err != nil || remaining <= 0 {
+		return rooms, err
+	}
+	rooms, err = queryRooms("WHERE r.room_type = ? AND "+roomUnblocked, args...)
+	for i := range rooms {
+		rooms[i].Overbook = true
+	}
+	return rooms, err
+}
+
+// queryRooms returns the rooms matching where, cheapest first.
+func queryRooms(where string, args ...interface{}) ([]Room, error) {
+	rows, err := db.Query(`SELECT r.room_id, r.room_number, r.room_type, r.price_per_night, r.status
+		FROM Rooms r `+where+" ORDER BY r.price_per_night, r.room_number", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []Room{}
+	for rows.Next() {
+		var r Room
+		if err := rows.Scan(&r.RoomID, &r.RoomNumber, &r.RoomType, &r.PricePerNight, &r.Status); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, r)
+	}
+	return rooms, rows.Err()
+}
+
+// getAvailableRoomsByType handles GET /rooms/:room_type
+// ?check_in_date= and ?check_out_date= limit the result to rooms free for
+// that stay; without them every room of the type not under maintenance is
+// listed. Rooms flagged overbook are only bookable under the overbooking
+// allowance; when nothing is returned the guest can join the waitlist.
+func getAvailableRoomsByType(c *gin.Context) {
+	roomType := c.Param("room_type")
+	if !roomTypes[roomType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "room_type must be Single, Double, Suite or Deluxe"})
+		return
+	}
+
+	in, out := c.Query("check_in_date"), c.Query("check_out_date")
+	if in == "" && out == "" {
+		rooms, err := queryRooms("WHERE r.room_type = ? AND r.status <> 'Maintenance'", roomType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching rooms", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rooms)
+		return
+	}
+
+	stay, err := parseStay(in, out)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rooms, err := availableRooms(roomType, stay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rooms)
+}
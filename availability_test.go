@@ -0,0 +1,94 @@
+package main
+
+import "testing"
+
+func TestParseStay(t *testing.T) {
+	tests := []struct {
+		in, out string
+		nights  int // 0 means an error is expected
+	}{
+		{"2025-03-01", "2025-03-04", 3},
+		{"2025-02-28", "2025-03-01", 1},
+		{"2025-03-01", "2025-03-01", 0},
+		{"2025-03-04", "2025-03-01", 0},
+		{"03/01/2025", "2025-03-04", 0},
+		{"2025-03-01", "", 0},
+	}
+
+	for _, test := range tests {
+		stay, err := parseStay(test.in, test.out)
+		if test.nights == 0 {
+			if err == nil {
+				t.Errorf("%s..%s: expected an error", test.in, test.out)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s..%s: unexpected error %v", test.in, test.out, err)
+			continue
+		}
+		if got := stay.Nights(); got != test.nights {
+			t.Errorf("%s..%s: expected %d nights, got %d", test.in, test.out, test.nights, got)
+		}
+	}
+}
+
+func TestStayOverlaps(t *testing.T) {
+	mustStay := func(in, out string) stayRange {
+		s, err := parseStay(in, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	base := mustStay("2025-03-10", "2025-03-13")
+
+	tests := []struct {
+		in, out string
+		want    bool
+	}{
+		{"2025-03-08", "2025-03-10", false}, // checks out the day base checks in
+		{"2025-03-13", "2025-03-15", false}, // checks in the day base checks out
+		{"2025-03-12", "2025-03-14", true},
+		{"2025-03-09", "2025-03-11", true},
+		{"2025-03-11", "2025-03-12", true},
+		{"2025-03-01", "2025-03-31", true},
+	}
+
+	for _, test := range tests {
+		other := mustStay(test.in, test.out)
+		if got := base.overlaps(other); got != test.want {
+			t.Errorf("%s..%s: expected overlap %v, got %v", test.in, test.out, test.want, got)
+		}
+		if got := other.overlaps(base); got != test.want {
+			t.Errorf("%s..%s: overlap is not symmetric", test.in, test.out)
+		}
+	}
+}
+
+func TestBookingTerms(t *testing.T) {
+	stay, err := parseStay("2025-03-01", "2025-03-04")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		staff      bool
+		status     string
+		total      float64
+		wantStatus string
+		wantTotal  float64
+	}{
+		// A guest cannot book a stay as already completed, or name a price.
+		{"guest claims checked out", false, "Checked-out", 1, "Pending", 360},
+		{"guest defaults", false, "", 0, "Pending", 360},
+		{"staff records a status and agreed price", true, "Confirmed", 300, "Confirmed", 300},
+		{"staff defaults", true, "", 0, "Pending", 360},
+	}
+	for _, test := range tests {
+		status, total := bookingTerms(test.staff, test.status, test.total, 120, stay)
+		if status != test.wantStatus || total != test.wantTotal {
+			t.Errorf("%s: expected %s at %.2f, got %s at %.2f", test.name, test.wantStatus, test.wantTotal, status, total)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Penalties a cancellation policy can charge, as a share of the stay.
+const (
+	penaltyNone       = "none"
+	penaltyFirstNight = "first_night"
+	penaltyFullStay   = "full_stay"
+)
+
+var penalties = map[string]bool{penaltyNone: true, penaltyFirstNight: true, penaltyFullStay: true}
+
+// chargeCancellation is the Reservation_Charges.charge_type of a
+// cancellation fee.
+const chargeCancellation = "cancellation"
+
+// errNotCancellable is returned by applyCancellation for a reservation that
+// has already started or ended.
+var errNotCancellable = errors.New("only pending or confirmed reservations can be cancelled")
+
+// CancellationPolicy is a row of Cancellation_Policies. Cancelling at least
+// FreeUntilDays before check-in is free (never, when nil); later
+// cancellations are charged CancelPenalty and no-shows NoShowPenalty.
+type CancellationPolicy struct {
+	PolicyID      int    `json:"policy_id"`
+	Name          string `json:"name"`
+	FreeUntilDays *int   `json:"free_until_days"`
+	CancelPenalty string `json:"cancel_penalty"`
+	NoShowPenalty string `json:"no_show_penalty"`
+	Description   string `json:"description,omitempty"`
+	Active        bool   `json:"active"`
+}
+
+// validate checks the policy's fields.
+func (p CancellationPolicy) validate() (string, bool) {
+	if p.Name == "" {
+		return "name is required", false
+	}
+	if p.FreeUntilDays != nil && *p.FreeUntilDays < 0 {
+		return "free_until_days cannot be negative", false
+	}
+	if !penalties[p.CancelPenalty] || !penalties[p.NoShowPenalty] {
+		return "cancel_penalty and no_show_penalty must be none, first_night or full_stay", false
+	}
+	return "", true
+}
+
+// penaltyAmount is what penalty charges for a stay costing total.
+func penaltyAmount(penalty string, total float64, stay stayRange) float64 {
+	switch penalty {
+	case penaltyFirstNight:
+		return math.Round(total/float64(stay.Nights())*100) / 100
+	case penaltyFullStay:
+		return total
+	}
+	return 0
+}
+
+// cancellationFee is the fee for cancelling a stay costing total at now under
+// policy. A stay booked without a policy can always be cancelled for free.
+func cancellationFee(policy *CancellationPolicy, total float64, stay stayRange, now time.Time) float64 {
+	if policy == nil {
+		return 0
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	daysBefore := int(stay.CheckIn.Sub(today).Hours() / 24)
+	if policy.FreeUntilDays != nil && daysBefore >= *policy.FreeUntilDays {
+		return 0
+	}
+	return penaltyAmount(policy.CancelPenalty, total, stay)
+}
+
+// snapshotCancellationPolicy copies the room's current policy onto a new
+// reservation, so later edits to the policy do not change the booking.
+func snapshotCancellationPolicy(q queryExecer, reservationID, roomID int) error {
+	_, err := q.Exec(`
+		INSERT INTO Reservation_Policies (reservation_id, policy_id, name, free_until_days, cancel_penalty, no_show_penalty)
+		SELECT ?, p.policy_id, p.name, p.free_until_days, p.cancel_penalty, p.no_show_penalty
+		FROM Rooms r JOIN Cancellation_Policies p ON p.policy_id = r.cancellation_policy_id
+		WHERE r.room_id = ?`, reservationID, roomID)
+	return err
+}
+
+// reservationPolicy returns the policy captured when the reservation was
+// booked, or nil if it had none.
+func reservationPolicy(q queryExecer, reservationID int) (*CancellationPolicy, error) {
+	var p CancellationPolicy
+	var policyID sql.NullInt64
+	err := q.QueryRow(`SELECT policy_id, name, free_until_days, cancel_penalty, no_show_penalty
+		FROM Reservation_Policies WHERE reservation_id = ?`, reservationID).
+		Scan(&policyID, &p.Name, &p.FreeUntilDays, &p.CancelPenalty, &p.NoShowPenalty)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.PolicyID = int(policyID.Int64)
+	return &p, nil
+}
+
+// cancellation is the outcome of cancelling one reservation.
+type cancellation struct {
+	ReservationID int     `json:"reservation_id"`
+	Policy        string  `json:"policy,omitempty"`
+	Fee           float64 `json:"cancellation_fee"`
+	Waived        bool    `json:"fee_waived,omitempty"`
+	roomID        int
+	stay          stayRange
+}
+
+// quoteCancellation locks the reservation and works out its cancellation fee
+// at now without changing anything.
+func quoteCancellation(tx *sql.Tx, reservationID int, now time.Time) (cancellation, error) {
+	res := cancellation{ReservationID: reservationID}
+	var status string
+	var total float64
+	err := tx.QueryRow(`SELECT room_id, status, check_in_date, check_out_date, total_price
+		FROM Reservations WHERE reservation_id = ? FOR UPDATE`, reservationID).
+		Scan(&res.roomID, &status, &res.stay.CheckIn, &res.stay.CheckOut, &total)
+	if err != nil {
+		return res, err
+	}
+	if status != "Pending" && status != "Confirmed" {
+		return res, errNotCancellable
+	}
+	policy, err := reservationPolicy(tx, reservationID)
+	if err != nil {
+		return res, err
+	}
+	if policy != nil {
+		res.Policy = policy.Name
+	}
+	res.Fee = cancellationFee(policy, total, res.stay, now)
+	return res, nil
+}
+
+// applyCancellation cancels the reservation inside tx and posts its
+// cancellation fee as a charge unless waive is set.
+func applyCancellation(tx *sql.Tx, reservationID int, now time.Time, waive bool) (cancellation, error) {
+	res, err := quoteCancellation(tx, reservationID, now)
+	if err != nil {
+		return res, err
+	}
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'Cancelled', cancelled_at = ? WHERE reservation_id = ?", now, reservationID); err != nil {
+		return res, err
+	}
+	if res.Fee > 0 && waive {
+		res.Waived = true
+		res.Fee = 0
+	}
+	if res.Fee > 0 {
+		err = postCharge(tx, reservationID, chargeCancellation, res.Fee, "Cancellation under "+res.Policy+" policy")
+	}
+	return res, err
+}
+
+// getCancellationQuote handles GET /reservations/:id/cancellation-fee
+// Shows what cancelling now would cost, under the policy captured at booking.
+func getCancellationQuote(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	ok, err := reservationAccessible(c, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error quoting cancellation", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error quoting cancellation", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	quote, err := quoteCancellation(tx, id, time.Now())
+	if err == errNotCancellable {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending or confirmed reservations can be cancelled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error quoting cancellation", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
+// cancelReservation handles POST /reservations/:id/cancel
+// Only reservations that have not started can be cancelled. The fee from the
+// reservation's policy is posted as a charge; staff may waive it with
+// {"waive_fee": true}. The freed room is offered to the waitlist.
+func cancelReservation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	var req struct {
+		WaiveFee bool `json:"waive_fee"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+			return
+		}
+	}
+	if req.WaiveFee && !isStaff(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can waive cancellation fees"})
+		return
+	}
+
+	ok, err := reservationAccessible(c, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling reservation", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling reservation", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := applyCancellation(tx, id, time.Now(), req.WaiveFee)
+	if err == errNotCancellable {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending or confirmed reservations can be cancelled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling reservation", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling reservation", "details": err.Error()})
+		return
+	}
+
+	releaseToWaitlist(res.roomID, res.stay)
+	c.JSON(http.StatusOK, gin.H{"message": "Reservation cancelled", "cancellation": res})
+}
+
+// getCancellationPolicies handles GET /cancellation-policies
+func getCancellationPolicies(c *gin.Context) {
+	rows, err := db.Query(`SELECT policy_id, name, free_until_days, cancel_penalty, no_show_penalty, COALESCE(description, ''), active
+		FROM Cancellation_Policies ORDER BY name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cancellation policies", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	policies := []CancellationPolicy{}
+	for rows.Next() {
+		var p CancellationPolicy
+		if err := rows.Scan(&p.PolicyID, &p.Name, &p.FreeUntilDays, &p.CancelPenalty, &p.NoShowPenalty, &p.Description, &p.Active); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning cancellation policy", "details": err.Error()})
+			return
+		}
+		policies = append(policies, p)
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+// createCancellationPolicy handles POST /cancellation-policies
+func createCancellationPolicy(c *gin.Context) {
+	p := CancellationPolicy{Active: true}
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if msg, ok := p.validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	result, err := db.Exec(`INSERT INTO Cancellation_Policies (name, free_until_days, cancel_penalty, no_show_penalty, description, active)
+		VALUES (?, ?, ?, ?, ?, ?)`, p.Name, p.FreeUntilDays, p.CancelPenalty, p.NoShowPenalty, p.Description, p.Active)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A policy with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating cancellation policy", "details": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	p.PolicyID = int(id)
+	c.JSON(http.StatusCreated, p)
+}
+
+// updateCancellationPolicy handles PUT /cancellation-policies/:id
+// Existing reservations keep the terms captured when they were booked.
+func updateCancellationPolicy(c *gin.Context) {
+	var p CancellationPolicy
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if msg, ok := p.validate(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	p.PolicyID, _ = strconv.Atoi(c.Param("id"))
+
+	var exists int
+	err := db.QueryRow("SELECT 1 FROM Cancellation_Policies WHERE policy_id = ?", p.PolicyID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cancellation policy not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating cancellation policy", "details": err.Error()})
+		return
+	}
+	_, err = db.Exec(`UPDATE Cancellation_Policies SET name = ?, free_until_days = ?, cancel_penalty = ?, no_show_penalty = ?,
+		description = ?, active = ? WHERE policy_id = ?`,
+		p.Name, p.FreeUntilDays, p.CancelPenalty, p.NoShowPenalty, p.Description, p.Active, p.PolicyID)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A policy with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating cancellation policy", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// setRoomCancellationPolicy handles PUT /rooms/:id/cancellation-policy
+// {"policy_id": null} removes the policy, making the room freely cancellable.
+func setRoomCancellationPolicy(c *gin.Context) {
+	var req struct {
+		PolicyID *int `json:"policy_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if req.PolicyID != nil {
+		var active bool
+		err := db.QueryRow("SELECT active FROM Cancellation_Policies WHERE policy_id = ?", *req.PolicyID).Scan(&active)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "policy_id must be an active cancellation policy"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room", "details": err.Error()})
+			return
+		}
+	}
+
+	roomID, _ := strconv.Atoi(c.Param("id"))
+	if _, err := roomRate(db, roomID); err == errRoomNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if _, err := db.Exec("UPDATE Rooms SET cancellation_policy_id = ? WHERE room_id = ?", req.PolicyID, roomID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "policy_id": req.PolicyID})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCancellationFee(t *testing.T) {
+	days := func(n int) *int { return &n }
+	flexible := &CancellationPolicy{Name: "Flexible", FreeUntilDays: days(1), CancelPenalty: penaltyFirstNight}
+	moderate := &CancellationPolicy{Name: "Moderate", FreeUntilDays: days(7), CancelPenalty: penaltyFullStay}
+	nonRefundable := &CancellationPolicy{Name: "Non-refundable", CancelPenalty: penaltyFullStay}
+
+	stay, err := parseStay("2025-08-10", "2025-08-13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		name   string
+		policy *CancellationPolicy
+		now    time.Time
+		want   float64
+	}{
+		{"no policy", nil, at("2025-08-10 09:00"), 0},
+		{"flexible two days out", flexible, at("2025-08-08 23:59"), 0},
+		{"flexible day before", flexible, at("2025-08-09 23:00"), 0},
+		{"flexible on arrival day", flexible, at("2025-08-10 08:00"), 100},
+		{"moderate a week out", moderate, at("2025-08-03 12:00"), 0},
+		{"moderate six days out", moderate, at("2025-08-04 12:00"), 300},
+		{"non-refundable months out", nonRefundable, at("2025-05-01 12:00"), 300},
+	}
+	for _, test := range tests {
+		if got := cancellationFee(test.policy, 300, stay, test.now); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestPenaltyAmountRoundsFirstNight(t *testing.T) {
+	stay, err := parseStay("2025-08-10", "2025-08-13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := penaltyAmount(penaltyFirstNight, 100, stay); got != 33.33 {
+		t.Errorf("expected 33.33, got %v", got)
+	}
+	if got := penaltyAmount(penaltyNone, 100, stay); got != 0 {
+		t.Errorf("expected no charge, got %v", got)
+	}
+}
+
+func TestCancellationPolicyValidate(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		policy CancellationPolicy
+		ok     bool
+	}{
+		{CancellationPolicy{Name: "Flexible", CancelPenalty: penaltyFirstNight, NoShowPenalty: penaltyFirstNight}, true},
+		{CancellationPolicy{CancelPenalty: penaltyNone, NoShowPenalty: penaltyNone}, false},
+		{CancellationPolicy{Name: "Odd", FreeUntilDays: &negative, CancelPenalty: penaltyNone, NoShowPenalty: penaltyNone}, false},
+		{CancellationPolicy{Name: "Odd", CancelPenalty: "half", NoShowPenalty: penaltyNone}, false},
+		{CancellationPolicy{Name: "Odd", CancelPenalty: penaltyNone}, false},
+	}
+	for i, test := range tests {
+		if _, ok := test.policy.validate(); ok != test.ok {
+			t.Errorf("case %d: expected ok=%v", i, test.ok)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errInvalidPhone is returned by normalizePhone for input that cannot be a
+// phone number.
+var errInvalidPhone = errors.New("phone must contain 7 to 15 digits, optionally starting with +")
+
+// normalizePhone strips the punctuation people type in phone numbers so the
+// same number is always stored (and matched) the same way. A blank phone is
+// returned as nil, which is stored as NULL and flags the guest's profile as
+// incomplete.
+func normalizePhone(raw *string) (*string, error) {
+	if raw == nil || strings.TrimSpace(*raw) == "" {
+		return nil, nil
+	}
+	var b strings.Builder
+	digits := 0
+	for i, r := range strings.TrimSpace(*raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+			digits++
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return nil, errInvalidPhone
+		}
+	}
+	if digits < 7 || digits > 15 {
+		return nil, errInvalidPhone
+	}
+	phone := b.String()
+	return &phone, nil
+}
+
+// guestMatch is an existing Guests row found by findGuestByContact.
+type guestMatch struct {
+	GuestID  int
+	UserID   int // 0 if the guest is not linked to an account
+	HasPhone bool
+}
+
+// findGuestByContact looks for an existing guest with the given email or
+// phone, preferring an email match. It returns nil if there is none.
+func findGuestByContact(q queryExecer, email string, phone *string) (*guestMatch, error) {
+	var m guestMatch
+	var owner sql.NullInt64
+	err := q.QueryRow(`
+		SELECT guest_id, user_id, phone IS NOT NULL FROM Guests
+		WHERE email = ? OR phone = ?
+		ORDER BY email = ? DESC, guest_id
+		LIMIT 1`,
+		email, phone, email,
+	).Scan(&m.GuestID, &owner, &m.HasPhone)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.UserID = int(owner.Int64)
+	return &m, nil
+}
+
+// completeGuestPhone fills in the phone of a guest created without one. If
+// another guest already has the number the profile is left incomplete for
+// staff to sort out rather than failing the caller's request.
+func completeGuestPhone(q queryExecer, guestID int, phone string) {
+	_, err := q.Exec("UPDATE Guests SET phone = ? WHERE guest_id = ? AND phone IS NULL", phone, guestID)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		log.Printf("Phone for guest %d is already used by another guest; leaving profile incomplete", guestID)
+		return
+	}
+	if err != nil {
+		log.Println("Error completing guest phone:", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string // "" means nil
+		wantErr bool
+	}{
+		{"", "", false},
+		{"   ", "", false},
+		{"(352) 555-0123", "3525550123", false},
+		{"+1 352.555.0123", "+13525550123", false},
+		{"555-01", "", true},
+		{"1234567890123456", "", true},
+		{"352-555-O123", "", true},
+		{"35+25550123", "", true},
+	}
+
+	for _, test := range tests {
+		input := test.input
+		got, err := normalizePhone(&input)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+			continue
+		}
+		if test.want == "" {
+			if got != nil {
+				t.Errorf("%q: expected nil, got %q", test.input, *got)
+			}
+		} else if got == nil || *got != test.want {
+			t.Errorf("%q: expected %q, got %v", test.input, test.want, got)
+		}
+	}
+
+	if got, err := normalizePhone(nil); got != nil || err != nil {
+		t.Errorf("nil: expected nil, got %v %v", got, err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression (minute hour
+// day-of-month month day-of-week), or a fixed interval from "@every <d>".
+// Each field is a bitset of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// As in cron, when both day fields are restricted a time matches if
+	// either does.
+	domAny, dowAny bool
+	every          time.Duration
+}
+
+// cronField describes the range of one field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// cronAliases are the shorthand schedules accepted besides five fields.
+var cronAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// parseCron parses a cron expression. Each field is "*", a number, a range
+// "a-b", or a list of those, optionally followed by a step "/n".
+func parseCron(spec string) (cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if alias, ok := cronAliases[spec]; ok {
+		spec = alias
+	}
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return cronSchedule{}, fmt.Errorf("invalid interval in %q", spec)
+		}
+		return cronSchedule{every: d}, nil
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return cronSchedule{}, fmt.Errorf("%q must have 5 fields", spec)
+	}
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return cronSchedule{}, err
+		}
+		sets[i] = set
+	}
+	// Sunday may be written as 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+	return cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the bitset of values matched by one field.
+func parseCronField(field string, f cronField) (uint64, error) {
+	top := f.max
+	if f.name == "day of week" {
+		top = 7
+	}
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, field)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, top
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid %s field %q", f.name, field)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid %s field %q", f.name, field)
+				}
+			} else if hasStep {
+				hi = top
+			}
+		}
+		if lo < f.min || hi > top || lo > hi {
+			return 0, fmt.Errorf("%s field %q is out of range %d-%d", f.name, field, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// matchesDay reports whether t's date satisfies the day-of-month and
+// day-of-week fields.
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// interval returns the time between the first two times after t that the
+// schedule fires.
+func (s cronSchedule) interval(t time.Time) time.Duration {
+	first := s.next(t)
+	return s.next(first).Sub(first)
+}
+
+// next returns the first time after t that the schedule fires. Intervals are
+// aligned to the Unix epoch so every replica computes the same times.
+func (s cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		// Not t.Truncate, which aligns to Go's zero time instead.
+		return t.Add(s.every - time.Duration(t.UnixNano())%s.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Any satisfiable schedule fires within five years (29 February); the
+	// zero time means it never does, e.g. "0 0 30 2 *".
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every",
+		"@every 10ms",
+		"@yearly",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"* * * * *", "2025-09-10 12:00:30", "2025-09-10 12:01:00"},
+		{"*/15 * * * *", "2025-09-10 12:14:00", "2025-09-10 12:15:00"},
+		{"*/15 * * * *", "2025-09-10 12:15:00", "2025-09-10 12:30:00"},
+		{"5 * * * *", "2025-09-10 12:05:00", "2025-09-10 13:05:00"},
+		{"0 3 * * *", "2025-09-10 03:00:00", "2025-09-11 03:00:00"},
+		{"@daily", "2025-12-31 23:59:00", "2026-01-01 00:00:00"},
+		{"30 4 1,15 * *", "2025-09-10 00:00:00", "2025-09-15 04:30:00"},
+		{"0 9 * * 1-5", "2025-09-12 10:00:00", "2025-09-15 09:00:00"}, // Friday to Monday
+		{"0 0 * * 7", "2025-09-10 00:00:00", "2025-09-14 00:00:00"},   // 7 is Sunday
+		// Both day fields restricted: either may match.
+		{"0 0 1 * 1", "2025-09-10 00:00:00", "2025-09-15 00:00:00"},
+		{"0 0 29 2 *", "2025-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"@every 10m", "2025-09-10 12:07:00", "2025-09-10 12:10:00"},
+		{"@every 1h", "2025-09-10 12:00:00", "2025-09-10 13:00:00"},
+		// 7 minutes does not divide an hour; 12:13 is a multiple since the epoch.
+		{"@every 7m", "2025-09-10 12:07:00", "2025-09-10 12:13:00"},
+	}
+	for _, test := range tests {
+		sched, err := parseCron(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+		from, _ := time.Parse(time.DateTime, test.from)
+		want, _ := time.Parse(time.DateTime, test.want)
+		if got := sched.next(from); !got.Equal(want) {
+			t.Errorf("%q from %s: expected %s, got %s", test.spec, test.from, test.want, got.Format(time.DateTime))
+		}
+	}
+}
+
+func TestCronNeverFires(t *testing.T) {
+	sched, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sched.next(time.Now()); !got.IsZero() {
+		t.Errorf("expected no next run, got %s", got)
+	}
+}
+
+func TestCronInterval(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want time.Duration
+	}{
+		{"@every 10m", "2025-09-10 12:07:00", 10 * time.Minute},
+		{"*/15 * * * *", "2025-09-10 12:14:00", 15 * time.Minute},
+		{"0 2 * * *", "2025-09-10 12:00:00", 24 * time.Hour},
+		// Friday to Monday when the next run is on a Friday.
+		{"0 9 * * 1-5", "2025-09-12 08:00:00", 72 * time.Hour},
+	}
+	for _, test := range tests {
+		sched, err := parseCron(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+		from, _ := time.Parse(time.DateTime, test.from)
+		if got := sched.interval(from); got != test.want {
+			t.Errorf("%q from %s: expected %s, got %s", test.spec, test.from, test.want, got)
+		}
+	}
+}
+
+func TestJobLeaseUntil(t *testing.T) {
+	sched, err := parseCron("@every 10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &scheduledJob{Name: "test", schedule: sched}
+	at := func(s string) time.Time {
+		v, _ := time.Parse(time.DateTime, s)
+		return v
+	}
+
+	// A scheduled run's lease lapses exactly when the next slot is due.
+	if got := job.leaseUntil(at("2025-09-10 12:10:00"), false); !got.Equal(at("2025-09-10 12:20:00")) {
+		t.Errorf("scheduled run: expected the lease to end at 12:20, got %s", got.Format(time.DateTime))
+	}
+	if got := job.leaseUntil(at("2025-09-10 12:13:30"), true); !got.Equal(at("2025-09-10 12:23:30")) {
+		t.Errorf("manual run: expected the lease to end at 12:23:30, got %s", got.Format(time.DateTime))
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scoring thresholds for duplicate detection. A pair is recorded when its
+// score reaches dupMinScore; names must be at least dupNameSimilarity alike
+// before they count towards the score at all.
+const (
+	dupMinScore       = 0.75
+	dupNameSimilarity = 0.85
+)
+
+// dedupGuest is the subset of a Guests row used for duplicate detection.
+type dedupGuest struct {
+	GuestID   int
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+}
+
+// GuestDuplicate is a candidate pair stored in Guest_Duplicates.
+type GuestDuplicate struct {
+	DuplicateID int       `json:"duplicate_id"`
+	GuestIDA    int       `json:"guest_id_a"`
+	GuestIDB    int       `json:"guest_id_b"`
+	Score       float64   `json:"score"`
+	Reasons     string    `json:"reasons"`
+	Status      string    `json:"status"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// normalizeEmailForMatch folds the variants one mailbox is commonly written
+// as: case, "+tag" suffixes, and dots in Gmail addresses.
+func normalizeEmailForMatch(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// normalizePhoneForMatch reduces a stored phone to its last ten digits so
+// numbers saved with and without a country code compare equal.
+func normalizePhoneForMatch(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	d := digits.String()
+	if len(d) > 10 {
+		d = d[len(d)-10:]
+	}
+	return d
+}
+
+// normalizeNameForMatch lowercases a name and drops everything but letters.
+func normalizeNameForMatch(first, last string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, first+last)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// similarity returns 1 for identical strings down to 0 for nothing in common.
+func similarity(a, b string) float64 {
+	longest := max(len([]rune(a)), len([]rune(b)))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// scoreGuestPair rates how likely two guests are the same person and lists
+// the signals that matched.
+func scoreGuestPair(a, b dedupGuest) (float64, []string) {
+	var score float64
+	var reasons []string
+
+	if normalizeEmailForMatch(a.Email) == normalizeEmailForMatch(b.Email) {
+		score = 1
+		reasons = append(reasons, "email")
+	}
+	if pa, pb := normalizePhoneForMatch(a.Phone), normalizePhoneForMatch(b.Phone); pa != "" && pa == pb {
+		score = max(score, 0.95)
+		reasons = append(reasons, "phone")
+	}
+
+	// A similar name alone is not enough (there are many John Smiths), so it
+	// is weighed together with how alike the email addresses are.
+	nameSim := similarity(normalizeNameForMatch(a.FirstName, a.LastName), normalizeNameForMatch(b.FirstName, b.LastName))
+	if nameSim >= dupNameSimilarity {
+		localA, _, _ := strings.Cut(normalizeEmailForMatch(a.Email), "@")
+		localB, _, _ := strings.Cut(normalizeEmailForMatch(b.Email), "@")
+		score = max(score, 0.6*nameSim+0.4*similarity(localA, localB))
+		reasons = append(reasons, "name")
+	}
+	return score, reasons
+}
+
+// findDuplicateGuests compares every pair of guests and returns those scoring
+// at least dupMinScore, with GuestIDA < GuestIDB.
+func findDuplicateGuests(guests []dedupGuest) []GuestDuplicate {
+	sort.Slice(guests, func(i, j int) bool { return guests[i].GuestID < guests[j].GuestID })
+	var pairs []GuestDuplicate
+	for i := range guests {
+		for j := i + 1; j < len(guests); j++ {
+			score, reasons := scoreGuestPair(guests[i], guests[j])
+			if score >= dupMinScore {
+				pairs = append(pairs, GuestDuplicate{
+					GuestIDA: guests[i].GuestID,
+					GuestIDB: guests[j].GuestID,
+					Score:    score,
+					Reasons:  strings.Join(reasons, ","),
+				})
+			}
+		}
+	}
+	return pairs
+}
+
+// scanGuestDuplicates runs duplicate detection over all guests and records new
+// candidate pairs. Pairs already reviewed (dismissed) are left alone.
+func scanGuestDuplicates() (int, error) {
+	rows, err := db.Query("SELECT guest_id, first_name, last_name, email, COALESCE(phone, '') FROM Guests WHERE erased_at IS NULL")
+	if err != nil {
+		return 0, err
+	}
+	var guests []dedupGuest
+	for rows.Next() {
+		var g dedupGuest
+		if err := rows.Scan(&g.GuestID, &g.FirstName, &g.LastName, &g.Email, &g.Phone); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		guests = append(guests, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	found := 0
+	for _, p := range findDuplicateGuests(guests) {
+		res, err := db.Exec(`
+			INSERT INTO Guest_Duplicates (guest_id_a, guest_id_b, score, reasons) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE score = VALUES(score), reasons = VALUES(reasons)`,
+			p.GuestIDA, p.GuestIDB, p.Score, p.Reasons)
+		if err != nil {
+			return found, err
+		}
+		// MySQL reports 1 affected row for an insert and 2 for an update.
+		if n, _ := res.RowsAffected(); n == 1 {
+			found++
+		}
+	}
+	return found, nil
+}
+
+// startGuestDedupJob schedules duplicate detection on GUEST_DEDUP_INTERVAL
+// (default daily at 3am).
+func startGuestDedupJob() {
+	registerJob("guest-dedup", "GUEST_DEDUP_INTERVAL", "0 3 * * *", func() error {
+		n, err := scanGuestDuplicates()
+		if n > 0 {
+			log.Printf("Found %d new duplicate guest candidates", n)
+		}
+		return err
+	})
+}
+
+// scanDuplicates handles POST /guests/duplicates/scan
+func scanDuplicates(c *gin.Context) {
+	n, err := scanGuestDuplicates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning for duplicates", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"new_candidates": n})
+}
+
+// getDuplicates handles GET /guests/duplicates
+// ?status= defaults to open.
+func getDuplicates(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT duplicate_id, guest_id_a, guest_id_b, score, reasons, status, detected_at
+		FROM Guest_Duplicates WHERE status = ? ORDER BY score DESC, duplicate_id`,
+		c.DefaultQuery("status", "open"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching duplicates", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	duplicates := []GuestDuplicate{}
+	for rows.Next() {
+		var d GuestDuplicate
+		if err := rows.Scan(&d.DuplicateID, &d.GuestIDA, &d.GuestIDB, &d.Score, &d.Reasons, &d.Status, &d.DetectedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning duplicate", "details": err.Error()})
+			return
+		}
+		duplicates = append(duplicates, d)
+	}
+	c.JSON(http.StatusOK, duplicates)
+}
+
+// dismissDuplicate handles POST /guests/duplicates/:id/dismiss
+// Dismissed pairs are not reported again by later scans.
+func dismissDuplicate(c *gin.Context) {
+	result, err := db.Exec("UPDATE Guest_Duplicates SET status = 'dismissed' WHERE duplicate_id = ? AND status = 'open'", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error dismissing duplicate", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Open duplicate not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Duplicate dismissed"})
+}
+
+// guestReferences are the columns mergeGuests re-points from the duplicates
+// to the surviving guest. Guest_Preferences is merged by preferencesToMove,
+// and Guest_Duplicates pairs naming a duplicate are resolved by the merge and
+// cascade away with it.
+var guestReferences = []struct{ table, column string }{
+	{"Reservations", "guest_id"},
+	{"Reviews", "guest_id"},
+	{"Group_Bookings", "leader_guest_id"},
+}
+
+// preferencesToMove returns the ids of the duplicates' preferences the
+// survivor does not already have, each category and wording once.
+func preferencesToMove(survivor, duplicates []GuestPreference) []int {
+	key := func(p GuestPreference) string {
+		return p.Category + "\x00" + strings.ToLower(strings.TrimSpace(p.Preference))
+	}
+	have := map[string]bool{}
+	for _, p := range survivor {
+		have[key(p)] = true
+	}
+	var ids []int
+	for _, p := range duplicates {
+		if !have[key(p)] {
+			have[key(p)] = true
+			ids = append(ids, p.PreferenceID)
+		}
+	}
+	return ids
+}
+
+// guestPreferences returns the preferences of the guests in placeholders.
+func guestPreferences(q queryExecer, placeholders string, args []interface{}) ([]GuestPreference, error) {
+	rows, err := q.Query("SELECT preference_id, category, preference FROM Guest_Preferences WHERE guest_id IN ("+placeholders+") ORDER BY preference_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prefs []GuestPreference
+	for rows.Next() {
+		var p GuestPreference
+		if err := rows.Scan(&p.PreferenceID, &p.Category, &p.Preference); err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, p)
+	}
+	return prefs, rows.Err()
+}
+
+// mergeGuests handles POST /guests/merge
+// Everything in guestReferences is moved from the duplicates to the surviving
+// guest (Payments follow their reservations), along with the preferences it
+// lacks, and the duplicates are deleted, all in one transaction. The
+// survivor keeps its own details, taking the phone and linked account from a
+// duplicate only where it has none.
+func mergeGuests(c *gin.Context) {
+	var req struct {
+		SurvivorID   int   `json:"survivor_id"`
+		DuplicateIDs []int `json:"duplicate_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.SurvivorID == 0 || len(req.DuplicateIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "survivor_id and duplicate_ids are required"})
+		return
+	}
+	ids := []interface{}{req.SurvivorID}
+	for _, id := range req.DuplicateIDs {
+		if id == req.SurvivorID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "survivor_id cannot also be a duplicate"})
+			return
+		}
+		ids = append(ids, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(req.DuplicateIDs)), ",")
+	dupArgs := ids[1:]
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging guests", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock every guest involved so concurrent bookings wait for the merge.
+	rows, err := tx.Query("SELECT guest_id, phone, user_id FROM Guests WHERE guest_id IN (?,"+placeholders+") ORDER BY guest_id FOR UPDATE", ids...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging guests", "details": err.Error()})
+		return
+	}
+	phones := map[int]sql.NullString{}
+	owners := map[int]sql.NullInt64{}
+	for rows.Next() {
+		var id int
+		var phone sql.NullString
+		var owner sql.NullInt64
+		if err := rows.Scan(&id, &phone, &owner); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging guests", "details": err.Error()})
+			return
+		}
+		phones[id] = phone
+		owners[id] = owner
+	}
+	rows.Close()
+	if len(phones) != len(ids) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "One or more guests not found"})
+		return
+	}
+
+	for _, ref := range guestReferences {
+		if _, err := tx.Exec("UPDATE "+ref.table+" SET "+ref.column+" = ? WHERE "+ref.column+" IN ("+placeholders+")",
+			append([]interface{}{req.SurvivorID}, dupArgs...)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving " + strings.ToLower(strings.ReplaceAll(ref.table, "_", " ")), "details": err.Error()})
+			return
+		}
+	}
+
+	survivorPrefs, err := guestPreferences(tx, "?", ids[:1])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving preferences", "details": err.Error()})
+		return
+	}
+	dupPrefs, err := guestPreferences(tx, placeholders, dupArgs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving preferences", "details": err.Error()})
+		return
+	}
+	for _, id := range preferencesToMove(survivorPrefs, dupPrefs) {
+		if _, err := tx.Exec("UPDATE Guest_Preferences SET guest_id = ? WHERE preference_id = ?", req.SurvivorID, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving preferences", "details": err.Error()})
+			return
+		}
+	}
+
+	var phone sql.NullString
+	var owner sql.NullInt64
+	for _, id := range req.DuplicateIDs {
+		if !phone.Valid && phones[id].Valid {
+			phone = phones[id]
+		}
+		if !owner.Valid && owners[id].Valid {
+			owner = owners[id]
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM Guests WHERE guest_id IN ("+placeholders+")", dupArgs...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting duplicates", "details": err.Error()})
+		return
+	}
+	// The phone is copied after the duplicates are gone because it is unique.
+	if !phones[req.SurvivorID].Valid && phone.Valid {
+		if _, err := tx.Exec("UPDATE Guests SET phone = ? WHERE guest_id = ?", phone, req.SurvivorID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging guests", "details": err.Error()})
+			return
+		}
+	}
+	if !owners[req.SurvivorID].Valid && owner.Valid {
+		if _, err := tx.Exec("UPDATE Guests SET user_id = ? WHERE guest_id = ?", owner, req.SurvivorID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging guests", "details": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error merging guests", "details": err.Error()})
+		return
+	}
+
+	recordAudit(auditGuestMerge, c.GetInt("user_id"), fmt.Sprint(req.SurvivorID), c.ClientIP(),
+		fmt.Sprintf("merged guests %v into %d", req.DuplicateIDs, req.SurvivorID))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Guests merged successfully", "guest_id": req.SurvivorID})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"kitten", "sitting", 3},
+		{"jon", "john", 1},
+		{"smith", "smith", 0},
+		{"", "abc", 3},
+	}
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeEmailForMatch(t *testing.T) {
+	tests := map[string]string{
+		"John.Smith+travel@Gmail.com": "johnsmith@gmail.com",
+		"j.smith@googlemail.com":      "jsmith@gmail.com",
+		"j.smith+x@example.com":       "j.smith@example.com",
+		"not-an-email":                "not-an-email",
+	}
+	for input, want := range tests {
+		if got := normalizeEmailForMatch(input); got != want {
+			t.Errorf("normalizeEmailForMatch(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestFindDuplicateGuests(t *testing.T) {
+	guests := []dedupGuest{
+		{GuestID: 4, FirstName: "John", LastName: "Smith", Email: "john.smith+hotel@gmail.com"},
+		{GuestID: 1, FirstName: "John", LastName: "Smith", Email: "johnsmith@gmail.com", Phone: "3525550123"},
+		{GuestID: 2, FirstName: "Jon", LastName: "Smith", Email: "jon.smith@ufl.edu"},
+		{GuestID: 3, FirstName: "Maria", LastName: "Garcia", Email: "maria@example.com", Phone: "+13525550123"},
+		{GuestID: 5, FirstName: "John", LastName: "Smith", Email: "bigjim77@work.com"},
+	}
+
+	got := map[[2]int]string{}
+	for _, p := range findDuplicateGuests(guests) {
+		got[[2]int{p.GuestIDA, p.GuestIDB}] = p.Reasons
+	}
+
+	want := map[[2]int]string{
+		{1, 4}: "email,name", // same mailbox written differently
+		{1, 3}: "phone",      // same number with and without country code
+		{2, 4}: "name",       // similar name and similar email
+		{1, 2}: "name",
+	}
+	for pair, reasons := range want {
+		if got[pair] != reasons {
+			t.Errorf("pair %v: expected reasons %q, got %q", pair, reasons, got[pair])
+		}
+	}
+	// Same name but an unrelated email is not enough on its own.
+	if _, ok := got[[2]int{1, 5}]; ok {
+		t.Errorf("pair [1 5] should not be reported: %v", got)
+	}
+}
+
+func TestPreferencesToMove(t *testing.T) {
+	survivor := []GuestPreference{
+		{PreferenceID: 1, Category: "bedding", Preference: "Extra pillows"},
+	}
+	duplicates := []GuestPreference{
+		{PreferenceID: 7, Category: "bedding", Preference: "extra pillows "},
+		{PreferenceID: 8, Category: "dietary", Preference: "Vegetarian"},
+		{PreferenceID: 9, Category: "room", Preference: "High floor"},
+		{PreferenceID: 12, Category: "dietary", Preference: "vegetarian"},
+		{PreferenceID: 13, Category: "other", Preference: "Extra pillows"},
+	}
+	got := preferencesToMove(survivor, duplicates)
+	want := []int{8, 9, 13}
+	if len(got) != len(want) {
+		t.Fatalf("expected preferences %v to move, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected preferences %v to move, got %v", want, got)
+			break
+		}
+	}
+}
+
+// schemaForeignKeys returns the table and column of every foreign key in
+// hotel_db_setup.sql that references the given table.
+func schemaForeignKeys(t *testing.T, references string) [][2]string {
+	t.Helper()
+	schema, err := os.ReadFile("hotel_db_setup.sql")
+	if err != nil {
+		t.Fatalf("Could not read schema: %v", err)
+	}
+	fk := regexp.MustCompile(`FOREIGN KEY \((\w+)\) REFERENCES ` + references + `\(`)
+	var keys [][2]string
+	for _, table := range strings.Split(string(schema), "CREATE TABLE ")[1:] {
+		name := strings.Fields(table)[0]
+		for _, m := range fk.FindAllStringSubmatch(table, -1) {
+			keys = append(keys, [2]string{name, m[1]})
+		}
+	}
+	return keys
+}
+
+// TestMergeCoversGuestReferences fails when a table gains a foreign key to
+// Guests that mergeGuests does not carry over to the survivor.
+func TestMergeCoversGuestReferences(t *testing.T) {
+	handled := map[[2]string]bool{
+		{"Guest_Preferences", "guest_id"}:  true,
+		{"Guest_Duplicates", "guest_id_a"}: true,
+		{"Guest_Duplicates", "guest_id_b"}: true,
+	}
+	for _, ref := range guestReferences {
+		handled[[2]string{ref.table, ref.column}] = true
+	}
+	for _, key := range schemaForeignKeys(t, "Guests") {
+		if !handled[key] {
+			t.Errorf("%s.%s references Guests but is not moved by mergeGuests", key[0], key[1])
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GroupBooking is a block of reservations booked together, such as a wedding
+// or conference. With SharedFolio the leader settles every room's charges on
+// one bill; otherwise each reservation is billed on its own.
+type GroupBooking struct {
+	GroupID       int           `json:"group_id"`
+	Name          string        `json:"name"`
+	LeaderGuestID int           `json:"leader_guest_id"`
+	SharedFolio   bool          `json:"shared_folio"`
+	Status        string        `json:"status"`
+	Notes         string        `json:"notes,omitempty"`
+	CreatedBy     int           `json:"created_by"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Reservations  []Reservation `json:"reservations"`
+}
+
+// groupConflict is one room in a group request that cannot be booked.
+type groupConflict struct {
+	Index  int    `json:"index"`
+	RoomID int    `json:"room_id"`
+	Reason string `json:"reason"`
+}
+
+// checkGroupAvailability returns the rooms in the request that cannot be
+// booked, including rooms requested twice for overlapping dates.
+func checkGroupAvailability(q queryExecer, rooms []Reservation, stays []stayRange) ([]groupConflict, error) {
+	var conflicts []groupConflict
+	for i, r := range rooms {
+		for j := 0; j < i; j++ {
+			if rooms[j].RoomID == r.RoomID && stays[j].overlaps(stays[i]) {
+				conflicts = append(conflicts, groupConflict{i, r.RoomID, fmt.Sprintf("overlaps room %d earlier in this group", j)})
+			}
+		}
+		reason, err := roomConflict(q, r.RoomID, stays[i])
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			conflicts = append(conflicts, groupConflict{i, r.RoomID, reason})
+		}
+	}
+	return conflicts, nil
+}
+
+// groupAccessible reports whether the group exists and the caller may see it:
+// staff, or the user who booked it.
+func groupAccessible(c *gin.Context, groupID string) (bool, error) {
+	query := "SELECT 1 FROM Group_Bookings WHERE group_id = ?"
+	args := []interface{}{groupID}
+	if !isStaff(c) {
+		query += " AND created_by = ?"
+		args = append(args, c.GetInt("user_id"))
+	}
+	var exists int
+	err := db.QueryRow(query, args...).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// createGroupBooking handles POST /groups
+// Each entry in rooms is a reservation as accepted by POST /reservations; an
+// entry without guest details is booked for the leader, who is the guest of
+// rooms[leader_index]. Either every room is booked or, if any is unavailable,
+// none is and the conflicts are returned.
+func createGroupBooking(c *gin.Context) {
+	var req struct {
+		Name        string        `json:"name"`
+		SharedFolio bool          `json:"shared_folio"`
+		Notes       string        `json:"notes"`
+		LeaderIndex int           `json:"leader_index"`
+		Rooms       []Reservation `json:"rooms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if req.Name == "" || len(req.Rooms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and at least one room are required"})
+		return
+	}
+	if req.LeaderIndex < 0 || req.LeaderIndex >= len(req.Rooms) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "leader_index must refer to one of the rooms"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	stays := make([]stayRange, len(req.Rooms))
+	roomIDs := make([]int, len(req.Rooms))
+	for i := range req.Rooms {
+		r := &req.Rooms[i]
+		stay, err := parseStay(r.CheckInDate, r.CheckOutDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rooms[%d]: %v", i, err)})
+			return
+		}
+		if msg, ok := validateRequests(r.SpecialRequests); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rooms[%d]: %s", i, msg)})
+			return
+		}
+		r.UserID = userID
+		stays[i] = stay
+		roomIDs[i] = r.RoomID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating group booking", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockRooms(tx, roomIDs); err != nil {
+		if err == errRoomNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "One or more rooms not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		}
+		return
+	}
+	conflicts, err := checkGroupAvailability(tx, req.Rooms, stays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		return
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Some rooms are not available; nothing was booked", "conflicts": conflicts})
+		return
+	}
+
+	// Resolve the leader first so rooms without their own guest can use it.
+	// New guests are created in tx so a failed booking leaves none behind.
+	order := []int{req.LeaderIndex}
+	for i := range req.Rooms {
+		if i != req.LeaderIndex {
+			order = append(order, i)
+		}
+	}
+	leader := &req.Rooms[req.LeaderIndex]
+	for _, i := range order {
+		r := &req.Rooms[i]
+		if i != req.LeaderIndex && r.GuestID == 0 && r.Email == "" {
+			r.GuestID = leader.GuestID
+			continue
+		}
+		ok, err := guestAccessible(c, fmt.Sprint(r.GuestID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+			return
+		}
+		if !ok {
+			if status, msg := resolveReservationGuest(c, tx, r); status != 0 {
+				c.JSON(status, gin.H{"error": fmt.Sprintf("rooms[%d]: %s", i, msg)})
+				return
+			}
+		}
+	}
+
+	result, err := tx.Exec("INSERT INTO Group_Bookings (name, leader_guest_id, shared_folio, notes, created_by) VALUES (?, ?, ?, ?, ?)",
+		req.Name, leader.GuestID, req.SharedFolio, req.Notes, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating group booking", "details": err.Error()})
+		return
+	}
+	gid, _ := result.LastInsertId()
+	groupID := int(gid)
+
+	for i := range req.Rooms {
+		r := &req.Rooms[i]
+		rate, err := roomRate(tx, r.RoomID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error pricing room", "details": err.Error()})
+			return
+		}
+		r.Status, r.TotalPrice = bookingTerms(isStaff(c), r.Status, r.TotalPrice, rate, stays[i])
+		result, err := tx.Exec(`
+			INSERT INTO Reservations (guest_id, room_id, check_in_date, check_out_date, status, total_price, group_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.GuestID, r.RoomID, r.CheckInDate, r.CheckOutDate, r.Status, r.TotalPrice, groupID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reservation", "details": err.Error()})
+			return
+		}
+		id, _ := result.LastInsertId()
+		r.ReservationID = int(id)
+		if err := insertReservationRequests(tx, r.ReservationID, r.SpecialRequests); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving special requests", "details": err.Error()})
+			return
+		}
+		if err := snapshotCancellationPolicy(tx, r.ReservationID, r.RoomID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving cancellation policy", "details": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating group booking", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, GroupBooking{
+		GroupID:       groupID,
+		Name:          req.Name,
+		LeaderGuestID: leader.GuestID,
+		SharedFolio:   req.SharedFolio,
+		Status:        "Active",
+		Notes:         req.Notes,
+		CreatedBy:     userID,
+		CreatedAt:     time.Now(),
+		Reservations:  req.Rooms,
+	})
+}
+
+// loadGroupReservations returns the reservations in a group.
+func loadGroupReservations(groupID string) ([]Reservation, error) {
+	rows, err := db.Query(`
+		SELECT r.reservation_id, r.guest_id, r.room_id, r.check_in_date, r.check_out_date,
+		       r.status, r.total_price, r.created_at, g.first_name, g.last_name, g.email
+		FROM Reservations r
+		JOIN Guests g ON g.guest_id = r.guest_id
+		WHERE r.group_id = ?
+		ORDER BY r.reservation_id`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := []Reservation{}
+	for rows.Next() {
+		var r Reservation
+		var checkIn, checkOut time.Time
+		if err := rows.Scan(&r.ReservationID, &r.GuestID, &r.RoomID, &checkIn, &checkOut,
+			&r.Status, &r.TotalPrice, &r.CreatedAt, &r.FirstName, &r.LastName, &r.Email); err != nil {
+			return nil, err
+		}
+		r.CheckInDate = checkIn.Format(dateLayout)
+		r.CheckOutDate = checkOut.Format(dateLayout)
+		reservations = append(reservations, r)
+	}
+	return reservations, rows.Err()
+}
+
+// getGroupBooking handles GET /groups/:id
+func getGroupBooking(c *gin.Context) {
+	id := c.Param("id")
+	ok, err := groupAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching group", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var g GroupBooking
+	err = db.QueryRow(`SELECT group_id, name, leader_guest_id, shared_folio, status, COALESCE(notes, ''), created_by, created_at
+		FROM Group_Bookings WHERE group_id = ?`, id).
+		Scan(&g.GroupID, &g.Name, &g.LeaderGuestID, &g.SharedFolio, &g.Status, &g.Notes, &g.CreatedBy, &g.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching group", "details": err.Error()})
+		return
+	}
+	g.Reservations, err = loadGroupReservations(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching group reservations", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, g)
+}
+
+// getGroupFolio handles GET /groups/:id/folio
+// Charges are the room price of stays still going ahead plus any fees, such
+// as cancellation fees. For a shared folio it totals charges and payments
+// across the whole group; otherwise it lists the balance of each reservation.
+func getGroupFolio(c *gin.Context) {
+	id := c.Param("id")
+	ok, err := groupAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching folio", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var shared bool
+	var leader int
+	if err := db.QueryRow("SELECT shared_folio, leader_guest_id FROM Group_Bookings WHERE group_id = ?", id).Scan(&shared, &leader); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching folio", "details": err.Error()})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT r.reservation_id, r.room_id, r.guest_id,
+		       CASE WHEN r.status IN ('Cancelled', 'Walked', 'No-show') THEN 0 ELSE r.total_price END
+		         + COALESCE((SELECT SUM(ch.amount) FROM Reservation_Charges ch
+		           WHERE ch.reservation_id = r.reservation_id AND ch.charge_type <> 'room_night'), 0),
+		       COALESCE((SELECT SUM(p.amount) FROM Payments p WHERE p.reservation_id = r.reservation_id AND p.payment_status = 'Completed'), 0)
+		FROM Reservations r WHERE r.group_id = ?
+		ORDER BY r.reservation_id`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching folio", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type folioLine struct {
+		ReservationID int     `json:"reservation_id"`
+		RoomID        int     `json:"room_id"`
+		GuestID       int     `json:"guest_id"`
+		Charges       float64 `json:"charges"`
+		Paid          float64 `json:"paid"`
+		Balance       float64 `json:"balance"`
+	}
+	lines := []folioLine{}
+	var charges, paid float64
+	for rows.Next() {
+		var l folioLine
+		if err := rows.Scan(&l.ReservationID, &l.RoomID, &l.GuestID, &l.Charges, &l.Paid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning folio", "details": err.Error()})
+			return
+		}
+		l.Balance = l.Charges - l.Paid
+		charges += l.Charges
+		paid += l.Paid
+		lines = append(lines, l)
+	}
+
+	resp := gin.H{"shared_folio": shared, "lines": lines}
+	if shared {
+		resp["billed_to_guest_id"] = leader
+		resp["charges"] = charges
+		resp["paid"] = paid
+		resp["balance"] = charges - paid
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// cancelGroupBooking handles POST /groups/:id/cancel
+// Every reservation in the group that has not started is cancelled under its
+// own cancellation policy, as in POST /reservations/:id/cancel, and its room
+// offered to the waitlist.
+func cancelGroupBooking(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		WaiveFee bool `json:"waive_fee"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+			return
+		}
+	}
+	if req.WaiveFee && !isStaff(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only staff can waive cancellation fees"})
+		return
+	}
+	ok, err := groupAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling group", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling group", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT reservation_id FROM Reservations WHERE group_id = ? AND status IN ('Pending', 'Confirmed') ORDER BY reservation_id", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling reservations", "details": err.Error()})
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var resID int
+		if err := rows.Scan(&resID); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling reservations", "details": err.Error()})
+			return
+		}
+		ids = append(ids, resID)
+	}
+	rows.Close()
+
+	now := time.Now()
+	cancelled := []cancellation{}
+	var fees float64
+	for _, resID := range ids {
+		res, err := applyCancellation(tx, resID, now, req.WaiveFee)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling reservations", "details": err.Error()})
+			return
+		}
+		cancelled = append(cancelled, res)
+		fees += res.Fee
+	}
+	if _, err := tx.Exec("UPDATE Group_Bookings SET status = 'Cancelled' WHERE group_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling group", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling group", "details": err.Error()})
+		return
+	}
+
+	for _, res := range cancelled {
+		releaseToWaitlist(res.roomID, res.stay)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Group cancelled", "reservations_cancelled": len(cancelled), "cancellation_fees": fees, "cancellations": cancelled})
+}
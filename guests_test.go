@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGuestScopeRestrictsNonStaff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		role      string
+		wantScope bool
+	}{
+		{"guest", true},
+		{"", true},
+		{"staff", false},
+		{"manager", false},
+		{"admin", false},
+	}
+
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("user_id", 12)
+		c.Set("role", test.role)
+
+		scope, args := guestScope(c)
+		if test.wantScope {
+			if scope != " AND user_id = ?" || len(args) != 1 || args[0] != 12 {
+				t.Errorf("role %q: expected guests scoped to user 12, got %q %v", test.role, scope, args)
+			}
+		} else if scope != "" || len(args) != 0 {
+			t.Errorf("role %q: expected unrestricted access, got %q %v", test.role, scope, args)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// holdPolicy controls how long a room hold lasts and how many a user may have
+// at once.
+type holdPolicy struct {
+	ttl       time.Duration
+	maxActive int
+}
+
+var roomHolds = holdPolicy{
+	ttl:       15 * time.Minute,
+	maxActive: 5,
+}
+
+// Errors returned by consumeRoomHold.
+var (
+	errHoldNotFound = errors.New("hold not found or expired")
+	errHoldMismatch = errors.New("hold is for a different room or dates")
+)
+
+// initHoldPolicy reads the hold settings from the environment and starts the
+// sweeper that releases expired holds.
+func initHoldPolicy() {
+	roomHolds.ttl = time.Duration(envInt("ROOM_HOLD_MINUTES", int(roomHolds.ttl/time.Minute))) * time.Minute
+	roomHolds.maxActive = envInt("ROOM_HOLD_MAX_ACTIVE", roomHolds.maxActive)
+
+	registerJob("room-hold-sweeper", "ROOM_HOLD_SWEEP_INTERVAL", "* * * * *", func() error {
+		n, err := releaseExpiredHolds()
+		if n > 0 {
+			log.Printf("Released %d expired room holds", n)
+		}
+		return err
+	})
+}
+
+// RoomHold is a tentative claim on a room for a stay, made while the guest
+// completes checkout. Token is only returned when the hold is created.
+type RoomHold struct {
+	HoldID       int       `json:"hold_id"`
+	Token        string    `json:"hold_token,omitempty"`
+	RoomID       int       `json:"room_id"`
+	CheckInDate  string    `json:"check_in_date"`
+	CheckOutDate string    `json:"check_out_date"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// releaseExpiredHolds deletes holds past their expiry. roomConflict already
+// ignores them, so this only keeps Room_Holds small.
+func releaseExpiredHolds() (int64, error) {
+	result, err := db.Exec("DELETE FROM Room_Holds WHERE expires_at <= ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// insertRoomHold holds roomID for userID for ttl and returns the hold with its
+// raw token. The caller must have locked the room and checked it is free.
+func insertRoomHold(tx *sql.Tx, userID, roomID int, stay stayRange, ttl time.Duration) (RoomHold, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return RoomHold{}, err
+	}
+	hold := RoomHold{
+		Token:        hex.EncodeToString(buf),
+		RoomID:       roomID,
+		CheckInDate:  stay.CheckIn.Format(dateLayout),
+		CheckOutDate: stay.CheckOut.Format(dateLayout),
+		ExpiresAt:    time.Now().Add(ttl),
+	}
+	result, err := tx.Exec(`
+		INSERT INTO Room_Holds (token_hash, room_id, user_id, check_in_date, check_out_date, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		hashAuthToken(hold.Token), roomID, userID, hold.CheckInDate, hold.CheckOutDate, hold.ExpiresAt)
+	if err != nil {
+		return RoomHold{}, err
+	}
+	id, _ := result.LastInsertId()
+	hold.HoldID = int(id)
+	return hold, nil
+}
+
+// consumeRoomHold deletes the caller's hold inside tx so the reservation
+// being created can take the room. The room must already be locked.
+func consumeRoomHold(tx *sql.Tx, raw string, userID, roomID int, stay stayRange) error {
+	var holdID, heldRoom int
+	var in, out time.Time
+	err := tx.QueryRow(`
+		SELECT hold_id, room_id, check_in_date, check_out_date FROM Room_Holds
+		WHERE token_hash = ? AND user_id = ? AND expires_at > ?
+		FOR UPDATE`,
+		hashAuthToken(raw), userID, time.Now(),
+	).Scan(&holdID, &heldRoom, &in, &out)
+	if err == sql.ErrNoRows {
+		return errHoldNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if heldRoom != roomID || !in.Equal(stay.CheckIn) || !out.Equal(stay.CheckOut) {
+		return errHoldMismatch
+	}
+	if _, err := tx.Exec("DELETE FROM Room_Holds WHERE hold_id = ?", holdID); err != nil {
+		return err
+	}
+	// A hold offered from the waitlist has now turned into a booking.
+	_, err = tx.Exec("UPDATE Waitlist SET status = ? WHERE hold_id = ?", waitlistBooked, holdID)
+	return err
+}
+
+// createRoomHold handles POST /holds
+// The room is held for ROOM_HOLD_MINUTES; pass the returned hold_token to
+// POST /reservations to book it.
+func createRoomHold(c *gin.Context) {
+	var hold RoomHold
+	if err := c.ShouldBindJSON(&hold); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	stay, err := parseStay(hold.CheckInDate, hold.CheckOutDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	var active int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Room_Holds WHERE user_id = ? AND expires_at > ?", userID, time.Now()).Scan(&active); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating hold", "details": err.Error()})
+		return
+	}
+	if active >= roomHolds.maxActive {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many rooms on hold; book or release one first"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating hold", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockRooms(tx, []int{hold.RoomID}); err != nil {
+		if err == errRoomNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		}
+		return
+	}
+	conflict, err := roomConflict(tx, hold.RoomID, stay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		return
+	}
+	if conflict != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Room is " + conflict})
+		return
+	}
+
+	hold, err = insertRoomHold(tx, userID, hold.RoomID, stay, roomHolds.ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating hold", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating hold", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+// getMyHolds handles GET /holds
+func getMyHolds(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT hold_id, room_id, check_in_date, check_out_date, expires_at FROM Room_Holds
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY expires_at`, c.GetInt("user_id"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching holds", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	holds := []RoomHold{}
+	for rows.Next() {
+		var h RoomHold
+		var in, out time.Time
+		if err := rows.Scan(&h.HoldID, &h.RoomID, &in, &out, &h.ExpiresAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning hold", "details": err.Error()})
+			return
+		}
+		h.CheckInDate = in.Format(dateLayout)
+		h.CheckOutDate = out.Format(dateLayout)
+		holds = append(holds, h)
+	}
+	c.JSON(http.StatusOK, holds)
+}
+
+// releaseRoomHold handles DELETE /holds/:id
+// Lets an abandoned checkout free the room before the hold expires.
+func releaseRoomHold(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM Room_Holds WHERE hold_id = ? AND user_id = ?", c.Param("id"), c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error releasing hold", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Hold released"})
+}
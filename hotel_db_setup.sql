@@ -4,13 +4,40 @@ USE hotel;
 
 -- Drop tables if they already exist to ensure a clean setup.
 DROP TABLE IF EXISTS Staff_Schedule;
+DROP TABLE IF EXISTS Shift_Templates;
+DROP TABLE IF EXISTS Shift_Coverage;
+DROP TABLE IF EXISTS Housekeeping_Tasks;
+DROP TABLE IF EXISTS Work_Orders;
+DROP TABLE IF EXISTS Job_Runs;
+DROP TABLE IF EXISTS Job_Leases;
+DROP TABLE IF EXISTS Audit_Discrepancies;
 DROP TABLE IF EXISTS Reviews;
+DROP TABLE IF EXISTS Reservation_Requests;
+DROP TABLE IF EXISTS Guest_Preferences;
+DROP TABLE IF EXISTS Guest_Duplicates;
 DROP TABLE IF EXISTS Room_Availability;
+DROP TABLE IF EXISTS Room_Holds;
+DROP TABLE IF EXISTS Waitlist;
+DROP TABLE IF EXISTS Loyalty_Ledger;
+DROP TABLE IF EXISTS Loyalty_Tiers;
+DROP TABLE IF EXISTS Walks;
+DROP TABLE IF EXISTS Partner_Properties;
+DROP TABLE IF EXISTS Overbooking_Allowances;
+DROP TABLE IF EXISTS Reservation_Charges;
+DROP TABLE IF EXISTS Reservation_Policies;
 DROP TABLE IF EXISTS Payments;
 DROP TABLE IF EXISTS Reservations;
+DROP TABLE IF EXISTS Business_Days;
+DROP TABLE IF EXISTS Group_Bookings;
 DROP TABLE IF EXISTS Staff;
 DROP TABLE IF EXISTS Rooms;
+DROP TABLE IF EXISTS Cancellation_Policies;
 DROP TABLE IF EXISTS Guests;
+DROP TABLE IF EXISTS Auth_Tokens;
+DROP TABLE IF EXISTS Login_Failures;
+DROP TABLE IF EXISTS Audit_Log;
+DROP TABLE IF EXISTS User_Recovery_Codes;
+DROP TABLE IF EXISTS User_Preferences;
 DROP TABLE IF EXISTS Users;
 
 -- Users table for storing login credentials
@@ -18,18 +45,113 @@ CREATE TABLE Users (
     user_id INT AUTO_INCREMENT PRIMARY KEY,
     email VARCHAR(255) NOT NULL UNIQUE,
     password_hash VARCHAR(255) NOT NULL,
+    email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    role ENUM('guest', 'staff', 'manager', 'admin') NOT NULL DEFAULT 'guest',
+    totp_secret VARCHAR(64) NULL,
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_step BIGINT NULL,
+    -- Set when the owner erases the account; the row is anonymised, not
+    -- deleted, so the history that refers to it is kept
+    erased_at DATETIME NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- One-time 2FA recovery codes (only the SHA-256 hash is stored)
+CREATE TABLE User_Recovery_Codes (
+    code_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at DATETIME NULL,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE,
+    UNIQUE KEY uq_recovery_code (user_id, code_hash)
+);
+
+-- Account-level preferences maintained by the user through /me
+CREATE TABLE User_Preferences (
+    user_id INT PRIMARY KEY,
+    preferred_language VARCHAR(10) NOT NULL DEFAULT 'en',
+    contact_method ENUM('email', 'phone', 'sms') NOT NULL DEFAULT 'email',
+    marketing_opt_in BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE
+);
+
+-- Single-use email verification and password reset tokens (only the SHA-256 hash is stored)
+CREATE TABLE Auth_Tokens (
+    token_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose ENUM('verify_email', 'password_reset') NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE
+);
+
+-- Failed login counters per account (email) and per client IP
+CREATE TABLE Login_Failures (
+    scope ENUM('account', 'ip') NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    failed_count INT NOT NULL DEFAULT 0,
+    lockouts INT NOT NULL DEFAULT 0,
+    locked_until DATETIME NULL,
+    last_failed_at DATETIME NOT NULL,
+    PRIMARY KEY (scope, subject)
+);
+
+-- Security and data-change audit trail
+CREATE TABLE Audit_Log (
+    audit_id INT AUTO_INCREMENT PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    user_id INT NULL,
+    subject VARCHAR(255),
+    ip_address VARCHAR(45),
+    details TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_event (event_type, created_at)
+);
+
 -- Create Guests Table (linked to Users)
 CREATE TABLE Guests (
     guest_id INT AUTO_INCREMENT PRIMARY KEY,
     first_name VARCHAR(50) NOT NULL,
     last_name VARCHAR(50) NOT NULL,
     email VARCHAR(100) UNIQUE NOT NULL,
-    phone VARCHAR(20) UNIQUE NOT NULL,
+    phone VARCHAR(20) UNIQUE NULL,
+    -- Guests created without a phone (e.g. at booking time) are flagged so
+    -- the front desk can follow up.
+    profile_incomplete BOOLEAN AS (phone IS NULL AND erased_at IS NULL) STORED,
     user_id INT,
-    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE SET NULL
+    -- Set when the guest's personal data is anonymised on request
+    erased_at DATETIME NULL,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE SET NULL,
+    FULLTEXT INDEX ft_guests (first_name, last_name, email, phone)
+);
+
+-- Candidate duplicate guests found by the dedup job (guest_id_a < guest_id_b)
+CREATE TABLE Guest_Duplicates (
+    duplicate_id INT AUTO_INCREMENT PRIMARY KEY,
+    guest_id_a INT NOT NULL,
+    guest_id_b INT NOT NULL,
+    score DECIMAL(4,3) NOT NULL,
+    reasons VARCHAR(100) NOT NULL,
+    status ENUM('open', 'dismissed') NOT NULL DEFAULT 'open',
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_guest_pair (guest_id_a, guest_id_b),
+    FOREIGN KEY (guest_id_a) REFERENCES Guests(guest_id) ON DELETE CASCADE,
+    FOREIGN KEY (guest_id_b) REFERENCES Guests(guest_id) ON DELETE CASCADE
+);
+
+-- Cancellation terms: free until free_until_days before check-in (never when
+-- NULL), then cancel_penalty; no_show_penalty applies to no-shows
+CREATE TABLE Cancellation_Policies (
+    policy_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    free_until_days INT NULL,
+    cancel_penalty ENUM('none', 'first_night', 'full_stay') NOT NULL,
+    no_show_penalty ENUM('none', 'first_night', 'full_stay') NOT NULL,
+    description TEXT,
+    active BOOLEAN NOT NULL DEFAULT TRUE
 );
 
 -- Create Rooms Table
@@ -38,7 +160,27 @@ CREATE TABLE Rooms (
     room_number VARCHAR(10) UNIQUE NOT NULL,
     room_type ENUM('Single', 'Double', 'Suite', 'Deluxe') NOT NULL,
     price_per_night DECIMAL(10,2) NOT NULL,
-    status ENUM('Available', 'Booked', 'Maintenance') DEFAULT 'Available'
+    status ENUM('Available', 'Booked', 'Maintenance') DEFAULT 'Available',
+    -- Departures and stayovers make a room dirty until housekeeping cleans
+    -- it and a supervisor inspects it
+    housekeeping_status ENUM('dirty', 'clean', 'inspected') NOT NULL DEFAULT 'inspected',
+    -- Rooms without a policy can be cancelled free of charge
+    cancellation_policy_id INT NULL,
+    FOREIGN KEY (cancellation_policy_id) REFERENCES Cancellation_Policies(policy_id) ON DELETE SET NULL
+);
+
+-- Blocks of rooms booked together; with shared_folio the leader pays for all
+CREATE TABLE Group_Bookings (
+    group_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    leader_guest_id INT NOT NULL,
+    shared_folio BOOLEAN NOT NULL DEFAULT FALSE,
+    status ENUM('Active', 'Cancelled') NOT NULL DEFAULT 'Active',
+    notes TEXT,
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (leader_guest_id) REFERENCES Guests(guest_id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES Users(user_id) ON DELETE SET NULL
 );
 
 -- Create Reservations Table
@@ -48,33 +190,259 @@ CREATE TABLE Reservations (
     room_id INT NOT NULL,
     check_in_date DATE NOT NULL,
     check_out_date DATE NOT NULL,
-    status ENUM('Pending', 'Confirmed', 'Checked-in', 'Checked-out', 'Cancelled') DEFAULT 'Pending',
+    status ENUM('Pending', 'Confirmed', 'Checked-in', 'Checked-out', 'Cancelled', 'Walked', 'No-show') DEFAULT 'Pending',
     total_price DECIMAL(10,2) NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    group_id INT NULL,
+    -- Booked into an already reserved room under the overbooking allowance
+    overbooked BOOLEAN NOT NULL DEFAULT FALSE,
+    cancelled_at DATETIME NULL,
+    no_show_at DATETIME NULL,
+    -- Set only by the front desk check-out; stays earn loyalty points from it
+    checked_out_at DATETIME NULL,
     FOREIGN KEY (guest_id) REFERENCES Guests(guest_id) ON DELETE CASCADE,
-    FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE CASCADE
+    FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES Group_Bookings(group_id) ON DELETE SET NULL
+);
+
+-- Standing preferences on a guest's profile, applied to every stay
+CREATE TABLE Guest_Preferences (
+    preference_id INT AUTO_INCREMENT PRIMARY KEY,
+    guest_id INT NOT NULL,
+    category ENUM('room', 'bedding', 'accessibility', 'dietary', 'other') NOT NULL,
+    preference VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (guest_id) REFERENCES Guests(guest_id) ON DELETE CASCADE
+);
+
+-- Special requests for a single stay, worked by the front desk and housekeeping
+CREATE TABLE Reservation_Requests (
+    request_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL,
+    request_type ENUM('late_check_in', 'early_check_in', 'late_check_out', 'extra_bed', 'crib', 'accessibility', 'dietary', 'other') NOT NULL,
+    details VARCHAR(500),
+    status ENUM('requested', 'fulfilled', 'declined') NOT NULL DEFAULT 'requested',
+    status_note VARCHAR(255),
+    handled_by INT NULL,
+    handled_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (handled_by) REFERENCES Users(user_id) ON DELETE SET NULL,
+    INDEX idx_requests_status (status, reservation_id)
 );
 
 -- Create Payments Table
 CREATE TABLE Payments (
     payment_id INT AUTO_INCREMENT PRIMARY KEY,
     reservation_id INT NOT NULL,
-    payment_method ENUM('Credit Card', 'Debit Card', 'PayPal', 'Cash') NOT NULL,
+    payment_method ENUM('Credit Card', 'Debit Card', 'PayPal', 'Cash', 'Loyalty Points') NOT NULL,
     payment_status ENUM('Pending', 'Completed', 'Failed', 'Refunded') DEFAULT 'Pending',
     amount DECIMAL(10,2) NOT NULL,
     transaction_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE
 );
 
+-- The cancellation policy in force when each reservation was booked
+CREATE TABLE Reservation_Policies (
+    reservation_id INT PRIMARY KEY,
+    policy_id INT NULL,
+    name VARCHAR(50) NOT NULL,
+    free_until_days INT NULL,
+    cancel_penalty ENUM('none', 'first_night', 'full_stay') NOT NULL,
+    no_show_penalty ENUM('none', 'first_night', 'full_stay') NOT NULL,
+    captured_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (policy_id) REFERENCES Cancellation_Policies(policy_id) ON DELETE SET NULL
+);
+
+-- Charges posted to a reservation: fees beyond its room price, and the
+-- night audit's room-night charges, which make up total_price as the stay
+-- goes on. business_date is the business day the charge was posted to.
+CREATE TABLE Reservation_Charges (
+    charge_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL,
+    charge_type ENUM('cancellation', 'no_show', 'room_night') NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    description VARCHAR(255),
+    business_date DATE NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_charges_day (reservation_id, charge_type, business_date),
+    INDEX idx_charges_business_date (business_date),
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE
+);
+
+-- The hotel's business dates. Charges post to the single open day; the
+-- night audit closes it, freezing it with its day-close summary, and opens
+-- the next
+CREATE TABLE Business_Days (
+    business_date DATE PRIMARY KEY,
+    status ENUM('open', 'closed') NOT NULL DEFAULT 'open',
+    room_nights INT NOT NULL DEFAULT 0,
+    room_revenue DECIMAL(10,2) NOT NULL DEFAULT 0,
+    other_charges DECIMAL(10,2) NOT NULL DEFAULT 0,
+    payments DECIMAL(10,2) NOT NULL DEFAULT 0,
+    rooms_total INT NOT NULL DEFAULT 0,
+    rooms_out_of_order INT NOT NULL DEFAULT 0,
+    occupancy_percent DECIMAL(5,2) NOT NULL DEFAULT 0,
+    arrivals INT NOT NULL DEFAULT 0,
+    departures INT NOT NULL DEFAULT 0,
+    no_shows INT NOT NULL DEFAULT 0,
+    cancellations INT NOT NULL DEFAULT 0,
+    discrepancies INT NOT NULL DEFAULT 0,
+    closed_by INT NULL,
+    closed_at DATETIME NULL,
+    FOREIGN KEY (closed_by) REFERENCES Users(user_id) ON DELETE SET NULL
+);
+
+-- Room and reservation status mismatches found by the night audit
+CREATE TABLE Audit_Discrepancies (
+    discrepancy_id INT AUTO_INCREMENT PRIMARY KEY,
+    business_date DATE NOT NULL,
+    kind ENUM('room_not_booked', 'room_vacant', 'overstay', 'double_occupancy') NOT NULL,
+    room_id INT NOT NULL,
+    reservation_id INT NULL,
+    details VARCHAR(255) NOT NULL,
+    FOREIGN KEY (business_date) REFERENCES Business_Days(business_date) ON DELETE CASCADE,
+    FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE CASCADE,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE SET NULL
+);
+
+-- How far beyond its room count each room type may be booked per night
+CREATE TABLE Overbooking_Allowances (
+    room_type ENUM('Single', 'Double', 'Suite', 'Deluxe') PRIMARY KEY,
+    percent DECIMAL(5,2) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Nearby hotels that take guests we cannot accommodate
+CREATE TABLE Partner_Properties (
+    partner_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    address VARCHAR(255),
+    phone VARCHAR(20),
+    email VARCHAR(255),
+    notes TEXT,
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Reservations relocated ("walked") to a partner property
+CREATE TABLE Walks (
+    walk_id INT AUTO_INCREMENT PRIMARY KEY,
+    reservation_id INT NOT NULL UNIQUE,
+    partner_id INT NOT NULL,
+    compensation_notes TEXT NOT NULL,
+    compensation_amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+    walked_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE,
+    FOREIGN KEY (partner_id) REFERENCES Partner_Properties(partner_id),
+    FOREIGN KEY (walked_by) REFERENCES Users(user_id) ON DELETE SET NULL
+);
+
+-- Loyalty programme tiers, reached by lifetime points earned
+CREATE TABLE Loyalty_Tiers (
+    tier_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    min_points INT NOT NULL UNIQUE,
+    earn_multiplier DECIMAL(3,2) NOT NULL DEFAULT 1.00,
+    benefits TEXT
+);
+
+-- Append-only points ledger; the balance is the sum of points. reservation_id
+-- and payment_id are kept without foreign keys so history survives deletions.
+CREATE TABLE Loyalty_Ledger (
+    entry_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    entry_type ENUM('stay', 'payment', 'redemption', 'adjustment', 'reversal') NOT NULL,
+    points INT NOT NULL,
+    reservation_id INT NULL,
+    payment_id INT NULL,
+    description VARCHAR(255),
+    -- Identifies the event credited ("stay:12", "payment:34") so it is only credited once
+    source_key VARCHAR(50) NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id),
+    INDEX idx_ledger_user (user_id, entry_id)
+);
+
+-- Ledger entries are immutable; corrections are made with adjustment entries.
+-- The foreign key has no cascade because cascaded deletes skip triggers.
+CREATE TRIGGER loyalty_ledger_no_update BEFORE UPDATE ON Loyalty_Ledger
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Loyalty_Ledger entries are immutable';
+
+CREATE TRIGGER loyalty_ledger_no_delete BEFORE DELETE ON Loyalty_Ledger
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Loyalty_Ledger entries are immutable';
+
 -- Create Room Availability Table
 CREATE TABLE Room_Availability (
     availability_id INT AUTO_INCREMENT PRIMARY KEY,
     room_id INT NOT NULL,
     date DATE NOT NULL,
     status ENUM('Available', 'Booked', 'Maintenance') DEFAULT 'Available',
+    -- The Work_Orders row that placed a maintenance block, removed with it
+    work_order_id INT NULL,
+    UNIQUE KEY uq_availability_night (room_id, date),
+    INDEX idx_availability_work_order (work_order_id),
     FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE CASCADE
 );
 
+-- Short-lived holds taken at checkout; only the token's SHA-256 is stored
+CREATE TABLE Room_Holds (
+    hold_id INT AUTO_INCREMENT PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    room_id INT NOT NULL,
+    user_id INT NOT NULL,
+    check_in_date DATE NOT NULL,
+    check_out_date DATE NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_room_holds_room (room_id, expires_at),
+    FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE
+);
+
+-- Guests waiting for a sold-out room type; hold_id is the Room_Holds row
+-- offered to them, which may since have expired and been deleted
+CREATE TABLE Waitlist (
+    waitlist_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    room_type ENUM('Single', 'Double', 'Suite', 'Deluxe') NOT NULL,
+    check_in_date DATE NOT NULL,
+    check_out_date DATE NOT NULL,
+    status ENUM('waiting', 'offered', 'booked', 'expired', 'cancelled') NOT NULL DEFAULT 'waiting',
+    room_id INT NULL,
+    hold_id INT NULL,
+    offered_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_waitlist_queue (room_type, status, created_at),
+    INDEX idx_waitlist_hold (hold_id),
+    FOREIGN KEY (user_id) REFERENCES Users(user_id) ON DELETE CASCADE,
+    FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE SET NULL
+);
+
+-- Scheduled jobs: one lease row per job, so that of several replicas only
+-- the holder runs it, and last_slot so each scheduled time runs once
+CREATE TABLE Job_Leases (
+    job_name VARCHAR(100) PRIMARY KEY,
+    holder VARCHAR(100) NULL,
+    lease_until DATETIME NULL,
+    last_slot DATETIME NULL
+);
+
+-- History of scheduled job runs
+CREATE TABLE Job_Runs (
+    run_id INT AUTO_INCREMENT PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL,
+    holder VARCHAR(100) NOT NULL,
+    scheduled_for DATETIME NOT NULL,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME NULL,
+    status ENUM('running', 'succeeded', 'failed') NOT NULL DEFAULT 'running',
+    error TEXT NULL,
+    INDEX idx_job_runs_job (job_name, run_id),
+    INDEX idx_job_runs_started (started_at)
+);
+
 -- Create Reviews Table
 CREATE TABLE Reviews (
     review_id INT AUTO_INCREMENT PRIMARY KEY,
@@ -87,17 +455,6 @@ CREATE TABLE Reviews (
     FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE CASCADE
 );
 
--- Create Staff Scheduling Table
-CREATE TABLE Staff_Schedule (
-    schedule_id INT AUTO_INCREMENT PRIMARY KEY,
-    staff_id INT NOT NULL,
-    shift_date VARCHAR(50) NOT NULL,
-    shift_time ENUM('Morning', 'Afternoon', 'Night') NOT NULL,
-    shift_date VARCHAR(50) NOT NULL,
-    shift_time ENUM('Morning', 'Afternoon', 'Night') NOT NULL,
-    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE
-);
-
 -- Create Staff Table
 CREATE TABLE Staff (
     staff_id INT AUTO_INCREMENT PRIMARY KEY,
@@ -107,9 +464,115 @@ CREATE TABLE Staff (
     role ENUM('Manager', 'Receptionist', 'Housekeeping', 'Security') NOT NULL
 );
 
-INSERT INTO Users (email, password_hash) VALUES
-('tarund2302@gmail.com', '$2a$10$eMWMtRpqmmW.Csp6sSQYSOeZaunKfDdvL0lcXjqQc5pHPZEq5xLpm'),
-('admin@gmail.com', '$2a$10$wMPF8JFdm3cSej97z3k92.X9fykHqN//e87wMC.9bsmlm7r6gtpJ.');
+-- The fewest staff of each role every shift must have; changes to
+-- Staff_Schedule may not take a shift below it
+CREATE TABLE Shift_Coverage (
+    role ENUM('Manager', 'Receptionist', 'Housekeeping', 'Security') NOT NULL,
+    shift_time ENUM('Morning', 'Afternoon', 'Night') NOT NULL,
+    min_staff INT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (role, shift_time)
+);
+
+-- Shifts a staff member works every week, from which Staff_Schedule rows are
+-- generated ahead of time
+CREATE TABLE Shift_Templates (
+    template_id INT AUTO_INCREMENT PRIMARY KEY,
+    staff_id INT NOT NULL,
+    weekday ENUM('Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday', 'Sunday') NOT NULL,
+    shift_time ENUM('Morning', 'Afternoon', 'Night') NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_template_shift (staff_id, weekday, shift_time),
+    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE
+);
+
+-- Create Staff Scheduling Table: one row per staff member per shift worked.
+-- An end_time at or before start_time is on the day after shift_date
+CREATE TABLE Staff_Schedule (
+    schedule_id INT AUTO_INCREMENT PRIMARY KEY,
+    staff_id INT NOT NULL,
+    shift_date DATE NOT NULL,
+    shift_time ENUM('Morning', 'Afternoon', 'Night') NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    template_id INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_schedule_shift (staff_id, shift_date, shift_time),
+    INDEX idx_schedule_date (shift_date, shift_time),
+    FOREIGN KEY (staff_id) REFERENCES Staff(staff_id) ON DELETE CASCADE,
+    FOREIGN KEY (template_id) REFERENCES Shift_Templates(template_id) ON DELETE SET NULL
+);
+
+-- Room cleaning work, created on check-out (departure) and each morning for
+-- guests staying on (stayover), and assigned to Housekeeping staff on shift
+CREATE TABLE Housekeeping_Tasks (
+    task_id INT AUTO_INCREMENT PRIMARY KEY,
+    room_id INT NOT NULL,
+    reservation_id INT NULL,
+    task_type ENUM('departure', 'stayover') NOT NULL,
+    task_date DATE NOT NULL,
+    status ENUM('pending', 'in_progress', 'done', 'cancelled') NOT NULL DEFAULT 'pending',
+    assigned_staff_id INT NULL,
+    started_at DATETIME NULL,
+    completed_at DATETIME NULL,
+    completed_by INT NULL,
+    notes VARCHAR(500) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_task_per_day (reservation_id, task_type, task_date),
+    INDEX idx_tasks_date (task_date, status),
+    INDEX idx_tasks_staff (assigned_staff_id, status),
+    FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE CASCADE,
+    FOREIGN KEY (reservation_id) REFERENCES Reservations(reservation_id) ON DELETE SET NULL,
+    FOREIGN KEY (assigned_staff_id) REFERENCES Staff(staff_id) ON DELETE SET NULL,
+    FOREIGN KEY (completed_by) REFERENCES Users(user_id) ON DELETE SET NULL
+);
+
+-- Maintenance on a room, which is blocked in Room_Availability from
+-- start_date until expected_end_date (or until closed, if that is later)
+CREATE TABLE Work_Orders (
+    work_order_id INT AUTO_INCREMENT PRIMARY KEY,
+    room_id INT NOT NULL,
+    priority ENUM('low', 'normal', 'high', 'urgent') NOT NULL DEFAULT 'normal',
+    description TEXT NOT NULL,
+    assigned_staff_id INT NULL,
+    start_date DATE NOT NULL,
+    expected_end_date DATE NOT NULL,
+    status ENUM('open', 'in_progress', 'closed') NOT NULL DEFAULT 'open',
+    resolution TEXT NULL,
+    created_by INT NULL,
+    closed_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at DATETIME NULL,
+    INDEX idx_work_orders_status (status, start_date),
+    INDEX idx_work_orders_room (room_id, status),
+    FOREIGN KEY (room_id) REFERENCES Rooms(room_id) ON DELETE CASCADE,
+    FOREIGN KEY (assigned_staff_id) REFERENCES Staff(staff_id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES Users(user_id) ON DELETE SET NULL,
+    FOREIGN KEY (closed_by) REFERENCES Users(user_id) ON DELETE SET NULL
+);
+
+INSERT INTO Users (email, password_hash, email_verified, role) VALUES
+('tarund2302@gmail.com', '$2a$10$eMWMtRpqmmW.Csp6sSQYSOeZaunKfDdvL0lcXjqQc5pHPZEq5xLpm', TRUE, 'guest'),
+('admin@gmail.com', '$2a$10$wMPF8JFdm3cSej97z3k92.X9fykHqN//e87wMC.9bsmlm7r6gtpJ.', TRUE, 'admin');
+
+INSERT INTO Loyalty_Tiers (name, min_points, earn_multiplier, benefits) VALUES
+('Member', 0, 1.00, 'Member-only rates'),
+('Silver', 2500, 1.25, 'Late checkout on request; welcome drink'),
+('Gold', 10000, 1.50, 'Guaranteed late checkout; room upgrade when available'),
+('Platinum', 25000, 2.00, 'Suite upgrade when available; free breakfast; 48-hour availability guarantee');
+
+INSERT INTO Cancellation_Policies (name, free_until_days, cancel_penalty, no_show_penalty, description) VALUES
+('Flexible', 1, 'first_night', 'first_night', 'Free cancellation until the day before arrival'),
+('Moderate', 7, 'first_night', 'full_stay', 'Free cancellation until 7 days before arrival'),
+('Non-refundable', NULL, 'full_stay', 'full_stay', 'No refund on cancellation');
+
+INSERT INTO Business_Days (business_date) VALUES (CURDATE());
+
+INSERT INTO Overbooking_Allowances (room_type, percent) VALUES
+('Single', 0), ('Double', 0), ('Suite', 0), ('Deluxe', 0);
 
 INSERT INTO Staff (first_name, last_name, email, role) VALUES
 ('Alice', 'Smith', 'alice@gmail.com', 'Housekeeping'),
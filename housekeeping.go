@@ -0,0 +1,508 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rooms.housekeeping_status values. A departure or stayover leaves the room
+// dirty, cleaning makes it clean, and a supervisor's inspection makes it
+// inspected, ready for the next arrival.
+const (
+	roomDirty     = "dirty"
+	roomClean     = "clean"
+	roomInspected = "inspected"
+)
+
+// Housekeeping_Tasks.task_type values.
+const (
+	taskDeparture = "departure"
+	taskStayover  = "stayover"
+)
+
+// Housekeeping_Tasks.status values.
+const (
+	taskPending    = "pending"
+	taskInProgress = "in_progress"
+	taskDone       = "done"
+	taskCancelled  = "cancelled"
+)
+
+// HousekeepingTask is a row of Housekeeping_Tasks.
+type HousekeepingTask struct {
+	TaskID          int        `json:"task_id"`
+	RoomID          int        `json:"room_id"`
+	RoomNumber      string     `json:"room_number"`
+	ReservationID   *int       `json:"reservation_id,omitempty"`
+	TaskType        string     `json:"task_type"`
+	TaskDate        string     `json:"task_date"`
+	Status          string     `json:"status"`
+	AssignedStaffID *int       `json:"assigned_staff_id,omitempty"`
+	AssignedTo      *string    `json:"assigned_to,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	Notes           *string    `json:"notes,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// initHousekeeping schedules the job creating each morning's stayover tasks
+// on HOUSEKEEPING_STAYOVER_SCHEDULE (default 8am).
+func initHousekeeping() {
+	registerJob("housekeeping-stayovers", "HOUSEKEEPING_STAYOVER_SCHEDULE", "0 8 * * *", func() error {
+		n, err := createStayoverTasks(time.Now())
+		if n > 0 {
+			log.Printf("Created %d stayover housekeeping tasks", n)
+		}
+		return err
+	})
+}
+
+// pickHousekeeper chooses who gets the next task from the housekeepers on
+// shift, keyed by staff_id with their count of open tasks: the least loaded,
+// lowest staff_id first. It reports false if nobody is on shift.
+func pickHousekeeper(load map[int]int) (int, bool) {
+	best, found := 0, false
+	for id, n := range load {
+		if !found || n < load[best] || n == load[best] && id < best {
+			best, found = id, true
+		}
+	}
+	return best, found
+}
+
+// onShiftHousekeepers returns the Housekeeping staff whose shift is under way
+// at now, with their count of open tasks. A shift ending at or before its
+// start time ends the next day, so yesterday's shifts are checked too.
+func onShiftHousekeepers(q queryExecer, now time.Time) (map[int]int, error) {
+	at := now.Format(time.DateTime)
+	rows, err := q.Query(`
+		SELECT DISTINCT s.staff_id,
+		       (SELECT COUNT(*) FROM Housekeeping_Tasks t WHERE t.assigned_staff_id = s.staff_id AND t.status IN (?, ?))
+		FROM Staff s JOIN Staff_Schedule ss ON ss.staff_id = s.staff_id
+		WHERE s.role = 'Housekeeping' AND ss.shift_date IN (?, ?)
+		  AND TIMESTAMP(ss.shift_date, ss.start_time) <= ?
+		  AND TIMESTAMP(ss.shift_date, ss.end_time) + INTERVAL (ss.end_time <= ss.start_time) DAY > ?`,
+		taskPending, taskInProgress, now.AddDate(0, 0, -1).Format(dateLayout), now.Format(dateLayout), at, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	load := map[int]int{}
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		load[id] = n
+	}
+	return load, rows.Err()
+}
+
+// createTask adds a housekeeping task for today, assigned to whoever on shift
+// has the fewest open tasks, and marks the room dirty. It reports false if
+// the reservation already has a task of that type today.
+func createTask(q queryExecer, roomID, reservationID int, taskType string, now time.Time) (bool, error) {
+	load, err := onShiftHousekeepers(q, now)
+	if err != nil {
+		return false, err
+	}
+	var assignee sql.NullInt64
+	if id, ok := pickHousekeeper(load); ok {
+		assignee = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+	result, err := q.Exec(`INSERT IGNORE INTO Housekeeping_Tasks (room_id, reservation_id, task_type, task_date, assigned_staff_id)
+		VALUES (?, ?, ?, ?, ?)`, roomID, reservationID, taskType, now.Format(dateLayout), assignee)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	_, err = q.Exec("UPDATE Rooms SET housekeeping_status = ? WHERE room_id = ?", roomDirty, roomID)
+	return err == nil, err
+}
+
+// createStayoverTasks adds a stayover task for every checked-in guest staying
+// on past today.
+func createStayoverTasks(now time.Time) (int, error) {
+	today := now.Format(dateLayout)
+	rows, err := db.Query("SELECT reservation_id, room_id FROM Reservations WHERE status = 'Checked-in' AND check_in_date < ? AND check_out_date > ?",
+		today, today)
+	if err != nil {
+		return 0, err
+	}
+	type stayover struct{ reservationID, roomID int }
+	var stayovers []stayover
+	for rows.Next() {
+		var s stayover
+		if err := rows.Scan(&s.reservationID, &s.roomID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stayovers = append(stayovers, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, s := range stayovers {
+		created, err := createTask(db, s.roomID, s.reservationID, taskStayover, now)
+		if err != nil {
+			return n, err
+		}
+		if created {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// checkInReservation handles POST /reservations/:id/check-in
+// The room must have been cleaned since its last departure.
+func checkInReservation(c *gin.Context) {
+	now := time.Now()
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking in", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var roomID int
+	var status, roomStatus, cleanliness string
+	var stay stayRange
+	err = tx.QueryRow(`
+		SELECT r.room_id, r.status, r.check_in_date, r.check_out_date, COALESCE(rm.status, 'Available'), rm.housekeeping_status
+		FROM Reservations r JOIN Rooms rm ON rm.room_id = r.room_id
+		WHERE r.reservation_id = ? FOR UPDATE`, c.Param("id")).
+		Scan(&roomID, &status, &stay.CheckIn, &stay.CheckOut, &roomStatus, &cleanliness)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking in", "details": err.Error()})
+		return
+	}
+	today := now.Format(dateLayout)
+	switch {
+	case status != "Pending" && status != "Confirmed":
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending or confirmed reservations can be checked in", "status": status})
+		return
+	case stay.CheckIn.Format(dateLayout) > today || stay.CheckOut.Format(dateLayout) <= today:
+		c.JSON(http.StatusConflict, gin.H{"error": "The reservation is not for today"})
+		return
+	case roomStatus == "Maintenance":
+		c.JSON(http.StatusConflict, gin.H{"error": "The room is under maintenance"})
+		return
+	case cleanliness == roomDirty:
+		c.JSON(http.StatusConflict, gin.H{"error": "The room has not been cleaned yet"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'Checked-in' WHERE reservation_id = ?", c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking in", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("UPDATE Rooms SET status = 'Booked' WHERE room_id = ?", roomID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking in", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking in", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Checked in", "room_id": roomID})
+}
+
+// checkOutReservation handles POST /reservations/:id/check-out
+// The room is released and a departure clean is queued for housekeeping.
+// Nights given up by an early departure are offered to the waitlist.
+func checkOutReservation(c *gin.Context) {
+	now := time.Now()
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking out", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	id, _ := strconv.Atoi(c.Param("id"))
+	var roomID int
+	var status string
+	var stay stayRange
+	err = tx.QueryRow("SELECT room_id, status, check_in_date, check_out_date FROM Reservations WHERE reservation_id = ? FOR UPDATE", id).
+		Scan(&roomID, &status, &stay.CheckIn, &stay.CheckOut)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking out", "details": err.Error()})
+		return
+	}
+	if status != "Checked-in" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only checked-in reservations can be checked out", "status": status})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'Checked-out', checked_out_at = ? WHERE reservation_id = ?", now, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking out", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("UPDATE Rooms SET status = 'Available' WHERE room_id = ? AND status = 'Booked'", roomID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking out", "details": err.Error()})
+		return
+	}
+	// The departure clean replaces any stayover service still to do today.
+	if _, err := tx.Exec("UPDATE Housekeeping_Tasks SET status = ? WHERE reservation_id = ? AND task_type = ? AND status = ?",
+		taskCancelled, id, taskStayover, taskPending); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking out", "details": err.Error()})
+		return
+	}
+	if _, err := createTask(tx, roomID, id, taskDeparture, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating housekeeping task", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking out", "details": err.Error()})
+		return
+	}
+
+	today, _ := time.Parse(dateLayout, now.Format(dateLayout))
+	if today.Before(stay.CheckOut) {
+		releaseToWaitlist(roomID, stayRange{CheckIn: today, CheckOut: stay.CheckOut})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Checked out", "room_id": roomID})
+}
+
+// housekeepingTaskQuery selects the columns scanned by scanHousekeepingTask.
+const housekeepingTaskQuery = `
+	SELECT t.task_id, t.room_id, rm.room_number, t.reservation_id, t.task_type, t.task_date, t.status,
+	       t.assigned_staff_id, s.first_name, t.started_at, t.completed_at, t.notes, t.created_at
+	FROM Housekeeping_Tasks t
+	JOIN Rooms rm ON rm.room_id = t.room_id
+	LEFT JOIN Staff s ON s.staff_id = t.assigned_staff_id`
+
+func scanHousekeepingTask(row interface{ Scan(...interface{}) error }) (HousekeepingTask, error) {
+	var t HousekeepingTask
+	var day time.Time
+	err := row.Scan(&t.TaskID, &t.RoomID, &t.RoomNumber, &t.ReservationID, &t.TaskType, &day, &t.Status,
+		&t.AssignedStaffID, &t.AssignedTo, &t.StartedAt, &t.CompletedAt, &t.Notes, &t.CreatedAt)
+	t.TaskDate = day.Format(dateLayout)
+	return t, err
+}
+
+// getHousekeepingTasks handles GET /housekeeping/tasks
+// ?date= defaults to today; ?staff_id= and ?status= narrow the list, so a
+// tablet can show one housekeeper's open work.
+func getHousekeepingTasks(c *gin.Context) {
+	date := c.DefaultQuery("date", time.Now().Format(dateLayout))
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be a YYYY-MM-DD date"})
+		return
+	}
+	query := housekeepingTaskQuery + " WHERE t.task_date = ?"
+	args := []interface{}{date}
+	if v := c.Query("staff_id"); v != "" {
+		query += " AND t.assigned_staff_id = ?"
+		args = append(args, v)
+	}
+	if v := c.Query("status"); v != "" {
+		query += " AND t.status = ?"
+		args = append(args, v)
+	}
+	rows, err := db.Query(query+" ORDER BY t.task_type, rm.room_number", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching tasks", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	tasks := []HousekeepingTask{}
+	for rows.Next() {
+		t, err := scanHousekeepingTask(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning task", "details": err.Error()})
+			return
+		}
+		tasks = append(tasks, t)
+	}
+	c.JSON(http.StatusOK, tasks)
+}
+
+// assignHousekeepingTask handles PUT /housekeeping/tasks/:id/assignment
+// Reassigns a task to another member of the Housekeeping staff.
+func assignHousekeepingTask(c *gin.Context) {
+	var req struct {
+		StaffID int `json:"staff_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "staff_id is required"})
+		return
+	}
+	var role string
+	err := db.QueryRow("SELECT role FROM Staff WHERE staff_id = ?", req.StaffID).Scan(&role)
+	if err == sql.ErrNoRows || err == nil && role != "Housekeeping" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "staff_id must be a member of the Housekeeping staff"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error assigning task", "details": err.Error()})
+		return
+	}
+
+	result, err := db.Exec("UPDATE Housekeeping_Tasks SET assigned_staff_id = ? WHERE task_id = ? AND status IN (?, ?)",
+		req.StaffID, c.Param("id"), taskPending, taskInProgress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error assigning task", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Open task not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Task assigned"})
+}
+
+// startHousekeepingTask handles POST /housekeeping/tasks/:id/start
+func startHousekeepingTask(c *gin.Context) {
+	result, err := db.Exec("UPDATE Housekeeping_Tasks SET status = ?, started_at = ? WHERE task_id = ? AND status = ?",
+		taskInProgress, time.Now(), c.Param("id"), taskPending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting task", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending tasks can be started"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Task started"})
+}
+
+// completeHousekeepingTask handles POST /housekeeping/tasks/:id/complete
+// The room becomes clean once it has no other open tasks.
+func completeHousekeepingTask(c *gin.Context) {
+	var req struct {
+		Notes string `json:"notes"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error completing task", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var roomID int
+	var status string
+	err = tx.QueryRow("SELECT room_id, status FROM Housekeeping_Tasks WHERE task_id = ? FOR UPDATE", c.Param("id")).Scan(&roomID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error completing task", "details": err.Error()})
+		return
+	}
+	if status != taskPending && status != taskInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "The task is already " + status})
+		return
+	}
+
+	notes := sql.NullString{String: req.Notes, Valid: req.Notes != ""}
+	if _, err := tx.Exec("UPDATE Housekeeping_Tasks SET status = ?, completed_at = ?, completed_by = ?, notes = COALESCE(?, notes) WHERE task_id = ?",
+		taskDone, time.Now(), c.GetInt("user_id"), notes, c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error completing task", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec(`UPDATE Rooms SET housekeeping_status = ? WHERE room_id = ? AND housekeeping_status = ?
+		AND NOT EXISTS (SELECT 1 FROM Housekeeping_Tasks WHERE room_id = ? AND status IN (?, ?))`,
+		roomClean, roomID, roomDirty, roomID, taskPending, taskInProgress); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error completing task", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error completing task", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Task completed"})
+}
+
+// inspectRoom handles POST /housekeeping/rooms/:id/inspect
+// Signs off a cleaned room as ready for arrivals.
+func inspectRoom(c *gin.Context) {
+	var cleanliness string
+	err := db.QueryRow("SELECT housekeeping_status FROM Rooms WHERE room_id = ?", c.Param("id")).Scan(&cleanliness)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting room", "details": err.Error()})
+		return
+	}
+	if cleanliness != roomClean {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only clean rooms can be inspected", "housekeeping_status": cleanliness})
+		return
+	}
+	if _, err := db.Exec("UPDATE Rooms SET housekeeping_status = ? WHERE room_id = ? AND housekeeping_status = ?",
+		roomInspected, c.Param("id"), roomClean); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error inspecting room", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Room inspected"})
+}
+
+// getHousekeepingRooms handles GET /housekeeping/rooms
+// Lists every room's occupancy and housekeeping status with its open tasks.
+func getHousekeepingRooms(c *gin.Context) {
+	query := `
+		SELECT rm.room_id, rm.room_number, rm.room_type, COALESCE(rm.status, 'Available'), rm.housekeeping_status,
+		       (SELECT COUNT(*) FROM Housekeeping_Tasks t WHERE t.room_id = rm.room_id AND t.status IN (?, ?))
+		FROM Rooms rm`
+	args := []interface{}{taskPending, taskInProgress}
+	if v := c.Query("housekeeping_status"); v != "" {
+		query += " WHERE rm.housekeeping_status = ?"
+		args = append(args, v)
+	}
+	rows, err := db.Query(query+" ORDER BY rm.room_number", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching rooms", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type housekeepingRoom struct {
+		RoomID             int    `json:"room_id"`
+		RoomNumber         string `json:"room_number"`
+		RoomType           string `json:"room_type"`
+		Status             string `json:"status"`
+		HousekeepingStatus string `json:"housekeeping_status"`
+		OpenTasks          int    `json:"open_tasks"`
+	}
+	rooms := []housekeepingRoom{}
+	for rows.Next() {
+		var r housekeepingRoom
+		if err := rows.Scan(&r.RoomID, &r.RoomNumber, &r.RoomType, &r.Status, &r.HousekeepingStatus, &r.OpenTasks); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning room", "details": err.Error()})
+			return
+		}
+		rooms = append(rooms, r)
+	}
+	c.JSON(http.StatusOK, rooms)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestPickHousekeeper(t *testing.T) {
+	tests := []struct {
+		name string
+		load map[int]int
+		want int
+		ok   bool
+	}{
+		{"nobody on shift", map[int]int{}, 0, false},
+		{"least loaded", map[int]int{1: 3, 4: 1, 6: 2}, 4, true},
+		{"tie goes to lowest id", map[int]int{7: 2, 3: 2, 5: 4}, 3, true},
+	}
+	for _, test := range tests {
+		got, ok := pickHousekeeper(test.load)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: expected %d, %v, got %d, %v", test.name, test.want, test.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Job_Runs.status values.
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// scheduledJob is background work run on a cron schedule.
+type scheduledJob struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	schedule cronSchedule
+	fn       func() error
+}
+
+var (
+	jobsMu sync.Mutex
+	// jobs is every enabled job, keyed by name.
+	jobs = map[string]*scheduledJob{}
+	// jobHolder identifies this process in Job_Leases and Job_Runs.
+	jobHolder string
+)
+
+// registerJob adds a job run on the schedule in envVar (def if unset). The
+// value is a cron expression, or a Go duration as accepted before the
+// scheduler existed; "0" or "off" disables the job. Jobs start running once
+// startScheduler is called.
+func registerJob(name, envVar, def string, fn func() error) {
+	spec := def
+	if v := os.Getenv(envVar); v != "" {
+		spec = v
+	}
+	if spec == "0" || spec == "off" {
+		log.Printf("Job %s is disabled", name)
+		return
+	}
+	if d, err := time.ParseDuration(spec); err == nil {
+		spec = "@every " + d.String()
+	}
+	sched, err := parseCron(spec)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", envVar, err)
+	}
+	if sched.next(time.Now()).IsZero() {
+		log.Fatalf("Invalid %s: %q never fires", envVar, spec)
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	jobs[name] = &scheduledJob{Name: name, Schedule: spec, schedule: sched, fn: fn}
+}
+
+// startScheduler runs every registered job on its schedule. Replicas share
+// Job_Leases, so each scheduled run happens on only one of them.
+func startScheduler() {
+	host, _ := os.Hostname()
+	jobHolder = fmt.Sprintf("%s-%d", host, os.Getpid())
+	// The random suffix tells apart replicas that share a hostname and pid,
+	// as containers often do; without one the host and pid must do.
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Error generating job holder suffix, using %s: %v", jobHolder, err)
+	} else {
+		jobHolder += "-" + hex.EncodeToString(buf)
+	}
+
+	registerJob("job-history-prune", "JOB_HISTORY_PRUNE_SCHEDULE", "30 4 * * *", func() error {
+		_, err := db.Exec("DELETE FROM Job_Runs WHERE started_at < ?", time.Now().AddDate(0, 0, -envInt("JOB_HISTORY_DAYS", 30)))
+		return err
+	})
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, job := range jobs {
+		if _, err := db.Exec("INSERT IGNORE INTO Job_Leases (job_name) VALUES (?)", job.Name); err != nil {
+			log.Fatalf("Error registering job %s: %v", job.Name, err)
+		}
+		go job.loop()
+	}
+}
+
+// loop sleeps until each scheduled time and runs the job if this replica
+// wins the lease for that time.
+func (j *scheduledJob) loop() {
+	for {
+		at := j.schedule.next(time.Now())
+		time.Sleep(time.Until(at))
+		if _, err := j.run(at, false); err != nil {
+			log.Printf("Error running %s: %v", j.Name, err)
+		}
+	}
+}
+
+// leaseUntil is when the lease for a run for slot expires: when the next
+// slot is due, so a replica that dies mid-run costs the job no more than
+// that slot. A manual run holds it for one interval of the schedule.
+func (j *scheduledJob) leaseUntil(slot time.Time, manual bool) time.Time {
+	if manual {
+		return slot.Add(j.schedule.interval(slot))
+	}
+	return j.schedule.next(slot)
+}
+
+// acquireLease claims the run scheduled for slot, holding the lease until
+// until. It fails if another replica holds an unexpired lease or has
+// already run this slot. A manual run only needs the lease and leaves the
+// schedule's slots to run as usual.
+func acquireLease(name string, slot, until time.Time, manual bool) (bool, error) {
+	now := time.Now()
+	var result sql.Result
+	var err error
+	if manual {
+		result, err = db.Exec(`
+			UPDATE Job_Leases SET holder = ?, lease_until = ?
+			WHERE job_name = ? AND (lease_until IS NULL OR lease_until <= ?)`,
+			jobHolder, until, name, now)
+	} else {
+		// Job_Leases.last_slot has whole-second precision.
+		slot = slot.Truncate(time.Second)
+		result, err = db.Exec(`
+			UPDATE Job_Leases SET holder = ?, lease_until = ?, last_slot = ?
+			WHERE job_name = ? AND (lease_until IS NULL OR lease_until <= ?) AND (last_slot IS NULL OR last_slot < ?)`,
+			jobHolder, until, slot, name, now, slot)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// run executes the job for slot if the lease can be taken, recording the run
+// in Job_Runs. A manual run is recorded as scheduled for slot but does not
+// use up the slot. It reports whether the job ran.
+func (j *scheduledJob) run(slot time.Time, manual bool) (bool, error) {
+	ok, err := acquireLease(j.Name, slot, j.leaseUntil(slot, manual), manual)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer func() {
+		if _, err := db.Exec("UPDATE Job_Leases SET lease_until = NULL WHERE job_name = ? AND holder = ?", j.Name, jobHolder); err != nil {
+			log.Printf("Error releasing lease for %s: %v", j.Name, err)
+		}
+	}()
+
+	result, err := db.Exec("INSERT INTO Job_Runs (job_name, holder, scheduled_for, status) VALUES (?, ?, ?, ?)",
+		j.Name, jobHolder, slot, jobRunning)
+	if err != nil {
+		return false, err
+	}
+	runID, _ := result.LastInsertId()
+
+	runErr := j.safeRun()
+	status, errText := jobSucceeded, sql.NullString{}
+	if runErr != nil {
+		status, errText = jobFailed, sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	if _, err := db.Exec("UPDATE Job_Runs SET status = ?, error = ?, finished_at = ? WHERE run_id = ?",
+		status, errText, time.Now(), runID); err != nil {
+		log.Printf("Error recording run of %s: %v", j.Name, err)
+	}
+	return true, runErr
+}
+
+// safeRun calls the job, turning a panic into an error so one bad run does
+// not stop the scheduler.
+func (j *scheduledJob) safeRun() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.fn()
+}
+
+// JobRun is a row of Job_Runs.
+type JobRun struct {
+	RunID        int        `json:"run_id"`
+	JobName      string     `json:"job_name"`
+	Holder       string     `json:"holder"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	Status       string     `json:"status"`
+	Error        *string    `json:"error,omitempty"`
+}
+
+// jobRunColumns are the Job_Runs columns scanned by scanJobRun.
+const jobRunColumns = "run_id, job_name, holder, scheduled_for, started_at, finished_at, status, error"
+
+func scanJobRun(row interface{ Scan(...interface{}) error }) (JobRun, error) {
+	var r JobRun
+	err := row.Scan(&r.RunID, &r.JobName, &r.Holder, &r.ScheduledFor, &r.StartedAt, &r.FinishedAt, &r.Status, &r.Error)
+	return r, err
+}
+
+// getJobs handles GET /jobs
+// Lists each job with its schedule, next run, current lease and last run.
+func getJobs(c *gin.Context) {
+	jobsMu.Lock()
+	list := make([]*scheduledJob, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, job)
+	}
+	jobsMu.Unlock()
+
+	type jobStatus struct {
+		*scheduledJob
+		NextRun     time.Time  `json:"next_run"`
+		LeaseHolder *string    `json:"lease_holder,omitempty"`
+		LeaseUntil  *time.Time `json:"lease_until,omitempty"`
+		LastRun     *JobRun    `json:"last_run,omitempty"`
+	}
+	statuses := []jobStatus{}
+	for _, job := range list {
+		s := jobStatus{scheduledJob: job, NextRun: job.schedule.next(time.Now())}
+		err := db.QueryRow("SELECT holder, lease_until FROM Job_Leases WHERE job_name = ?", job.Name).Scan(&s.LeaseHolder, &s.LeaseUntil)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching job status", "details": err.Error()})
+			return
+		}
+		if s.LeaseUntil == nil {
+			s.LeaseHolder = nil
+		}
+		last, err := scanJobRun(db.QueryRow("SELECT "+jobRunColumns+" FROM Job_Runs WHERE job_name = ? ORDER BY run_id DESC LIMIT 1", job.Name))
+		if err == nil {
+			s.LastRun = &last
+		} else if err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching job status", "details": err.Error()})
+			return
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	c.JSON(http.StatusOK, statuses)
+}
+
+// getJobRuns handles GET /jobs/:name/runs
+// Returns the most recent runs first; ?limit= defaults to 50.
+func getJobRuns(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	rows, err := db.Query("SELECT "+jobRunColumns+" FROM Job_Runs WHERE job_name = ? ORDER BY run_id DESC LIMIT ?", c.Param("name"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching job runs", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		r, err := scanJobRun(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning job run", "details": err.Error()})
+			return
+		}
+		runs = append(runs, r)
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// runJobNow handles POST /jobs/:name/run
+// Runs the job immediately, still under its lease so it cannot overlap a
+// scheduled or manual run on any replica; 409 while one holds the lease.
+func runJobNow(c *gin.Context) {
+	jobsMu.Lock()
+	job, ok := jobs[c.Param("name")]
+	jobsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	ran, err := job.run(time.Now(), true)
+	if !ran && err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The job is already running"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Job failed", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Job completed"})
+}
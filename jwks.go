@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is one asymmetric key pair used to sign and verify tokens.
+// The kid is the key's file name without the .pem extension.
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+// keyRing holds the active signing key, the next key once it has been
+// generated, and every older key that may still have unexpired tokens in
+// circulation.
+type keyRing struct {
+	mu       sync.RWMutex
+	dir      string
+	alg      string
+	rotation time.Duration
+	keys     []*signingKey // newest first
+	signing  *signingKey
+}
+
+// jwksMaxAge is how long verifiers may cache GET /.well-known/jwks.json.
+const jwksMaxAge = 5 * time.Minute
+
+// keyPublishLead is how long a new key is listed in the JWKS before it signs
+// anything, so verifiers holding a cached copy have picked it up by then.
+const keyPublishLead = 2 * jwksMaxAge
+
+var jwtKeys = &keyRing{}
+
+// initKeyRing loads signing keys from JWT_KEY_DIR, generating the first key
+// if the directory is empty, and starts the rotation loop.
+func initKeyRing() {
+	jwtKeys.dir = os.Getenv("JWT_KEY_DIR")
+	if jwtKeys.dir == "" {
+		jwtKeys.dir = "keys"
+	}
+	jwtKeys.alg = os.Getenv("JWT_SIGNING_ALG")
+	if jwtKeys.alg == "" {
+		jwtKeys.alg = jwt.SigningMethodEdDSA.Alg()
+	}
+	if jwtKeys.alg != jwt.SigningMethodEdDSA.Alg() && jwtKeys.alg != jwt.SigningMethodRS256.Alg() {
+		log.Fatal("JWT_SIGNING_ALG must be EdDSA or RS256")
+	}
+	jwtKeys.rotation = 30 * 24 * time.Hour
+	if v := os.Getenv("JWT_KEY_ROTATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= tokenTTL {
+			log.Fatal("JWT_KEY_ROTATION must be a duration longer than the token lifetime")
+		}
+		jwtKeys.rotation = d
+	}
+
+	if err := os.MkdirAll(jwtKeys.dir, 0700); err != nil {
+		log.Fatal("Error creating JWT_KEY_DIR:", err)
+	}
+	if err := jwtKeys.rotateIfDue(time.Now()); err != nil {
+		log.Fatal("Error loading signing keys:", err)
+	}
+
+	go func() {
+		// Ticking every keyPublishLead starts a new key signing soon after it
+		// has been published for long enough.
+		for now := range time.Tick(keyPublishLead) {
+			if err := jwtKeys.rotateIfDue(now); err != nil {
+				log.Println("Error rotating signing keys:", err)
+			}
+		}
+	}()
+}
+
+// signsFrom is when the key starts signing tokens: keyPublishLead after it
+// was generated.
+func (k *signingKey) signsFrom() time.Time {
+	return k.createdAt.Add(keyPublishLead)
+}
+
+// rotateIfDue reloads the key directory (picking up keys written by other
+// replicas) and generates the next key keyPublishLead before the newest one
+// is due to be replaced, so it is published before it signs anything.
+func (r *keyRing) rotateIfDue(now time.Time) error {
+	keys, err := loadSigningKeys(r.dir)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 || now.Sub(keys[0].createdAt) >= r.rotation-keyPublishLead {
+		key, err := generateSigningKey(r.dir, r.alg, now)
+		if err != nil {
+			return err
+		}
+		log.Printf("Generated new %s signing key %s", key.method.Alg(), key.kid)
+		keys = append([]*signingKey{key}, keys...)
+	}
+
+	// The newest published key signs. The very first key signs at once, as
+	// no verifier can hold tokens from before it.
+	signing := keys[len(keys)-1]
+	for _, k := range keys {
+		if !now.Before(k.signsFrom()) {
+			signing = k
+			break
+		}
+	}
+
+	// A key is retired once a newer key has been signing for longer than a
+	// token lives, since nothing it signed can still be valid.
+	kept := keys[:1]
+	for i := 1; i < len(keys); i++ {
+		if now.Sub(keys[i-1].signsFrom()) < tokenTTL {
+			kept = append(kept, keys[i])
+		}
+	}
+
+	r.mu.Lock()
+	r.keys = kept
+	r.signing = signing
+	r.mu.Unlock()
+	return nil
+}
+
+// active returns the key new tokens are signed with.
+func (r *keyRing) active() *signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.signing
+}
+
+// lookup returns the key with the given kid, if it has not been retired.
+func (r *keyRing) lookup(kid string) *signingKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.kid == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// loadSigningKeys parses every PKCS#8 PEM file in dir, newest first.
+func loadSigningKeys(dir string) ([]*signingKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*signingKey
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(keyPEM)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM block found", path)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		key := &signingKey{
+			kid:       strings.TrimSuffix(filepath.Base(path), ".pem"),
+			createdAt: info.ModTime(),
+		}
+		switch priv := parsed.(type) {
+		case *rsa.PrivateKey:
+			key.method, key.private = jwt.SigningMethodRS256, priv
+		case ed25519.PrivateKey:
+			key.method, key.private = jwt.SigningMethodEdDSA, priv
+		default:
+			return nil, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.After(keys[j].createdAt) })
+	return keys, nil
+}
+
+// generateSigningKey creates a new key pair and writes the private key to dir.
+func generateSigningKey(dir, alg string, now time.Time) (*signingKey, error) {
+	key := &signingKey{createdAt: now}
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key.method, key.private = jwt.SigningMethodRS256, priv
+	default:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.method, key.private = jwt.SigningMethodEdDSA, priv
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	key.kid = now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, key.kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	// The file's modification time is the key's creation time on reload.
+	if err := os.Chtimes(path, now, now); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// jwk renders the public half of the key as a JSON Web Key.
+func (k *signingKey) jwk() gin.H {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		return gin.H{
+			"kty": "RSA",
+			"kid": k.kid,
+			"use": "sig",
+			"alg": k.method.Alg(),
+			"n":   b64(pub.N.Bytes()),
+			"e":   b64(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return gin.H{
+			"kty": "OKP",
+			"kid": k.kid,
+			"use": "sig",
+			"alg": k.method.Alg(),
+			"crv": "Ed25519",
+			"x":   b64(pub),
+		}
+	}
+	return nil
+}
+
+// getJWKS handles GET /.well-known/jwks.json
+func getJWKS(c *gin.Context) {
+	jwtKeys.mu.RLock()
+	keys := make([]gin.H, 0, len(jwtKeys.keys))
+	for _, k := range jwtKeys.keys {
+		keys = append(keys, k.jwk())
+	}
+	jwtKeys.mu.RUnlock()
+
+	// Verifiers poll this endpoint; a short cache keeps rotations visible,
+	// and keyPublishLead outlasts it.
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge/time.Second)))
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
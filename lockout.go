@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scopes tracked in Login_Failures.
+const (
+	lockoutScopeAccount = "account"
+	lockoutScopeIP      = "ip"
+)
+
+// lockoutPolicy controls how many failed logins are tolerated before a
+// temporary lockout, and how long lockouts last.
+type lockoutPolicy struct {
+	maxAccountFailures int
+	maxIPFailures      int
+	baseLockout        time.Duration
+	maxLockout         time.Duration
+	// failureWindow is how long a quiet period must last before counters and
+	// the backoff level start again from zero.
+	failureWindow time.Duration
+}
+
+var loginLockout = lockoutPolicy{
+	maxAccountFailures: 5,
+	maxIPFailures:      20,
+	baseLockout:        time.Minute,
+	maxLockout:         24 * time.Hour,
+	failureWindow:      24 * time.Hour,
+}
+
+// initLockoutPolicy reads the lockout settings from the environment.
+func initLockoutPolicy() {
+	loginLockout.maxAccountFailures = envInt("LOGIN_MAX_FAILURES", loginLockout.maxAccountFailures)
+	loginLockout.maxIPFailures = envInt("LOGIN_MAX_FAILURES_PER_IP", loginLockout.maxIPFailures)
+	if v := os.Getenv("LOGIN_LOCKOUT_BASE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatal("LOGIN_LOCKOUT_BASE must be a positive duration")
+		}
+		loginLockout.baseLockout = d
+	}
+}
+
+// envInt returns the positive integer in the named variable, or def.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Fatalf("%s must be a positive integer", name)
+	}
+	return n
+}
+
+// lockoutDuration is the exponential backoff for the nth lockout: the base
+// duration doubled for every earlier lockout, capped at maxLockout.
+func (p lockoutPolicy) lockoutDuration(lockouts int) time.Duration {
+	d := p.baseLockout
+	for i := 1; i < lockouts && d < p.maxLockout; i++ {
+		d *= 2
+	}
+	if d > p.maxLockout {
+		d = p.maxLockout
+	}
+	return d
+}
+
+// lockedUntil returns when the lockout on subject ends, or the zero time if
+// it is not locked.
+func lockedUntil(scope, subject string, now time.Time) (time.Time, error) {
+	var until sql.NullTime
+	err := db.QueryRow("SELECT locked_until FROM Login_Failures WHERE scope = ? AND subject = ?", scope, subject).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !until.Valid || !until.Time.After(now) {
+		return time.Time{}, nil
+	}
+	return until.Time, nil
+}
+
+// recordLoginFailure counts a failed attempt against subject and locks it out
+// once the limit for the scope is reached. userID is only used for auditing.
+func recordLoginFailure(scope, subject string, userID int, ip string, now time.Time) error {
+	windowStart := now.Add(-loginLockout.failureWindow)
+	_, err := db.Exec(`
+		INSERT INTO Login_Failures (scope, subject, failed_count, last_failed_at) VALUES (?, ?, 1, ?)
+		ON DUPLICATE KEY UPDATE
+			lockouts = IF(last_failed_at < ?, 0, lockouts),
+			failed_count = IF(last_failed_at < ?, 1, failed_count + 1),
+			last_failed_at = VALUES(last_failed_at)`,
+		scope, subject, now, windowStart, windowStart)
+	if err != nil {
+		return err
+	}
+
+	var failedCount, lockouts int
+	err = db.QueryRow("SELECT failed_count, lockouts FROM Login_Failures WHERE scope = ? AND subject = ?", scope, subject).
+		Scan(&failedCount, &lockouts)
+	if err != nil {
+		return err
+	}
+
+	limit := loginLockout.maxAccountFailures
+	if scope == lockoutScopeIP {
+		limit = loginLockout.maxIPFailures
+	}
+	if failedCount < limit {
+		return nil
+	}
+
+	lockouts++
+	until := now.Add(loginLockout.lockoutDuration(lockouts))
+	_, err = db.Exec("UPDATE Login_Failures SET failed_count = 0, lockouts = ?, locked_until = ? WHERE scope = ? AND subject = ?",
+		lockouts, until, scope, subject)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(auditLoginLockout, userID, subject, ip,
+		fmt.Sprintf("%s locked until %s after %d failed logins (lockout #%d)", scope, until.UTC().Format(time.RFC3339), failedCount, lockouts))
+	return nil
+}
+
+// clearLoginFailures resets the counters for subject after a successful login.
+func clearLoginFailures(scope, subject string) error {
+	_, err := db.Exec("DELETE FROM Login_Failures WHERE scope = ? AND subject = ?", scope, subject)
+	return err
+}
+
+// loginLockedUntil returns the later of the account and IP lockouts for a
+// login attempt, or the zero time if neither is locked.
+func loginLockedUntil(email, ip string, now time.Time) (time.Time, error) {
+	accountUntil, err := lockedUntil(lockoutScopeAccount, strings.ToLower(email), now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ipUntil, err := lockedUntil(lockoutScopeIP, ip, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ipUntil.After(accountUntil) {
+		return ipUntil, nil
+	}
+	return accountUntil, nil
+}
+
+// recordFailedLogin counts a failed login against both the account and the
+// client IP. Errors are logged; a failure to count must not leak to the
+// client as anything other than "Invalid credentials".
+func recordFailedLogin(email string, userID int, ip string, now time.Time) {
+	if err := recordLoginFailure(lockoutScopeAccount, strings.ToLower(email), userID, ip, now); err != nil {
+		log.Println("Error recording failed login for account:", err)
+	}
+	if err := recordLoginFailure(lockoutScopeIP, ip, userID, ip, now); err != nil {
+		log.Println("Error recording failed login for IP:", err)
+	}
+}
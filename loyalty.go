@@ -0,0 +1,530 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// loyaltyPaymentMethod is the Payments.payment_method for points redemption.
+const loyaltyPaymentMethod = "Loyalty Points"
+
+// Entry types stored in Loyalty_Ledger.entry_type.
+const (
+	loyaltyEntryStay       = "stay"
+	loyaltyEntryPayment    = "payment"
+	loyaltyEntryRedemption = "redemption"
+	loyaltyEntryAdjustment = "adjustment"
+	loyaltyEntryReversal   = "reversal"
+)
+
+// loyaltyPolicy holds the earn and burn rates, set by initLoyaltyPolicy.
+type loyaltyPolicy struct {
+	pointsPerStay   int // flat points per completed stay
+	pointsPerDollar int // points earned per whole dollar paid, before the tier multiplier
+	redeemPerDollar int // points spent per dollar when paying with points
+}
+
+var loyaltyRules = loyaltyPolicy{pointsPerStay: 500, pointsPerDollar: 10, redeemPerDollar: 100}
+
+// errInsufficientPoints is returned when a redemption exceeds the balance.
+var errInsufficientPoints = errors.New("insufficient loyalty points")
+
+// initLoyaltyPolicy reads LOYALTY_POINTS_PER_STAY, LOYALTY_POINTS_PER_DOLLAR
+// and LOYALTY_REDEEM_POINTS_PER_DOLLAR, and starts the accrual job.
+func initLoyaltyPolicy() {
+	loyaltyRules.pointsPerStay = envInt("LOYALTY_POINTS_PER_STAY", loyaltyRules.pointsPerStay)
+	loyaltyRules.pointsPerDollar = envInt("LOYALTY_POINTS_PER_DOLLAR", loyaltyRules.pointsPerDollar)
+	loyaltyRules.redeemPerDollar = envInt("LOYALTY_REDEEM_POINTS_PER_DOLLAR", loyaltyRules.redeemPerDollar)
+
+	registerJob("loyalty-accrual", "LOYALTY_ACCRUAL_INTERVAL", "*/15 * * * *", func() error {
+		_, err := accrueLoyaltyPoints()
+		return err
+	})
+}
+
+// LoyaltyTier is a row of Loyalty_Tiers. Tiers are reached by lifetime points
+// earned, so redeeming never drops a member to a lower tier.
+type LoyaltyTier struct {
+	TierID         int     `json:"tier_id"`
+	Name           string  `json:"name"`
+	MinPoints      int     `json:"min_points"`
+	EarnMultiplier float64 `json:"earn_multiplier"`
+	Benefits       string  `json:"benefits"`
+}
+
+// LoyaltyEntry is a row of Loyalty_Ledger. Entries are never changed once
+// written; corrections are made with adjustment entries.
+type LoyaltyEntry struct {
+	EntryID       int       `json:"entry_id"`
+	EntryType     string    `json:"entry_type"`
+	Points        int       `json:"points"`
+	ReservationID *int      `json:"reservation_id,omitempty"`
+	PaymentID     *int      `json:"payment_id,omitempty"`
+	Description   string    `json:"description"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LoyaltyAccount summarises a user's standing in the programme.
+type LoyaltyAccount struct {
+	Balance        int            `json:"balance"`
+	LifetimePoints int            `json:"lifetime_points"`
+	Tier           *LoyaltyTier   `json:"tier"`
+	NextTier       *LoyaltyTier   `json:"next_tier,omitempty"`
+	Entries        []LoyaltyEntry `json:"entries,omitempty"`
+}
+
+// queryExecer is satisfied by *sql.DB and *sql.Tx.
+type queryExecer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// loadLoyaltyTiers returns every tier, lowest first.
+func loadLoyaltyTiers() ([]LoyaltyTier, error) {
+	rows, err := db.Query("SELECT tier_id, name, min_points, earn_multiplier, COALESCE(benefits, '') FROM Loyalty_Tiers ORDER BY min_points")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := []LoyaltyTier{}
+	for rows.Next() {
+		var t LoyaltyTier
+		if err := rows.Scan(&t.TierID, &t.Name, &t.MinPoints, &t.EarnMultiplier, &t.Benefits); err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, t)
+	}
+	return tiers, rows.Err()
+}
+
+// tierFor returns the highest tier reached with lifetime points, and the one
+// after it (nil at the top). tiers must be sorted lowest first.
+func tierFor(tiers []LoyaltyTier, lifetime int) (current, next *LoyaltyTier) {
+	for i := range tiers {
+		if lifetime >= tiers[i].MinPoints {
+			current = &tiers[i]
+		} else {
+			next = &tiers[i]
+			break
+		}
+	}
+	return current, next
+}
+
+// pointsForPayment is what a completed payment of amount earns at multiplier.
+func pointsForPayment(amount, multiplier float64) int {
+	return int(math.Floor(math.Floor(amount) * float64(loyaltyRules.pointsPerDollar) * multiplier))
+}
+
+// pointsForRedemption is the number of points a payment of amount costs.
+func pointsForRedemption(amount float64) int {
+	return int(math.Ceil(amount * float64(loyaltyRules.redeemPerDollar)))
+}
+
+// loyaltyTotals returns a user's balance and lifetime points earned, net of
+// points taken back from refunded or changed payments.
+func loyaltyTotals(q queryExecer, userID int) (balance, lifetime int, err error) {
+	err = q.QueryRow(`
+		SELECT COALESCE(SUM(points), 0), COALESCE(SUM(CASE WHEN entry_type IN (?, ?, ?) THEN points END), 0)
+		FROM Loyalty_Ledger WHERE user_id = ?`, loyaltyEntryStay, loyaltyEntryPayment, loyaltyEntryReversal, userID).Scan(&balance, &lifetime)
+	return balance, lifetime, err
+}
+
+// paymentSourceKey is the source_key of the points earned by a payment. Each
+// reversal of those points bumps revision, so the payment can earn again
+// once it is completed with its new details.
+func paymentSourceKey(paymentID, revision int) string {
+	if revision == 0 {
+		return fmt.Sprintf("payment:%d", paymentID)
+	}
+	return fmt.Sprintf("payment:%d:%d", paymentID, revision)
+}
+
+// paymentChangeReversal decides whether changing a payment from old to
+// updated (nil when it is deleted) takes back the points old earned, and
+// returns the reason for the ledger, or "" when old's points still stand.
+func paymentChangeReversal(old Payment, updated *Payment) string {
+	switch {
+	case old.PaymentStatus != "Completed":
+		return ""
+	case updated == nil:
+		return "deleted"
+	case updated.PaymentStatus == "Refunded":
+		return "refunded"
+	case updated.PaymentStatus != old.PaymentStatus || updated.Amount != old.Amount || updated.ReservationID != old.ReservationID:
+		return "changed"
+	}
+	return ""
+}
+
+// reversePaymentPoints takes back, inside tx, whatever points a payment has
+// earned and not yet lost. accrueLoyaltyPoints credits it again if it is
+// still completed.
+func reversePaymentPoints(tx *sql.Tx, paymentID int, reason string) error {
+	var userID, reservationID sql.NullInt64
+	var net, revision int
+	err := tx.QueryRow(`
+		SELECT MAX(user_id), MAX(reservation_id), COALESCE(SUM(points), 0), COUNT(CASE WHEN entry_type = ? THEN 1 END)
+		FROM Loyalty_Ledger WHERE payment_id = ? AND entry_type IN (?, ?)`,
+		loyaltyEntryReversal, paymentID, loyaltyEntryPayment, loyaltyEntryReversal).Scan(&userID, &reservationID, &net, &revision)
+	if err != nil || net <= 0 {
+		return err
+	}
+	_, err = addLedgerEntry(tx, int(userID.Int64), loyaltyEntryReversal, -net, reservationID, paymentID,
+		fmt.Sprintf("Points for payment %d taken back: payment %s", paymentID, reason), fmt.Sprintf("reversal:%d:%d", paymentID, revision+1))
+	return err
+}
+
+// addLedgerEntry appends an entry. sourceKey identifies the event the points
+// are for ("stay:12", "payment:34"); an event already in the ledger is
+// skipped, which makes accrual safe to repeat. It reports whether the entry
+// was written.
+func addLedgerEntry(q queryExecer, userID int, entryType string, points int, reservationID, paymentID interface{}, description, sourceKey string) (bool, error) {
+	key := sql.NullString{String: sourceKey, Valid: sourceKey != ""}
+	_, err := q.Exec(`
+		INSERT INTO Loyalty_Ledger (user_id, entry_type, points, reservation_id, payment_id, description, source_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, entryType, points, reservationID, paymentID, description, key)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// loadLoyaltyAccount returns the user's balance, tier and (if limit > 0) the
+// most recent ledger entries.
+func loadLoyaltyAccount(userID, limit int) (LoyaltyAccount, error) {
+	var acct LoyaltyAccount
+	var err error
+	acct.Balance, acct.LifetimePoints, err = loyaltyTotals(db, userID)
+	if err != nil {
+		return acct, err
+	}
+	tiers, err := loadLoyaltyTiers()
+	if err != nil {
+		return acct, err
+	}
+	acct.Tier, acct.NextTier = tierFor(tiers, acct.LifetimePoints)
+	if limit <= 0 {
+		return acct, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT entry_id, entry_type, points, reservation_id, payment_id, COALESCE(description, ''), created_at
+		FROM Loyalty_Ledger WHERE user_id = ? ORDER BY entry_id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return acct, err
+	}
+	defer rows.Close()
+	acct.Entries = []LoyaltyEntry{}
+	for rows.Next() {
+		var e LoyaltyEntry
+		if err := rows.Scan(&e.EntryID, &e.EntryType, &e.Points, &e.ReservationID, &e.PaymentID, &e.Description, &e.CreatedAt); err != nil {
+			return acct, err
+		}
+		acct.Entries = append(acct.Entries, e)
+	}
+	return acct, rows.Err()
+}
+
+// accrueLoyaltyPoints credits points for stays checked out at the front desk
+// and completed payments not yet in the ledger. Only guests linked to an
+// account earn points. It returns the number of entries written.
+func accrueLoyaltyPoints() (int, error) {
+	tiers, err := loadLoyaltyTiers()
+	if err != nil {
+		return 0, err
+	}
+	multiplier := func(userID int) (float64, error) {
+		_, lifetime, err := loyaltyTotals(db, userID)
+		if err != nil {
+			return 0, err
+		}
+		if tier, _ := tierFor(tiers, lifetime); tier != nil {
+			return tier.EarnMultiplier, nil
+		}
+		return 1, nil
+	}
+
+	type pending struct {
+		userID, reservationID, paymentID int
+		amount                           float64
+		revision                         int
+	}
+	collect := func(query string, args ...interface{}) ([]pending, error) {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var out []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.userID, &p.reservationID, &p.paymentID, &p.amount, &p.revision); err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+		return out, rows.Err()
+	}
+
+	stays, err := collect(`
+		SELECT g.user_id, r.reservation_id, 0, 0, 0 FROM Reservations r
+		JOIN Guests g ON g.guest_id = r.guest_id
+		WHERE r.status = 'Checked-out' AND r.checked_out_at IS NOT NULL AND g.user_id IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM Loyalty_Ledger l WHERE l.source_key = CONCAT('stay:', r.reservation_id))`)
+	if err != nil {
+		return 0, err
+	}
+	// A payment whose points were reversed after a change has a net of zero
+	// and earns again under its next revision.
+	payments, err := collect(`
+		SELECT g.user_id, r.reservation_id, p.payment_id, p.amount, COUNT(CASE WHEN l.entry_type = ? THEN 1 END)
+		FROM Payments p
+		JOIN Reservations r ON r.reservation_id = p.reservation_id
+		JOIN Guests g ON g.guest_id = r.guest_id
+		LEFT JOIN Loyalty_Ledger l ON l.payment_id = p.payment_id AND l.entry_type IN (?, ?)
+		WHERE p.payment_status = 'Completed' AND p.payment_method <> ? AND g.user_id IS NOT NULL
+		GROUP BY g.user_id, r.reservation_id, p.payment_id, p.amount
+		HAVING COALESCE(SUM(l.points), 0) = 0`,
+		loyaltyEntryReversal, loyaltyEntryPayment, loyaltyEntryReversal, loyaltyPaymentMethod)
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, s := range stays {
+		ok, err := addLedgerEntry(db, s.userID, loyaltyEntryStay, loyaltyRules.pointsPerStay, s.reservationID, nil,
+			fmt.Sprintf("Stay %d completed", s.reservationID), fmt.Sprintf("stay:%d", s.reservationID))
+		if err != nil {
+			return written, err
+		}
+		if ok {
+			written++
+		}
+	}
+	for _, p := range payments {
+		m, err := multiplier(p.userID)
+		if err != nil {
+			return written, err
+		}
+		points := pointsForPayment(p.amount, m)
+		if points <= 0 {
+			continue
+		}
+		ok, err := addLedgerEntry(db, p.userID, loyaltyEntryPayment, points, p.reservationID, p.paymentID,
+			fmt.Sprintf("$%.2f paid for reservation %d", p.amount, p.reservationID), paymentSourceKey(p.paymentID, p.revision))
+		if err != nil {
+			return written, err
+		}
+		if ok {
+			written++
+		}
+	}
+	if written > 0 {
+		log.Printf("Credited %d loyalty ledger entries", written)
+	}
+	return written, nil
+}
+
+// redeemLoyaltyPoints records a points payment inside tx, debiting the owner
+// of the reservation's guest. The user's row is locked so concurrent
+// redemptions cannot overspend the balance.
+func redeemLoyaltyPoints(tx *sql.Tx, userID int, payment *Payment) error {
+	var locked int
+	if err := tx.QueryRow("SELECT user_id FROM Users WHERE user_id = ? FOR UPDATE", userID).Scan(&locked); err != nil {
+		return err
+	}
+	balance, _, err := loyaltyTotals(tx, userID)
+	if err != nil {
+		return err
+	}
+	points := pointsForRedemption(payment.Amount)
+	if points > balance {
+		return errInsufficientPoints
+	}
+
+	result, err := tx.Exec("INSERT INTO Payments (reservation_id, payment_method, payment_status, amount) VALUES (?, ?, 'Completed', ?)",
+		payment.ReservationID, loyaltyPaymentMethod, payment.Amount)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	payment.PaymentID = int(id)
+	payment.PaymentMethod = loyaltyPaymentMethod
+	payment.PaymentStatus = "Completed"
+
+	_, err = addLedgerEntry(tx, userID, loyaltyEntryRedemption, -points, payment.ReservationID, payment.PaymentID,
+		fmt.Sprintf("Redeemed for $%.2f on reservation %d", payment.Amount, payment.ReservationID), fmt.Sprintf("redeem:%d", payment.PaymentID))
+	return err
+}
+
+// createLoyaltyPayment is the createPayment path for points. The caller must
+// own the reservation's guest; staff may redeem on a guest's behalf at the
+// desk.
+func createLoyaltyPayment(c *gin.Context, payment *Payment) {
+	claims := c.MustGet("claims").(*Claims)
+	if payment.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+
+	var owner sql.NullInt64
+	err := db.QueryRow(`SELECT g.user_id FROM Reservations r JOIN Guests g ON g.guest_id = r.guest_id
+		WHERE r.reservation_id = ?`, payment.ReservationID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating payment", "details": err.Error()})
+		return
+	}
+	if !owner.Valid || (!isStaff(c) && int(owner.Int64) != claims.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Loyalty points can only be redeemed by the reservation's account holder"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating payment", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := redeemLoyaltyPoints(tx, int(owner.Int64), payment); err != nil {
+		if err == errInsufficientPoints {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient loyalty points", "points_required": pointsForRedemption(payment.Amount)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating payment", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating payment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"payment": payment, "points_redeemed": pointsForRedemption(payment.Amount)})
+}
+
+// refundLoyaltyPayment credits back the points spent on a points payment that
+// is being deleted, inside the same transaction.
+func refundLoyaltyPayment(tx *sql.Tx, paymentID int) error {
+	var userID, points, reservationID int
+	err := tx.QueryRow("SELECT user_id, points, reservation_id FROM Loyalty_Ledger WHERE source_key = ?",
+		fmt.Sprintf("redeem:%d", paymentID)).Scan(&userID, &points, &reservationID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = addLedgerEntry(tx, userID, loyaltyEntryAdjustment, -points, reservationID, paymentID,
+		fmt.Sprintf("Refund of points payment %d", paymentID), fmt.Sprintf("refund:%d", paymentID))
+	return err
+}
+
+// getMyLoyalty handles GET /loyalty
+func getMyLoyalty(c *gin.Context) {
+	acct, err := loadLoyaltyAccount(c.GetInt("user_id"), 50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching loyalty account", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, acct)
+}
+
+// getUserLoyalty handles GET /loyalty/users/:id
+func getUserLoyalty(c *gin.Context) {
+	var userID int
+	if err := db.QueryRow("SELECT user_id FROM Users WHERE user_id = ?", c.Param("id")).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching loyalty account", "details": err.Error()})
+		}
+		return
+	}
+	acct, err := loadLoyaltyAccount(userID, 50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching loyalty account", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, acct)
+}
+
+// getLoyaltyTiers handles GET /loyalty/tiers
+func getLoyaltyTiers(c *gin.Context) {
+	tiers, err := loadLoyaltyTiers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching loyalty tiers", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tiers)
+}
+
+// createLoyaltyAdjustment handles POST /loyalty/adjustments
+// Staff use adjustments for goodwill credits and corrections, since ledger
+// entries themselves cannot be edited.
+func createLoyaltyAdjustment(c *gin.Context) {
+	var req struct {
+		UserID      int    `json:"user_id"`
+		Points      int    `json:"points"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 || req.Points == 0 || req.Description == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id, a non-zero points value and description are required"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting points", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var locked int
+	err = tx.QueryRow("SELECT user_id FROM Users WHERE user_id = ? FOR UPDATE", req.UserID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting points", "details": err.Error()})
+		return
+	}
+	balance, _, err := loyaltyTotals(tx, req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting points", "details": err.Error()})
+		return
+	}
+	if balance+req.Points < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Adjustment would make the balance negative"})
+		return
+	}
+	if _, err := addLedgerEntry(tx, req.UserID, loyaltyEntryAdjustment, req.Points, nil, nil, req.Description, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting points", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting points", "details": err.Error()})
+		return
+	}
+
+	recordAudit(auditLoyaltyAdjustment, c.GetInt("user_id"), fmt.Sprint(req.UserID), c.ClientIP(),
+		fmt.Sprintf("%+d points: %s", req.Points, req.Description))
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Points adjusted", "balance": balance + req.Points})
+}
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func TestTierFor(t *testing.T) {
+	tiers := []LoyaltyTier{
+		{Name: "Member", MinPoints: 0},
+		{Name: "Silver", MinPoints: 2500},
+		{Name: "Gold", MinPoints: 10000},
+	}
+
+	tests := []struct {
+		lifetime           int
+		wantTier, wantNext string
+	}{
+		{0, "Member", "Silver"},
+		{2499, "Member", "Silver"},
+		{2500, "Silver", "Gold"},
+		{50000, "Gold", ""},
+	}
+	for _, test := range tests {
+		tier, next := tierFor(tiers, test.lifetime)
+		if tier == nil || tier.Name != test.wantTier {
+			t.Errorf("%d points: expected tier %s, got %v", test.lifetime, test.wantTier, tier)
+		}
+		if (next == nil && test.wantNext != "") || (next != nil && next.Name != test.wantNext) {
+			t.Errorf("%d points: expected next tier %q, got %v", test.lifetime, test.wantNext, next)
+		}
+	}
+}
+
+func TestLoyaltyPointRates(t *testing.T) {
+	defer func(saved loyaltyPolicy) { loyaltyRules = saved }(loyaltyRules)
+	loyaltyRules = loyaltyPolicy{pointsPerStay: 500, pointsPerDollar: 10, redeemPerDollar: 100}
+
+	// Cents do not earn points; the multiplier applies to whole dollars.
+	if got := pointsForPayment(199.99, 1.5); got != 2985 {
+		t.Errorf("pointsForPayment(199.99, 1.5) = %d, want 2985", got)
+	}
+	// Redemptions round up so a partial point is never given away.
+	if got := pointsForRedemption(12.345); got != 1235 {
+		t.Errorf("pointsForRedemption(12.345) = %d, want 1235", got)
+	}
+}
+
+func TestPaymentChangeReversal(t *testing.T) {
+	completed := Payment{PaymentID: 7, ReservationID: 3, PaymentMethod: "Card", PaymentStatus: "Completed", Amount: 200}
+	with := func(change func(p *Payment)) *Payment {
+		p := completed
+		change(&p)
+		return &p
+	}
+
+	tests := []struct {
+		name    string
+		old     Payment
+		updated *Payment
+		want    string
+	}{
+		{"deleted", completed, nil, "deleted"},
+		{"refunded", completed, with(func(p *Payment) { p.PaymentStatus = "Refunded" }), "refunded"},
+		{"amount lowered", completed, with(func(p *Payment) { p.Amount = 20 }), "changed"},
+		{"moved to another reservation", completed, with(func(p *Payment) { p.ReservationID = 4 }), "changed"},
+		{"marked failed", completed, with(func(p *Payment) { p.PaymentStatus = "Failed" }), "changed"},
+		{"method corrected", completed, with(func(p *Payment) { p.PaymentMethod = "Cash" }), ""},
+		{"unchanged", completed, with(func(p *Payment) {}), ""},
+		{"pending deleted", Payment{PaymentStatus: "Pending", Amount: 200}, nil, ""},
+		{"pending completed", Payment{PaymentStatus: "Pending", Amount: 200}, with(func(p *Payment) {}), ""},
+	}
+	for _, test := range tests {
+		if got := paymentChangeReversal(test.old, test.updated); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestPaymentSourceKey(t *testing.T) {
+	// A payment reversed and completed again must earn under a new key, or
+	// the unique source_key would silently drop the new credit.
+	tests := []struct {
+		revision int
+		want     string
+	}{
+		{0, "payment:34"},
+		{1, "payment:34:1"},
+		{2, "payment:34:2"},
+	}
+	for _, test := range tests {
+		if got := paymentSourceKey(34, test.revision); got != test.want {
+			t.Errorf("revision %d: expected %q, got %q", test.revision, test.want, got)
+		}
+	}
+}
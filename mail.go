@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MailMessage is a plain-text outbound email.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outbound email.
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+// mailer is the Mailer used by the handlers, chosen by initMailer.
+var mailer Mailer
+
+// initMailer selects the mail transport from MAIL_DRIVER ("file" or "smtp").
+// The file driver is the default so the flows can be exercised offline.
+func initMailer() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@gatornest-inn.local"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			addr = "localhost:1025"
+		}
+		var auth smtp.Auth
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			host, _, _ := strings.Cut(addr, ":")
+			auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		mailer = &smtpMailer{addr: addr, from: from, auth: auth}
+		log.Printf("Sending mail through SMTP server %s", addr)
+	default:
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			log.Fatal("Error creating MAIL_OUTBOX_DIR:", err)
+		}
+		mailer = &fileMailer{dir: dir, from: from}
+		log.Printf("Writing outbound mail to %s", dir)
+	}
+}
+
+// formatMail renders msg as an RFC 5322 message.
+func formatMail(from string, msg MailMessage) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		from, msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body))
+}
+
+// fileMailer writes each message to an .eml file instead of sending it.
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func (m *fileMailer) Send(msg MailMessage) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), formatMail(m.from, msg), 0600)
+}
+
+// smtpMailer delivers messages through an SMTP relay such as a local
+// MailHog/Mailpit stub.
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(msg MailMessage) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, formatMail(m.from, msg))
+}
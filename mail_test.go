@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := &fileMailer{dir: dir, from: "no-reply@gatornest-inn.local"}
+
+	err := m.Send(MailMessage{To: "guest@example.com", Subject: "Reset your password", Body: "token=abc123"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 message in outbox, found %d", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Could not read message: %v", err)
+	}
+	for _, want := range []string{"To: guest@example.com", "Subject: Reset your password", "token=abc123"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("message missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestHashAuthTokenIsStable(t *testing.T) {
+	if hashAuthToken("abc") != hashAuthToken("abc") {
+		t.Error("expected identical tokens to hash identically")
+	}
+	if hashAuthToken("abc") == hashAuthToken("abd") {
+		t.Error("expected different tokens to hash differently")
+	}
+	if len(hashAuthToken("abc")) != 64 {
+		t.Errorf("expected 64 hex characters, got %d", len(hashAuthToken("abc")))
+	}
+}
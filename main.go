@@ -11,8 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"math/rand"
-
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-sql-driver/mysql"
@@ -24,16 +22,43 @@ import (
 
 // Global DB variable
 var db *sql.DB
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+
+// JWT settings, populated by initAuth once the environment has been loaded.
+var (
+	jwtSecret   []byte // legacy HS256 secret, only used to verify older tokens
+	jwtIssuer   string
+	jwtAudience string
+)
+
+// allowedJWTAlgs is the allow-list of signing algorithms AuthMiddleware
+// accepts. HS256 is added by initAuth only while a legacy secret is set.
+var allowedJWTAlgs = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
+// dateLayout is the format of DATE columns in requests and responses.
+const dateLayout = "2006-01-02"
+
+// tokenTTL is how long a token issued by loginUser stays valid.
+const tokenTTL = 24 * time.Hour
+
+// Claims is the typed set of JWT claims issued by loginUser.
+type Claims struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	MFA    bool   `json:"mfa,omitempty"` // true when the login used a second factor
+	jwt.RegisteredClaims
+}
 
 // Guest represents the guest profile as defined in the Guests table.
 type Guest struct {
-	GuestID   int    `json:"guest_id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Phone     string `json:"phone"`
-	UserID    int    `json:"user_id,omitempty"` // Set automatically from JWT
+	GuestID   int     `json:"guest_id"`
+	FirstName string  `json:"first_name"`
+	LastName  string  `json:"last_name"`
+	Email     string  `json:"email"`
+	Phone     *string `json:"phone"` // nil when the guest has not given one
+	UserID    int     `json:"user_id,omitempty"` // Set automatically from JWT
+	// ProfileIncomplete is true while the guest has no phone on file.
+	ProfileIncomplete bool `json:"profile_incomplete"`
 }
 
 type User struct {
@@ -66,13 +91,16 @@ type Reservation struct {
 	CreatedAt     time.Time `json:"created_at"`
 	UserID        int       `json:"user_id,omitempty"` // added for linking to logged-in user
 	Email         string    `json:"email"`
-}
-
-type Schedule struct {
-	ScheduleID int    `json:"schedule_id,omitempty"`
-	StaffID    int    `json:"staff_id"`
-	ShiftDate  string `json:"shift_date"` // "Monday", "Tuesday", etc.
-	ShiftTime  string `json:"shift_time"` // "Morning", "Afternoon", "Night"
+	// Phone is only read when the reservation creates or matches a guest.
+	Phone             *string `json:"phone,omitempty"`
+	ProfileIncomplete bool    `json:"profile_incomplete,omitempty"`
+	// SpecialRequests are stored in Reservation_Requests with the reservation.
+	SpecialRequests []ReservationRequest `json:"special_requests,omitempty"`
+	// HoldToken, from POST /holds, books the room the caller is holding.
+	HoldToken string `json:"hold_token,omitempty"`
+	// Overbooked is set when the room was already reserved and the booking
+	// was accepted under the room type's overbooking allowance.
+	Overbooked bool `json:"overbooked,omitempty"`
 }
 
 // initDB loads environment variables and connects to the MySQL database.
@@ -99,8 +127,46 @@ func initDB() {
 	log.Println("Connected to the database successfully")
 }
 
+// initAuth reads the JWT settings from the environment and loads the signing
+// keys. It must run after initDB so that values from .env are visible.
+func initAuth() {
+	// Tokens issued before the switch to asymmetric keys stay valid until
+	// they expire as long as JWT_SECRET is still set.
+	jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+	if len(jwtSecret) > 0 {
+		allowedJWTAlgs = append(allowedJWTAlgs, jwt.SigningMethodHS256.Alg())
+	}
+
+	jwtIssuer = os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "gatornest-inn"
+	}
+	jwtAudience = os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "gatornest-api"
+	}
+
+	initKeyRing()
+}
+
 func main() {
 	initDB()
+	initAuth()
+	initMailer()
+	initPasswordPolicy()
+	initLockoutPolicy()
+	initTwoFactorPolicy()
+	startGuestDedupJob()
+	initLoyaltyPolicy()
+	initHoldPolicy()
+	initWaitlist()
+	initNoShowJob()
+	initNightAudit()
+	initHousekeeping()
+	initWorkOrders()
+	initShiftGeneration()
+	initLabourPolicy()
+	startScheduler()
 	router := gin.Default()
 
 	// Apply CORS middleware (allowing requests from http://localhost:3001)
@@ -113,37 +179,116 @@ func main() {
 
 	router.POST("/register", registerUser)
 	router.POST("/login", loginUser)
+	router.GET("/.well-known/jwks.json", getJWKS)
+	router.POST("/verify-email", verifyEmail)
+	router.POST("/verify-email/resend", resendVerificationEmail)
+	router.POST("/password-reset/request", requestPasswordReset)
+	router.POST("/password-reset/confirm", confirmPasswordReset)
+	router.GET("/rooms/:room_type", getAvailableRoomsByType)
+
+	// 2FA enrollment is reachable before a required second factor is set up
+	twoFactor := router.Group("/2fa")
+	twoFactor.Use(AuthMiddleware())
+	{
+		twoFactor.POST("/enroll", enrollTwoFactor)
+		twoFactor.POST("/confirm", confirmTwoFactor)
+		twoFactor.POST("/recovery-codes", regenerateRecoveryCodes)
+		twoFactor.POST("/disable", disableTwoFactor)
+	}
 
 	// Protected Guest routes
 	auth := router.Group("/")
-	auth.Use(AuthMiddleware())
+	auth.Use(AuthMiddleware(), RequireTwoFactor())
 	{
 		auth.POST("/guests", createGuest)
 		auth.GET("/guests", getGuests)
 		auth.GET("/guests/:id", getGuest)
 		auth.PUT("/guests/:id", updateGuest)
 		auth.DELETE("/guests/:id", deleteGuest)
+		auth.GET("/guests/duplicates", RequireStaff(), getDuplicates)
+		auth.POST("/guests/duplicates/scan", RequireStaff(), scanDuplicates)
+		auth.POST("/guests/duplicates/:id/dismiss", RequireStaff(), dismissDuplicate)
+		auth.POST("/guests/merge", RequireStaff(), mergeGuests)
+		auth.POST("/guests/:id/erase", RequireStaff(), eraseGuest)
+		auth.GET("/guests/:id/preferences", getGuestPreferences)
+		auth.PUT("/guests/:id/preferences", replaceGuestPreferences)
 
 		auth.GET("/profile", getProfile)
+		auth.GET("/me", getMe)
+		auth.PUT("/me", updateMe)
+		auth.GET("/me/export", exportMyData)
+		auth.GET("/loyalty", getMyLoyalty)
+		auth.GET("/loyalty/tiers", getLoyaltyTiers)
+		auth.GET("/loyalty/users/:id", RequireStaff(), getUserLoyalty)
+		auth.POST("/loyalty/adjustments", RequireStaff(), createLoyaltyAdjustment)
+		auth.POST("/me/erase", eraseMyData)
+		auth.POST("/holds", createRoomHold)
+		auth.GET("/holds", getMyHolds)
+		auth.DELETE("/holds/:id", releaseRoomHold)
 		auth.POST("/reservations", createReservation)
+		auth.POST("/groups", createGroupBooking)
+		auth.GET("/groups/:id", getGroupBooking)
+		auth.GET("/groups/:id/folio", getGroupFolio)
+		auth.POST("/groups/:id/cancel", cancelGroupBooking)
+		auth.GET("/reservations", getReservations)
+		auth.POST("/reservations/:id/cancel", cancelReservation)
+		auth.GET("/reservations/:id/cancellation-fee", getCancellationQuote)
+		auth.GET("/cancellation-policies", getCancellationPolicies)
+		auth.POST("/cancellation-policies", RequireStaff(), createCancellationPolicy)
+		auth.PUT("/cancellation-policies/:id", RequireStaff(), updateCancellationPolicy)
+		auth.PUT("/rooms/:id/cancellation-policy", RequireStaff(), setRoomCancellationPolicy)
+		auth.POST("/reservations/:id/walk", RequireStaff(), walkReservation)
+		auth.GET("/overbooking", RequireStaff(), getOverbookingAllowances)
+		auth.PUT("/overbooking/:room_type", RequireStaff(), updateOverbookingAllowance)
+		auth.GET("/overbooking/report", RequireStaff(), getOverbookingReport)
+		auth.GET("/partners", RequireStaff(), getPartners)
+		auth.POST("/partners", RequireStaff(), createPartner)
+		auth.PUT("/partners/:id", RequireStaff(), updatePartner)
+		auth.GET("/walks", RequireStaff(), getWalks)
+		auth.POST("/no-shows/scan", RequireStaff(), scanNoShows)
+		auth.GET("/jobs", RequireStaff(), getJobs)
+		auth.GET("/jobs/:name/runs", RequireStaff(), getJobRuns)
+		auth.POST("/jobs/:name/run", RequireStaff(), runJobNow)
+		auth.GET("/business-date", RequireStaff(), getBusinessDate)
+		auth.POST("/night-audit", RequireStaff(), closeBusinessDay)
+		auth.GET("/day-closes", RequireStaff(), getDayCloses)
+		auth.GET("/day-closes/:date", RequireStaff(), getDayClose)
+		auth.POST("/reservations/:id/check-in", RequireStaff(), checkInReservation)
+		auth.POST("/reservations/:id/check-out", RequireStaff(), checkOutReservation)
+		auth.GET("/housekeeping/rooms", RequireStaff(), getHousekeepingRooms)
+		auth.POST("/housekeeping/rooms/:id/inspect", RequireStaff(), inspectRoom)
+		auth.GET("/housekeeping/tasks", RequireStaff(), getHousekeepingTasks)
+		auth.PUT("/housekeeping/tasks/:id/assignment", RequireStaff(), assignHousekeepingTask)
+		auth.POST("/housekeeping/tasks/:id/start", RequireStaff(), startHousekeepingTask)
+		auth.POST("/housekeeping/tasks/:id/complete", RequireStaff(), completeHousekeepingTask)
+		auth.POST("/work-orders", RequireStaff(), createWorkOrder)
+		auth.GET("/work-orders", RequireStaff(), getWorkOrders)
+		auth.GET("/work-orders/:id", RequireStaff(), getWorkOrder)
+		auth.PUT("/work-orders/:id", RequireStaff(), updateWorkOrder)
+		auth.POST("/work-orders/:id/close", RequireStaff(), closeWorkOrder)
+		auth.POST("/waitlist", joinWaitlist)
+		auth.GET("/waitlist", getWaitlist)
+		auth.DELETE("/waitlist/:id", leaveWaitlist)
+		auth.GET("/reservations/:id/requests", getReservationRequests)
+		auth.POST("/reservations/:id/requests", addReservationRequest)
+		auth.GET("/reservation-requests", RequireStaff(), getOpenRequests)
+		auth.PUT("/reservation-requests/:id/status", RequireStaff(), updateReservationRequestStatus)
 
 		auth.GET("/staff/:id", getStaffByID)
 		auth.GET("/staffs", getAllStaff)
 
-		auth.POST("/schedule", addToSchedule)
-		auth.DELETE("/schedule/:id", removeFromSchedule)
-		auth.PUT("/schedule/:id", updateSchedule)
-		auth.GET("/schedules", getAllSchedules)
+		registerScheduleRoutes(auth)
 
+		// Completed payments earn loyalty points, so only staff record or
+		// change them; guests may only pay with points. Payments span every
+		// guest, so only staff may read them.
+		auth.POST("/payments", createPayment)
+		auth.GET("/payments", RequireStaff(), getPayments)
+		auth.GET("/payments/:id", RequireStaff(), getPayment)
+		auth.PUT("/payments/:id", RequireStaff(), updatePayment)
+		auth.DELETE("/payments/:id", RequireStaff(), deletePayment)
 	}
 
-	// ------------------- Payment Endpoints -------------------
-	router.POST("/payments", createPayment)
-	router.GET("/payments", getPayments)
-	router.GET("/payments/:id", getPayment)
-	router.PUT("/payments/:id", updatePayment)
-	router.DELETE("/payments/:id", deletePayment)
-
 	// Start the server on PORT defined in .env (default 3000)
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -153,19 +298,6 @@ func main() {
 	router.Run(":" + port)
 }
 
-// GenerateRandomPhoneNumber creates a random 10-digit phone number
-func GenerateRandomPhoneNumber() string {
-	rand.Seed(time.Now().UnixNano())
-
-	// Generate random digits
-	areaCode := rand.Intn(900) + 100 // Ensures a 3-digit number (100-999)
-	prefix := rand.Intn(900) + 100   // Ensures a 3-digit number (100-999)
-	lineNumber := rand.Intn(10000)   // Ensures a 4-digit number (0000-9999)
-
-	// Format as a phone number
-	return fmt.Sprintf("%d-%d-%04d", areaCode, prefix, lineNumber)
-}
-
 // ------------------- Guest Handlers -------------------
 
 // createGuest handles POST /guests
@@ -183,13 +315,32 @@ func createGuest(c *gin.Context) {
 		return
 	}
 	userID := userIDInterface.(int)
-	guest.UserID = userID
+
+	phone, err := normalizePhone(guest.Phone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	guest.Phone = phone
+	guest.ProfileIncomplete = phone == nil
+
+	// Guests belong to the account that creates them. Front desk staff create
+	// guests on behalf of others, so theirs are linked to the user_id given in
+	// the body (or to no account) rather than to the staff member.
+	if !isStaff(c) {
+		guest.UserID = userID
+	}
+	owner := sql.NullInt64{Int64: int64(guest.UserID), Valid: guest.UserID > 0}
 
 	result, err := db.Exec(
 		"INSERT INTO Guests (first_name, last_name, email, phone, user_id) VALUES (?, ?, ?, ?, ?)",
-		guest.FirstName, guest.LastName, guest.Email, guest.Phone, guest.UserID,
+		guest.FirstName, guest.LastName, guest.Email, guest.Phone, owner,
 	)
 	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email or phone is already used by another guest"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating guest", "details": err.Error()})
 		return
 	}
@@ -215,9 +366,68 @@ func getProfile(c *gin.Context) {
 	})
 }
 
+// guestScope returns a WHERE condition (to append after another condition)
+// and its arguments restricting Guests to those owned by the caller. Staff
+// see every guest.
+func guestScope(c *gin.Context) (string, []interface{}) {
+	if isStaff(c) {
+		return "", nil
+	}
+	return " AND user_id = ?", []interface{}{c.GetInt("user_id")}
+}
+
+// guestAccessible reports whether the guest exists and the caller may see it.
+// Callers respond 404 either way so other users' guest IDs are not revealed.
+func guestAccessible(c *gin.Context, guestID string) (bool, error) {
+	scope, args := guestScope(c)
+	var exists int
+	err := db.QueryRow("SELECT 1 FROM Guests WHERE guest_id = ?"+scope, append([]interface{}{guestID}, args...)...).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// guestSorts are the sort fields accepted by GET /guests.
+var guestSorts = map[string]string{
+	"guest_id":   "guest_id",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"email":      "email",
+}
+
 // getGuests handles GET /guests
+// ?q= searches name, email and phone; see parseListQuery for paging and sorting.
 func getGuests(c *gin.Context) {
-	rows, err := db.Query("SELECT guest_id, first_name, last_name, email, phone FROM Guests")
+	lq, err := parseListQuery(c, guestSorts, "last_name", "guest_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scope, args := guestScope(c)
+	search, searchArgs := fullTextMatch(c.Query("q"), "first_name", "last_name", "email", "phone")
+	where := " WHERE TRUE" + scope + search
+	args = append(args, searchArgs...)
+	if v := c.Query("profile_incomplete"); v != "" {
+		incomplete, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "profile_incomplete must be true or false"})
+			return
+		}
+		where += " AND profile_incomplete = ?"
+		args = append(args, incomplete)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Guests"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting guests", "details": err.Error()})
+		return
+	}
+
+	keyset, keysetArgs := lq.keyset()
+	rows, err := db.Query("SELECT guest_id, first_name, last_name, email, phone, profile_incomplete, "+lq.sortValueExpr()+" FROM Guests"+where+keyset+lq.orderLimit(),
+		append(args, keysetArgs...)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching guests", "details": err.Error()})
 		return
@@ -225,23 +435,28 @@ func getGuests(c *gin.Context) {
 	defer rows.Close()
 
 	var guests []Guest
+	var keys []listCursor
 	for rows.Next() {
 		var g Guest
-		if err := rows.Scan(&g.GuestID, &g.FirstName, &g.LastName, &g.Email, &g.Phone); err != nil {
+		var k listCursor
+		if err := rows.Scan(&g.GuestID, &g.FirstName, &g.LastName, &g.Email, &g.Phone, &g.ProfileIncomplete, &k.Value); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning guest", "details": err.Error()})
 			return
 		}
+		k.ID = g.GuestID
 		guests = append(guests, g)
+		keys = append(keys, k)
 	}
-	c.JSON(http.StatusOK, guests)
+	c.JSON(http.StatusOK, newListPage(guests, keys, lq, total))
 }
 
 // getGuest handles GET /guests/:id
 func getGuest(c *gin.Context) {
 	id := c.Param("id")
+	scope, args := guestScope(c)
 	var g Guest
-	err := db.QueryRow("SELECT guest_id, first_name, last_name, email, phone FROM Guests WHERE guest_id = ?", id).
-		Scan(&g.GuestID, &g.FirstName, &g.LastName, &g.Email, &g.Phone)
+	err := db.QueryRow("SELECT guest_id, first_name, last_name, email, phone, profile_incomplete FROM Guests WHERE guest_id = ?"+scope, append([]interface{}{id}, args...)...).
+		Scan(&g.GuestID, &g.FirstName, &g.LastName, &g.Email, &g.Phone, &g.ProfileIncomplete)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
@@ -261,25 +476,72 @@ func updateGuest(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
 		return
 	}
-	result, err := db.Exec("UPDATE Guests SET first_name = ?, last_name = ?, email = ?, phone = ? WHERE guest_id = ?",
-		guest.FirstName, guest.LastName, guest.Email, guest.Phone, id)
+	phone, err := normalizePhone(guest.Phone)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating guest", "details": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+	guest.Phone = phone
+	guest.ProfileIncomplete = phone == nil
+
+	// The ownership scope is part of the UPDATE itself so access cannot
+	// change between a check and the write.
+	scope, args := guestScope(c)
+	result, err := db.Exec("UPDATE Guests SET first_name = ?, last_name = ?, email = ?, phone = ? WHERE guest_id = ?"+scope,
+		append([]interface{}{guest.FirstName, guest.LastName, guest.Email, guest.Phone, id}, args...)...)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email or phone is already used by another guest"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating guest", "details": err.Error()})
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// MySQL also reports 0 rows when nothing changed, so check whether
+		// the caller can see the guest at all.
+		ok, err := guestAccessible(c, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating guest", "details": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+			return
+		}
+	}
 	guest.GuestID, _ = strconv.Atoi(id)
 	c.JSON(http.StatusOK, guest)
 }
 
 // deleteGuest handles DELETE /guests/:id
+// Guests with reservations cannot be deleted, since that would cascade away
+// their payment history; POST /guests/:id/erase anonymises them instead.
 func deleteGuest(c *gin.Context) {
 	id := c.Param("id")
-	result, err := db.Exec("DELETE FROM Guests WHERE guest_id = ?", id)
+	// Ownership first, so callers cannot learn that someone else's guest
+	// exists from the reservation check.
+	ok, err := guestAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting guest", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+		return
+	}
+	var reservations int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Reservations WHERE guest_id = ?", id).Scan(&reservations); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting guest", "details": err.Error()})
+		return
+	}
+	if reservations > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Guest has reservations and cannot be deleted; erase their personal data instead"})
+		return
+	}
+
+	scope, args := guestScope(c)
+	result, err := db.Exec("DELETE FROM Guests WHERE guest_id = ?"+scope, append([]interface{}{id}, args...)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting guest", "details": err.Error()})
 		return
@@ -301,6 +563,14 @@ func createPayment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
 		return
 	}
+	if payment.PaymentMethod == loyaltyPaymentMethod {
+		createLoyaltyPayment(c, &payment)
+		return
+	}
+	if !isStaff(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff access required"})
+		return
+	}
 	result, err := db.Exec("INSERT INTO Payments (reservation_id, payment_method, payment_status, amount) VALUES (?, ?, ?, ?)",
 		payment.ReservationID, payment.PaymentMethod, payment.PaymentStatus, payment.Amount)
 	if err != nil {
@@ -317,9 +587,40 @@ func createPayment(c *gin.Context) {
 	c.JSON(http.StatusCreated, payment)
 }
 
+// paymentSorts and paymentFilters are the list options accepted by GET /payments.
+var (
+	paymentSorts = map[string]string{
+		"payment_id":       "payment_id",
+		"transaction_date": "transaction_date",
+		"amount":           "amount",
+	}
+	paymentFilters = map[string]string{
+		"reservation_id": "reservation_id",
+		"payment_method": "payment_method",
+		"payment_status": "payment_status",
+	}
+)
+
 // getPayments handles GET /payments
 func getPayments(c *gin.Context) {
-	rows, err := db.Query("SELECT payment_id, reservation_id, payment_method, payment_status, amount, transaction_date FROM Payments")
+	lq, err := parseListQuery(c, paymentSorts, "-transaction_date", "payment_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filters, args := equalityFilters(c, paymentFilters)
+	where := " WHERE TRUE" + filters
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Payments"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting payments", "details": err.Error()})
+		return
+	}
+
+	keyset, keysetArgs := lq.keyset()
+	rows, err := db.Query("SELECT payment_id, reservation_id, payment_method, payment_status, amount, transaction_date, "+lq.sortValueExpr()+
+		" FROM Payments"+where+keyset+lq.orderLimit(), append(args, keysetArgs...)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching payments", "details": err.Error()})
 		return
@@ -327,15 +628,19 @@ func getPayments(c *gin.Context) {
 	defer rows.Close()
 
 	var payments []Payment
+	var keys []listCursor
 	for rows.Next() {
 		var p Payment
-		if err := rows.Scan(&p.PaymentID, &p.ReservationID, &p.PaymentMethod, &p.PaymentStatus, &p.Amount, &p.TransactionDate); err != nil {
+		var k listCursor
+		if err := rows.Scan(&p.PaymentID, &p.ReservationID, &p.PaymentMethod, &p.PaymentStatus, &p.Amount, &p.TransactionDate, &k.Value); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning payment", "details": err.Error()})
 			return
 		}
+		k.ID = p.PaymentID
 		payments = append(payments, p)
+		keys = append(keys, k)
 	}
-	c.JSON(http.StatusOK, payments)
+	c.JSON(http.StatusOK, newListPage(payments, keys, lq, total))
 }
 
 // getPayment handles GET /payments/:id
@@ -356,32 +661,106 @@ func getPayment(c *gin.Context) {
 }
 
 // updatePayment handles PUT /payments/:id
+// Points earned by a completed payment are taken back when it is refunded or
+// its details change. Payments on a closed business day cannot be changed.
 func updatePayment(c *gin.Context) {
-	id := c.Param("id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
 	var payment Payment
 	if err := c.ShouldBindJSON(&payment); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
 		return
 	}
-	result, err := db.Exec("UPDATE Payments SET reservation_id = ?, payment_method = ?, payment_status = ?, amount = ? WHERE payment_id = ?",
-		payment.ReservationID, payment.PaymentMethod, payment.PaymentStatus, payment.Amount, id)
+	// Points payments are tied to a ledger entry, so they can only be
+	// refunded (deleted), never edited or created by changing the method.
+	if payment.PaymentMethod == loyaltyPaymentMethod {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use POST /payments to pay with loyalty points"})
+		return
+	}
+	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating payment", "details": err.Error()})
 		return
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+	defer tx.Rollback()
+
+	var old Payment
+	err = tx.QueryRow("SELECT payment_id, reservation_id, payment_method, payment_status, amount FROM Payments WHERE payment_id = ? AND payment_method <> ? FOR UPDATE",
+		id, loyaltyPaymentMethod).Scan(&old.PaymentID, &old.ReservationID, &old.PaymentMethod, &old.PaymentStatus, &old.Amount)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found or paid with loyalty points"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating payment", "details": err.Error()})
+		return
+	}
+	closed, err := paymentDayClosed(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking business date", "details": err.Error()})
+		return
+	}
+	if closed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment belongs to a closed business day"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE Payments SET reservation_id = ?, payment_method = ?, payment_status = ?, amount = ? WHERE payment_id = ?",
+		payment.ReservationID, payment.PaymentMethod, payment.PaymentStatus, payment.Amount, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating payment", "details": err.Error()})
+		return
+	}
+	if reason := paymentChangeReversal(old, &payment); reason != "" {
+		if err := reversePaymentPoints(tx, id, reason); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reversing loyalty points", "details": err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating payment", "details": err.Error()})
 		return
 	}
-	payment.PaymentID, _ = strconv.Atoi(id)
+	payment.PaymentID = id
 	c.JSON(http.StatusOK, payment)
 }
 
 // deletePayment handles DELETE /payments/:id
+// Deleting a loyalty points payment credits the points back; deleting any
+// other payment takes back the points it earned. Payments on a closed
+// business day cannot be deleted.
 func deletePayment(c *gin.Context) {
-	id := c.Param("id")
-	result, err := db.Exec("DELETE FROM Payments WHERE payment_id = ?", id)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting payment", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	closed, err := paymentDayClosed(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking business date", "details": err.Error()})
+		return
+	}
+	if closed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment belongs to a closed business day"})
+		return
+	}
+	if err := refundLoyaltyPayment(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error refunding loyalty points", "details": err.Error()})
+		return
+	}
+	if err := reversePaymentPoints(tx, id, "deleted"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reversing loyalty points", "details": err.Error()})
+		return
+	}
+	result, err := tx.Exec("DELETE FROM Payments WHERE payment_id = ?", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting payment", "details": err.Error()})
 		return
@@ -391,6 +770,10 @@ func deletePayment(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting payment", "details": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Payment deleted successfully"})
 }
 
@@ -413,6 +796,11 @@ func registerUser(c *gin.Context) {
 		return
 	}
 
+	if err := passwordRules.validate(user.Password, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
@@ -433,8 +821,14 @@ func registerUser(c *gin.Context) {
 	user.UserID = int(id)
 	user.Password = "" // Clear password before sending back
 
+	// The account stays inactive until the emailed link is followed. A failed
+	// send is not fatal; the user can ask for the email again.
+	if err := sendVerificationEmail(user.UserID, user.Email); err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
+		"message": "User registered successfully. Check your email to verify your account.",
 		"user_id": user.UserID,
 	})
 }
@@ -442,8 +836,10 @@ func registerUser(c *gin.Context) {
 // loginUser handles POST /login
 func loginUser(c *gin.Context) {
 	var loginData struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email        string `json:"email"`
+		Password     string `json:"password"`
+		TOTPCode     string `json:"totp_code"`
+		RecoveryCode string `json:"recovery_code"`
 	}
 	if err := c.ShouldBindJSON(&loginData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
@@ -455,13 +851,33 @@ func loginUser(c *gin.Context) {
 		return
 	}
 
-	var storedHash string
-	var userID int
+	now := time.Now()
+	ip := c.ClientIP()
+	until, err := loginLockedUntil(loginData.Email, ip, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error during login", "details": err.Error()})
+		return
+	}
+	if !until.IsZero() {
+		retryAfter := int(until.Sub(now).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Try again later.", "retry_after_seconds": retryAfter})
+		return
+	}
 
-	err := db.QueryRow("SELECT user_id, password_hash FROM Users WHERE email = ?", loginData.Email).
-		Scan(&userID, &storedHash)
+	var storedHash, role string
+	var userID int
+	var emailVerified, totpEnabled bool
+	var totpSecret sql.NullString
+	var totpLastStep sql.NullInt64
+
+	err = db.QueryRow(`
+		SELECT user_id, password_hash, email_verified, role, totp_enabled, totp_secret, totp_last_step
+		FROM Users WHERE email = ?`, loginData.Email).
+		Scan(&userID, &storedHash, &emailVerified, &role, &totpEnabled, &totpSecret, &totpLastStep)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			recordFailedLogin(loginData.Email, 0, ip, now)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error during login", "details": err.Error()})
@@ -470,102 +886,195 @@ func loginUser(c *gin.Context) {
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(loginData.Password)); err != nil {
+		recordFailedLogin(loginData.Email, userID, ip, now)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Create JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"email":   loginData.Email,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	})
+	if !emailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	if totpEnabled {
+		if loginData.TOTPCode == "" && loginData.RecoveryCode == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "two_factor_required": true})
+			return
+		}
+		ok, err := checkSecondFactor(userID, totpSecret.String, totpLastStep.Int64, loginData.TOTPCode, loginData.RecoveryCode, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error during login", "details": err.Error()})
+			return
+		}
+		if !ok {
+			recordFailedLogin(loginData.Email, userID, ip, now)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code", "two_factor_required": true})
+			return
+		}
+	}
 
-	tokenString, err := token.SignedString(jwtSecret)
+	if err := clearLoginFailures(lockoutScopeAccount, strings.ToLower(loginData.Email)); err != nil {
+		log.Println("Error clearing failed logins:", err)
+	}
+
+	tokenString, err := issueToken(userID, loginData.Email, role, totpEnabled)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Login successful",
 		"token":   tokenString,
-	})
+	}
+	// The token only works on /2fa/* until enrollment is complete.
+	if twoFactorRequiredRoles[role] && !totpEnabled {
+		response["two_factor_enrollment_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// AuthMiddleware verifies the JWT token and sets user info in context
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		fmt.Println("Received Authorization Header:", authHeader) // Debugging line
+// issueToken creates a JWT for the given user signed with the active key.
+func issueToken(userID int, email, role string, mfa bool) (string, error) {
+	key := jwtKeys.active()
+	if key == nil {
+		return "", fmt.Errorf("no signing key loaded")
+	}
+	now := time.Now()
+	claims := Claims{
+		UserID: userID,
+		Email:  email,
+		Role:   role,
+		MFA:    mfa,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Subject:   strconv.Itoa(userID),
+			Audience:  jwt.ClaimStrings{jwtAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+		},
+	}
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
 
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
+// jwtKeyFunc returns the verification key for a token: the legacy secret for
+// HS256, otherwise the key named by the kid header. The algorithm itself has
+// already been checked against allowedJWTAlgs.
+func jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return jwtSecret, nil
+	}
 
-		// Extract token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	kid, _ := token.Header["kid"].(string)
+	key := jwtKeys.lookup(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("signing key %q does not use %s", kid, token.Method.Alg())
+	}
+	return key.private.Public(), nil
+}
 
-		fmt.Println("Extracted Token:", tokenString) // Debugging line
+// parseToken validates the signature, algorithm, issuer, audience, expiry and
+// not-before of a token and returns its claims.
+func parseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, jwtKeyFunc,
+		jwt.WithValidMethods(allowedJWTAlgs),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithAudience(jwtAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID <= 0 {
+		return nil, fmt.Errorf("token is missing the user_id claim")
+	}
+	return claims, nil
+}
 
-		// Debugging: Decode the token before validation
-		claims := jwt.MapClaims{}
-		_, _, err := new(jwt.Parser).ParseUnverified(tokenString, &claims)
-		if err != nil {
-			fmt.Println("Error parsing token:", err)
-		} else {
-			fmt.Println("Decoded Token Claims:", claims)
-		}
+// authenticate verifies the bearer token and sets user info in context. On
+// failure it writes the 401 response and returns false.
+func authenticate(c *gin.Context) bool {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		return false
+	}
 
-		// tokenStr := authHeader
-		// token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		// 	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		// 		return nil, fmt.Errorf("unexpected signing method")
-		// 	}
-		// 	return jwtSecret, nil
-		// })
-		// Proceed with actual token validation
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
+	tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || tokenString == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header must use the Bearer scheme"})
+		return false
+	}
 
-		// if err != nil || !token.Valid {
-		// 	fmt.Println("Token Validation Error:", err) // Debugging line
-		// 	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		// 	c.Abort()
-		// 	return
-		// }
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		// Only the validation error is logged; never the token or its claims.
+		log.Printf("Rejected token from %s: %v", c.ClientIP(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return false
+	}
 
-		if err != nil {
-			fmt.Println("Token Validation Error:", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+	// Add user info to context
+	c.Set("user_id", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("role", claims.Role)
+	c.Set("claims", claims)
+	return true
+}
+
+// AuthMiddleware verifies the JWT token and sets user info in context
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticate(c) {
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		// claims, ok := token.Claims.(jwt.MapClaims)
-		// if !ok {
-		// 	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-		// 	c.Abort()
-		// 	return
-		// }
-
-		// Extract user ID from token claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID := int(claims["user_id"].(float64)) // Ensure the claim exists
-			c.Set("user_id", userID)
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+// staffRoles are the Users.role values with hotel-wide access to guest data.
+var staffRoles = map[string]bool{"staff": true, "manager": true, "admin": true}
+
+// isStaff reports whether the authenticated caller has a staff role.
+func isStaff(c *gin.Context) bool {
+	return staffRoles[c.GetString("role")]
+}
+
+// RequireStaff rejects callers without a staff role. It runs after
+// AuthMiddleware.
+func RequireStaff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isStaff(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Staff access required"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		// Add user info to context
-		c.Set("user_id", int(claims["user_id"].(float64)))
-		c.Set("email", claims["email"].(string))
+// managerRoles are the staff roles that may change staff rosters.
+var managerRoles = map[string]bool{"manager": true, "admin": true}
 
+// RequireManager rejects callers without a manager role. It runs after
+// AuthMiddleware.
+func RequireManager() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !managerRoles[c.GetString("role")] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Manager access required"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -585,48 +1094,90 @@ func createReservation(c *gin.Context) {
 	}
 	reservation.UserID = userIDInterface.(int)
 
+	if msg, ok := validateRequests(reservation.SpecialRequests); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	stay, err := parseStay(reservation.CheckInDate, reservation.CheckOutDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 🔹 Step 1: Check if guest exists
-	var existingGuest Guest
-	err := db.QueryRow("SELECT guest_id FROM Guests WHERE guest_id = ?", reservation.GuestID).Scan(&existingGuest.GuestID)
+	// Only the caller's own guests can be booked for, unless they are staff.
+	ok, err := guestAccessible(c, strconv.Itoa(reservation.GuestID))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// Guest does not exist, create a new one
-			fmt.Println("Guest not found. Creating new guest...")
-
-			newGuest := Guest{
-				FirstName: reservation.FirstName,
-				LastName:  reservation.LastName,
-				Email:     reservation.Email,
-				Phone:     GenerateRandomPhoneNumber(),
-				UserID:    reservation.UserID,
-			}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+		return
+	}
+	if !ok {
+		if status, msg := resolveReservationGuest(c, db, &reservation); status != 0 {
+			c.JSON(status, gin.H{"error": msg})
+			return
+		}
+	}
 
-			result, err := db.Exec(`
-				INSERT INTO Guests (first_name, last_name, email, phone, user_id) 
-				VALUES (?, ?, ?, ?, ?)`,
-				newGuest.FirstName, newGuest.LastName, newGuest.Email, newGuest.Phone, newGuest.UserID,
-			)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating guest", "details": err.Error()})
-				return
-			}
+	// 🔹 Step 2: Insert the reservation and its special requests together
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reservation", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
 
-			// Retrieve the new guest_id
-			guestID, _ := result.LastInsertId()
-			reservation.GuestID = int(guestID)
+	if err := lockRooms(tx, []int{reservation.RoomID}); err != nil {
+		if err == errRoomNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
 		} else {
-			// Some other error occurred
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		}
+		return
+	}
+	if reservation.HoldToken != "" {
+		err := consumeRoomHold(tx, reservation.HoldToken, reservation.UserID, reservation.RoomID, stay)
+		switch err {
+		case nil:
+			reservation.HoldToken = ""
+		case errHoldNotFound:
+			c.JSON(http.StatusConflict, gin.H{"error": "Your hold on this room has expired"})
 			return
+		case errHoldMismatch:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hold_token " + err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking hold", "details": err.Error()})
+			return
+		}
+	}
+	rate, err := roomRate(tx, reservation.RoomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error pricing room", "details": err.Error()})
+		return
+	}
+	reservation.Status, reservation.TotalPrice = bookingTerms(isStaff(c), reservation.Status, reservation.TotalPrice, rate, stay)
+
+	conflict, err := roomConflict(tx, reservation.RoomID, stay)
+	if err == nil && conflict == conflictReserved {
+		reservation.Overbooked, err = canOverbook(tx, reservation.RoomID, stay)
+		if reservation.Overbooked {
+			conflict = ""
 		}
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		return
+	}
+	if conflict != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Room is " + conflict})
+		return
+	}
 
-	// 🔹 Step 2: Insert the reservation
-	result, err := db.Exec(`
-		INSERT INTO Reservations (guest_id, room_id, check_in_date, check_out_date, status, total_price)
-    	VALUES (?, ?, ?, ?, ?, ?)`,
+	result, err := tx.Exec(`
+		INSERT INTO Reservations (guest_id, room_id, check_in_date, check_out_date, status, total_price, overbooked)
+    	VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		reservation.GuestID, reservation.RoomID, reservation.CheckInDate,
-		reservation.CheckOutDate, reservation.Status, reservation.TotalPrice,
+		reservation.CheckOutDate, reservation.Status, reservation.TotalPrice, reservation.Overbooked,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reservation", "details": err.Error()})
@@ -636,9 +1187,155 @@ func createReservation(c *gin.Context) {
 	id, _ := result.LastInsertId()
 	reservation.ReservationID = int(id)
 
+	if err := insertReservationRequests(tx, reservation.ReservationID, reservation.SpecialRequests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving special requests", "details": err.Error()})
+		return
+	}
+	if err := snapshotCancellationPolicy(tx, reservation.ReservationID, reservation.RoomID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving cancellation policy", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reservation", "details": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusCreated, reservation)
 }
 
+// reservationSorts and reservationFilters are the list options accepted by
+// GET /reservations.
+var (
+	reservationSorts = map[string]string{
+		"reservation_id": "r.reservation_id",
+		"check_in_date":  "r.check_in_date",
+		"created_at":     "r.created_at",
+		"total_price":    "r.total_price",
+	}
+	reservationFilters = map[string]string{
+		"status":   "r.status",
+		"guest_id": "r.guest_id",
+		"room_id":  "r.room_id",
+	}
+)
+
+// getReservations handles GET /reservations
+// ?from= and ?to= (YYYY-MM-DD) return stays overlapping that date range.
+// Guests only see reservations for their own guest records.
+func getReservations(c *gin.Context) {
+	lq, err := parseListQuery(c, reservationSorts, "check_in_date", "r.reservation_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where, args := equalityFilters(c, reservationFilters)
+	where = " WHERE TRUE" + where
+	if !isStaff(c) {
+		where += " AND g.user_id = ?"
+		args = append(args, c.GetInt("user_id"))
+	}
+	for param, cond := range map[string]string{"from": " AND r.check_out_date >= ?", "to": " AND r.check_in_date <= ?"} {
+		if v := c.Query(param); v != "" {
+			if _, err := time.Parse(dateLayout, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a date in YYYY-MM-DD format"})
+				return
+			}
+			where += cond
+			args = append(args, v)
+		}
+	}
+
+	const from = " FROM Reservations r JOIN Guests g ON g.guest_id = r.guest_id"
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting reservations", "details": err.Error()})
+		return
+	}
+
+	keyset, keysetArgs := lq.keyset()
+	rows, err := db.Query(`SELECT r.reservation_id, r.guest_id, r.room_id, r.check_in_date, r.check_out_date,
+		r.status, r.total_price, r.created_at, g.first_name, g.last_name, g.email, `+lq.sortValueExpr()+
+		from+where+keyset+lq.orderLimit(), append(args, keysetArgs...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reservations", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var reservations []Reservation
+	var keys []listCursor
+	for rows.Next() {
+		var r Reservation
+		var k listCursor
+		var checkIn, checkOut time.Time
+		if err := rows.Scan(&r.ReservationID, &r.GuestID, &r.RoomID, &checkIn, &checkOut,
+			&r.Status, &r.TotalPrice, &r.CreatedAt, &r.FirstName, &r.LastName, &r.Email, &k.Value); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning reservation", "details": err.Error()})
+			return
+		}
+		r.CheckInDate = checkIn.Format(dateLayout)
+		r.CheckOutDate = checkOut.Format(dateLayout)
+		k.ID = r.ReservationID
+		reservations = append(reservations, r)
+		keys = append(keys, k)
+	}
+	c.JSON(http.StatusOK, newListPage(reservations, keys, lq, total))
+}
+
+// resolveReservationGuest finds or creates the guest for a reservation made
+// without a known guest_id, using the contact details in the request. An
+// existing guest with the same email or phone is reused rather than
+// duplicated. Any guest it creates is written through q, so callers booking
+// inside a transaction pass tx to have it rolled back with the booking. It
+// returns a non-zero status and message if the request cannot be satisfied.
+func resolveReservationGuest(c *gin.Context, q queryExecer, reservation *Reservation) (int, string) {
+	if reservation.FirstName == "" || reservation.LastName == "" || !isValidEmail(reservation.Email) {
+		return http.StatusBadRequest, "first_name, last_name and a valid email are required to book for a new guest"
+	}
+	phone, err := normalizePhone(reservation.Phone)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	reservation.Phone = phone
+
+	match, err := findGuestByContact(q, reservation.Email, phone)
+	if err != nil {
+		return http.StatusInternalServerError, "Error looking up guest"
+	}
+	if match != nil {
+		if !isStaff(c) && match.UserID != reservation.UserID {
+			return http.StatusConflict, "A guest with this email or phone belongs to another account"
+		}
+		reservation.GuestID = match.GuestID
+		if !match.HasPhone && phone != nil {
+			completeGuestPhone(q, match.GuestID, *phone)
+		}
+		reservation.ProfileIncomplete = !match.HasPhone && phone == nil
+		return 0, ""
+	}
+
+	// Guest does not exist, create a new one. Staff bookings are not linked
+	// to the staff member's account, as in createGuest.
+	owner := sql.NullInt64{Int64: int64(reservation.UserID), Valid: !isStaff(c)}
+	result, err := q.Exec(`
+		INSERT INTO Guests (first_name, last_name, email, phone, user_id)
+		VALUES (?, ?, ?, ?, ?)`,
+		reservation.FirstName, reservation.LastName, reservation.Email, phone, owner,
+	)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		// Created concurrently by another request.
+		return http.StatusConflict, "Email or phone is already used by another guest"
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "Error creating guest"
+	}
+	guestID, _ := result.LastInsertId()
+	reservation.GuestID = int(guestID)
+	reservation.ProfileIncomplete = phone == nil
+	return 0, ""
+}
+
 // Staff Endpoints
 
 func getAllStaff(c *gin.Context) {
@@ -701,125 +1398,3 @@ func getStaffByID(c *gin.Context) {
 		"role":       role,
 	})
 }
-
-// Staff Reservation Endpoints
-
-// GET /schedules - Get all staff schedules
-func getAllSchedules(c *gin.Context) {
-	rows, err := db.Query(`SELECT staff_id, shift_date, shift_time FROM Staff_Schedule`)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schedules", "details": err.Error()})
-		return
-	}
-	defer rows.Close()
-
-	var schedules []map[string]interface{}
-	for rows.Next() {
-		var staffID int
-		var shiftDate, shiftTime string
-
-		if err := rows.Scan(&staffID, &shiftDate, &shiftTime); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse schedule", "details": err.Error()})
-			return
-		}
-
-		schedules = append(schedules, gin.H{
-			"staff_id":   staffID,
-			"shift_date": shiftDate,
-			"shift_time": shiftTime,
-		})
-	}
-
-	c.JSON(http.StatusOK, schedules)
-}
-
-// POST /schedule - Add staff to schedule
-func addToSchedule(c *gin.Context) {
-	var s Schedule
-	if err := c.ShouldBindJSON(&s); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-		return
-	}
-
-	query := `INSERT INTO Staff_Schedule (staff_id, shift_date, shift_time) VALUES (?, ?, ?)`
-	result, err := db.Exec(query, s.StaffID, s.ShiftDate, s.ShiftTime)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add schedule", "details": err.Error()})
-		return
-	}
-
-	id, _ := result.LastInsertId()
-	s.ScheduleID = int(id)
-	c.JSON(http.StatusCreated, s)
-}
-
-// DELETE /schedule/:id
-// Removes a schedule entry for a specific staff member based on staff_id (in URL),
-// shift_date and shift_time (as query parameters).
-// Example: DELETE /schedule/3?shift_date=Friday&shift_time=Night
-
-func removeFromSchedule(c *gin.Context) {
-	staffID := c.Param("id")
-	shiftDate := c.Query("shift_date")
-	shiftTime := c.Query("shift_time")
-
-	if shiftDate == "" || shiftTime == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing shift_date or shift_time query parameter"})
-		return
-	}
-
-	query := `
-		DELETE FROM Staff_Schedule
-		WHERE staff_id = ? AND shift_date = ? AND shift_time = ?
-	`
-	res, err := db.Exec(query, staffID, shiftDate, shiftTime)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "details": err.Error()})
-		return
-	}
-
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Schedule removed"})
-}
-
-// PUT /schedule/:id
-// Updates the shift_time for a specific staff member's schedule
-// using staff_id (in URL) and shift_date (in query parameter).
-// Example: PUT /schedule/3?shift_date=Friday&new_shift_time=Afternoon
-
-func updateSchedule(c *gin.Context) {
-	id := c.Param("id") // staff_id from URL
-
-	shiftDate := c.Query("shift_date")
-	newShiftTime := c.Query("new_shift_time")
-
-	if shiftDate == "" || newShiftTime == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing shift_date or new_shift_time in query parameters"})
-		return
-	}
-
-	query := `
-		UPDATE Staff_Schedule
-		SET shift_time = ?
-		WHERE staff_id = ? AND shift_date = ?
-	`
-
-	res, err := db.Exec(query, newShiftTime, id, shiftDate)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
-		return
-	}
-
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Shift time updated"})
-}
\ No newline at end of file
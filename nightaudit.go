@@ -0,0 +1,437 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chargeRoomNight is the Reservation_Charges.charge_type of the nightly room
+// charge posted by the night audit.
+const chargeRoomNight = "room_night"
+
+// Audit_Discrepancies.kind values.
+const (
+	// A guest is checked in to a room not marked Booked.
+	discrepancyRoomNotBooked = "room_not_booked"
+	// A room is marked Booked but no guest is checked in to it.
+	discrepancyRoomVacant = "room_vacant"
+	// A checked-in guest is past their check-out date.
+	discrepancyOverstay = "overstay"
+	// More than one checked-in reservation shares a room.
+	discrepancyDoubleOccupancy = "double_occupancy"
+)
+
+// errAuditTooEarly is returned when the open business date has not ended
+// yet, i.e. it is today or today's audit has already been run.
+var errAuditTooEarly = errors.New("the business date has not ended yet")
+
+// auditDue reports whether business date day may be closed at now: only
+// once the calendar day is over.
+func auditDue(day, now time.Time) bool {
+	return day.Format(dateLayout) < now.Format(dateLayout)
+}
+
+// initNightAudit schedules the night audit on NIGHT_AUDIT_SCHEDULE (default
+// 2am). Each run closes every business date before today, so days missed
+// while the service was down are caught up in order.
+func initNightAudit() {
+	registerJob("night-audit", "NIGHT_AUDIT_SCHEDULE", "0 2 * * *", func() error {
+		for {
+			now := time.Now()
+			day, err := currentBusinessDate(db)
+			if err != nil {
+				return err
+			}
+			if !auditDue(day, now) {
+				return nil
+			}
+			summary, err := runNightAudit(0, now)
+			if err != nil {
+				return err
+			}
+			log.Printf("Closed business date %s: %d room nights, %d discrepancies",
+				summary.BusinessDate, summary.RoomNights, summary.DiscrepancyCount)
+		}
+	})
+}
+
+// currentBusinessDate returns the open business date that charges post to,
+// opening today if no day has been opened yet. The read is a locking one so
+// a charge cannot post to a day the night audit is closing.
+func currentBusinessDate(q queryExecer) (time.Time, error) {
+	var day time.Time
+	err := q.QueryRow("SELECT business_date FROM Business_Days WHERE status = 'open' LOCK IN SHARE MODE").Scan(&day)
+	if err == sql.ErrNoRows {
+		day, _ = time.Parse(dateLayout, time.Now().Format(dateLayout))
+		_, err = q.Exec("INSERT IGNORE INTO Business_Days (business_date) VALUES (?)", day.Format(dateLayout))
+	}
+	return day, err
+}
+
+// paymentDayClosed reports whether the business date a payment was taken on
+// has been closed by the night audit, freezing the payment. The read is a
+// locking one so the audit cannot close the day until the caller commits.
+func paymentDayClosed(q queryExecer, paymentID int) (bool, error) {
+	var closed bool
+	err := q.QueryRow(`
+		SELECT d.status = 'closed' FROM Payments p
+		JOIN Business_Days d ON d.business_date = DATE(p.transaction_date)
+		WHERE p.payment_id = ? LOCK IN SHARE MODE`, paymentID).Scan(&closed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return closed, err
+}
+
+// postCharge adds a charge to a reservation, dated the open business date.
+func postCharge(q queryExecer, reservationID int, chargeType string, amount float64, description string) error {
+	day, err := currentBusinessDate(q)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("INSERT INTO Reservation_Charges (reservation_id, charge_type, amount, description, business_date) VALUES (?, ?, ?, ?, ?)",
+		reservationID, chargeType, amount, description, day.Format(dateLayout))
+	return err
+}
+
+// roomNightAmount is the share of total charged for night. Nights are
+// charged evenly, rounded to the cent, with the last night taking up the
+// rounding so the nights add up to the price booked.
+func roomNightAmount(total float64, stay stayRange, night time.Time) float64 {
+	n := stay.Nights()
+	if n <= 0 {
+		return 0
+	}
+	rate := math.Round(total/float64(n)*100) / 100
+	if night.Equal(stay.CheckOut.AddDate(0, 0, -1)) {
+		return math.Round((total-rate*float64(n-1))*100) / 100
+	}
+	return rate
+}
+
+// auditStay is a checked-in reservation as seen by the night audit.
+type auditStay struct {
+	ReservationID int
+	RoomID        int
+	RoomStatus    string
+	Stay          stayRange
+	Total         float64
+}
+
+// AuditDiscrepancy is a row of Audit_Discrepancies.
+type AuditDiscrepancy struct {
+	DiscrepancyID int    `json:"discrepancy_id,omitempty"`
+	Kind          string `json:"kind"`
+	RoomID        int    `json:"room_id"`
+	ReservationID *int   `json:"reservation_id,omitempty"`
+	Details       string `json:"details"`
+}
+
+// findDiscrepancies compares the checked-in reservations with room status on
+// day. bookedRooms are the rooms marked Booked.
+func findDiscrepancies(day time.Time, stays []auditStay, bookedRooms []int) []AuditDiscrepancy {
+	var found []AuditDiscrepancy
+	occupants := map[int][]int{}
+	for _, s := range stays {
+		id := s.ReservationID
+		occupants[s.RoomID] = append(occupants[s.RoomID], id)
+		if s.RoomStatus != "Booked" {
+			found = append(found, AuditDiscrepancy{Kind: discrepancyRoomNotBooked, RoomID: s.RoomID, ReservationID: &id,
+				Details: fmt.Sprintf("reservation %d is checked in but the room is %s", id, s.RoomStatus)})
+		}
+		if !day.Before(s.Stay.CheckOut) {
+			found = append(found, AuditDiscrepancy{Kind: discrepancyOverstay, RoomID: s.RoomID, ReservationID: &id,
+				Details: fmt.Sprintf("reservation %d was due to check out on %s", id, s.Stay.CheckOut.Format(dateLayout))})
+		}
+	}
+	for _, roomID := range bookedRooms {
+		if len(occupants[roomID]) == 0 {
+			found = append(found, AuditDiscrepancy{Kind: discrepancyRoomVacant, RoomID: roomID,
+				Details: "the room is marked Booked but no guest is checked in"})
+		}
+	}
+	for _, s := range stays {
+		ids := occupants[s.RoomID]
+		if len(ids) > 1 && ids[0] == s.ReservationID {
+			found = append(found, AuditDiscrepancy{Kind: discrepancyDoubleOccupancy, RoomID: s.RoomID,
+				Details: fmt.Sprintf("reservations %v are all checked in", ids)})
+		}
+	}
+	return found
+}
+
+// DayClose is a row of Business_Days: the summary written when the night
+// audit closes a business date.
+type DayClose struct {
+	BusinessDate     string             `json:"business_date"`
+	Status           string             `json:"status"`
+	RoomNights       int                `json:"room_nights"`
+	RoomRevenue      float64            `json:"room_revenue"`
+	OtherCharges     float64            `json:"other_charges"`
+	Payments         float64            `json:"payments"`
+	RoomsTotal       int                `json:"rooms_total"`
+	RoomsOutOfOrder  int                `json:"rooms_out_of_order"`
+	OccupancyPercent float64            `json:"occupancy_percent"`
+	Arrivals         int                `json:"arrivals"`
+	Departures       int                `json:"departures"`
+	NoShows          int                `json:"no_shows"`
+	Cancellations    int                `json:"cancellations"`
+	DiscrepancyCount int                `json:"discrepancy_count"`
+	Discrepancies    []AuditDiscrepancy `json:"discrepancies,omitempty"`
+	ClosedBy         *int               `json:"closed_by,omitempty"`
+	ClosedAt         *time.Time         `json:"closed_at,omitempty"`
+}
+
+// runNightAudit closes the open business date: it posts a room-night charge
+// for every checked-in reservation, records discrepancies, writes the
+// day-close summary and opens the next day. closedBy is 0 for the scheduled
+// run.
+func runNightAudit(closedBy int, now time.Time) (DayClose, error) {
+	var summary DayClose
+	tx, err := db.Begin()
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	if _, err := currentBusinessDate(tx); err != nil {
+		return summary, err
+	}
+	var day time.Time
+	if err := tx.QueryRow("SELECT business_date FROM Business_Days WHERE status = 'open' FOR UPDATE").Scan(&day); err != nil {
+		return summary, err
+	}
+	if !auditDue(day, now) {
+		return summary, errAuditTooEarly
+	}
+	date := day.Format(dateLayout)
+	summary.BusinessDate = date
+
+	rows, err := tx.Query(`
+		SELECT r.reservation_id, r.room_id, COALESCE(rm.status, 'Available'), r.check_in_date, r.check_out_date, r.total_price
+		FROM Reservations r JOIN Rooms rm ON rm.room_id = r.room_id
+		WHERE r.status = 'Checked-in' AND r.check_in_date <= ?
+		ORDER BY r.reservation_id
+		FOR UPDATE`, date)
+	if err != nil {
+		return summary, err
+	}
+	var stays []auditStay
+	for rows.Next() {
+		var s auditStay
+		if err := rows.Scan(&s.ReservationID, &s.RoomID, &s.RoomStatus, &s.Stay.CheckIn, &s.Stay.CheckOut, &s.Total); err != nil {
+			rows.Close()
+			return summary, err
+		}
+		stays = append(stays, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	rows, err = tx.Query("SELECT room_id FROM Rooms WHERE status = 'Booked' ORDER BY room_id")
+	if err != nil {
+		return summary, err
+	}
+	var booked []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return summary, err
+		}
+		booked = append(booked, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	for _, s := range stays {
+		if !day.Before(s.Stay.CheckOut) {
+			continue // an overstay, flagged below, has no booked rate to charge
+		}
+		amount := roomNightAmount(s.Total, s.Stay, day)
+		// The unique key on (reservation_id, charge_type, business_date) keeps
+		// a night from being charged twice.
+		result, err := tx.Exec(`INSERT IGNORE INTO Reservation_Charges (reservation_id, charge_type, amount, description, business_date)
+			VALUES (?, ?, ?, ?, ?)`, s.ReservationID, chargeRoomNight, amount, "Room night "+date, date)
+		if err != nil {
+			return summary, err
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			summary.RoomNights++
+			summary.RoomRevenue += amount
+		}
+	}
+
+	summary.Discrepancies = findDiscrepancies(day, stays, booked)
+	summary.DiscrepancyCount = len(summary.Discrepancies)
+	for _, d := range summary.Discrepancies {
+		if _, err := tx.Exec("INSERT INTO Audit_Discrepancies (business_date, kind, room_id, reservation_id, details) VALUES (?, ?, ?, ?, ?)",
+			date, d.Kind, d.RoomID, d.ReservationID, d.Details); err != nil {
+			return summary, err
+		}
+	}
+
+	err = tx.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM Rooms),
+			(SELECT COUNT(*) FROM Rooms WHERE status = 'Maintenance'),
+			(SELECT COALESCE(SUM(amount), 0) FROM Reservation_Charges WHERE business_date = ? AND charge_type <> ?),
+			(SELECT COALESCE(SUM(amount), 0) FROM Payments WHERE payment_status = 'Completed' AND DATE(transaction_date) = ?),
+			(SELECT COUNT(*) FROM Reservations WHERE check_in_date = ? AND status IN ('Checked-in', 'Checked-out')),
+			(SELECT COUNT(*) FROM Reservations WHERE check_out_date = ? AND status = 'Checked-out'),
+			(SELECT COUNT(*) FROM Reservations WHERE check_in_date = ? AND status = 'No-show'),
+			(SELECT COUNT(*) FROM Reservations WHERE DATE(cancelled_at) = ?)`,
+		date, chargeRoomNight, date, date, date, date, date).
+		Scan(&summary.RoomsTotal, &summary.RoomsOutOfOrder, &summary.OtherCharges, &summary.Payments,
+			&summary.Arrivals, &summary.Departures, &summary.NoShows, &summary.Cancellations)
+	if err != nil {
+		return summary, err
+	}
+	if sellable := summary.RoomsTotal - summary.RoomsOutOfOrder; sellable > 0 {
+		summary.OccupancyPercent = math.Round(float64(summary.RoomNights)/float64(sellable)*10000) / 100
+	}
+	summary.RoomRevenue = math.Round(summary.RoomRevenue*100) / 100
+
+	summary.Status = "closed"
+	summary.ClosedAt = &now
+	if closedBy > 0 {
+		summary.ClosedBy = &closedBy
+	}
+	_, err = tx.Exec(`
+		UPDATE Business_Days SET status = 'closed', room_nights = ?, room_revenue = ?, other_charges = ?, payments = ?,
+			rooms_total = ?, rooms_out_of_order = ?, occupancy_percent = ?, arrivals = ?, departures = ?, no_shows = ?,
+			cancellations = ?, discrepancies = ?, closed_by = ?, closed_at = ?
+		WHERE business_date = ?`,
+		summary.RoomNights, summary.RoomRevenue, summary.OtherCharges, summary.Payments,
+		summary.RoomsTotal, summary.RoomsOutOfOrder, summary.OccupancyPercent, summary.Arrivals, summary.Departures, summary.NoShows,
+		summary.Cancellations, summary.DiscrepancyCount, summary.ClosedBy, now, date)
+	if err != nil {
+		return summary, err
+	}
+	if _, err := tx.Exec("INSERT INTO Business_Days (business_date) VALUES (?)", day.AddDate(0, 0, 1).Format(dateLayout)); err != nil {
+		return summary, err
+	}
+	return summary, tx.Commit()
+}
+
+// getBusinessDate handles GET /business-date
+func getBusinessDate(c *gin.Context) {
+	day, err := currentBusinessDate(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching business date", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"business_date": day.Format(dateLayout)})
+}
+
+// closeBusinessDay handles POST /night-audit
+// Runs the night audit now rather than waiting for the scheduled run.
+func closeBusinessDay(c *gin.Context) {
+	summary, err := runNightAudit(c.GetInt("user_id"), time.Now())
+	if errors.Is(err, errAuditTooEarly) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The open business date has not ended yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error running night audit", "details": err.Error()})
+		return
+	}
+	recordAudit(auditNightAudit, c.GetInt("user_id"), summary.BusinessDate, c.ClientIP(),
+		fmt.Sprintf("%d room nights, %d discrepancies", summary.RoomNights, summary.DiscrepancyCount))
+	c.JSON(http.StatusOK, summary)
+}
+
+// dayCloseColumns are the Business_Days columns scanned by scanDayClose.
+const dayCloseColumns = `business_date, status, room_nights, room_revenue, other_charges, payments, rooms_total,
+	rooms_out_of_order, occupancy_percent, arrivals, departures, no_shows, cancellations, discrepancies, closed_by, closed_at`
+
+func scanDayClose(row interface{ Scan(...interface{}) error }) (DayClose, error) {
+	var d DayClose
+	var day time.Time
+	err := row.Scan(&day, &d.Status, &d.RoomNights, &d.RoomRevenue, &d.OtherCharges, &d.Payments, &d.RoomsTotal,
+		&d.RoomsOutOfOrder, &d.OccupancyPercent, &d.Arrivals, &d.Departures, &d.NoShows, &d.Cancellations,
+		&d.DiscrepancyCount, &d.ClosedBy, &d.ClosedAt)
+	d.BusinessDate = day.Format(dateLayout)
+	return d, err
+}
+
+// getDayCloses handles GET /day-closes
+// Lists closed business dates, newest first; ?from= and ?to= bound the dates.
+func getDayCloses(c *gin.Context) {
+	query := "SELECT " + dayCloseColumns + " FROM Business_Days WHERE status = 'closed'"
+	var args []interface{}
+	for param, cond := range map[string]string{"from": " AND business_date >= ?", "to": " AND business_date <= ?"} {
+		if v := c.Query(param); v != "" {
+			if _, err := time.Parse(dateLayout, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a YYYY-MM-DD date"})
+				return
+			}
+			query += cond
+			args = append(args, v)
+		}
+	}
+	rows, err := db.Query(query+" ORDER BY business_date DESC LIMIT 366", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching day closes", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	closes := []DayClose{}
+	for rows.Next() {
+		d, err := scanDayClose(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning day close", "details": err.Error()})
+			return
+		}
+		closes = append(closes, d)
+	}
+	c.JSON(http.StatusOK, closes)
+}
+
+// getDayClose handles GET /day-closes/:date
+// Returns the day's summary with the discrepancies the audit found.
+func getDayClose(c *gin.Context) {
+	date := c.Param("date")
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be a YYYY-MM-DD date"})
+		return
+	}
+	d, err := scanDayClose(db.QueryRow("SELECT "+dayCloseColumns+" FROM Business_Days WHERE business_date = ? AND status = 'closed'", date))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No day close for that date"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching day close", "details": err.Error()})
+		return
+	}
+
+	rows, err := db.Query("SELECT discrepancy_id, kind, room_id, reservation_id, details FROM Audit_Discrepancies WHERE business_date = ? ORDER BY discrepancy_id", date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching discrepancies", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+	d.Discrepancies = []AuditDiscrepancy{}
+	for rows.Next() {
+		var a AuditDiscrepancy
+		if err := rows.Scan(&a.DiscrepancyID, &a.Kind, &a.RoomID, &a.ReservationID, &a.Details); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning discrepancy", "details": err.Error()})
+			return
+		}
+		d.Discrepancies = append(d.Discrepancies, a)
+	}
+	c.JSON(http.StatusOK, d)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoomNightAmount(t *testing.T) {
+	stay, err := parseStay("2025-09-10", "2025-09-13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		total float64
+		night string
+		want  float64
+	}{
+		{300, "2025-09-10", 100},
+		{300, "2025-09-12", 100},
+		// 100/3 rounds to 33.33; the last night takes the extra cent.
+		{100, "2025-09-10", 33.33},
+		{100, "2025-09-11", 33.33},
+		{100, "2025-09-12", 33.34},
+	}
+	for _, test := range tests {
+		night, _ := time.Parse(dateLayout, test.night)
+		if got := roomNightAmount(test.total, stay, night); got != test.want {
+			t.Errorf("%.2f on %s: expected %.2f, got %.2f", test.total, test.night, test.want, got)
+		}
+	}
+}
+
+func TestFindDiscrepancies(t *testing.T) {
+	day, _ := time.Parse(dateLayout, "2025-09-11")
+	stay := func(in, out string) stayRange {
+		s, err := parseStay(in, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	stays := []auditStay{
+		{ReservationID: 1, RoomID: 101, RoomStatus: "Booked", Stay: stay("2025-09-10", "2025-09-12")},
+		{ReservationID: 2, RoomID: 102, RoomStatus: "Available", Stay: stay("2025-09-10", "2025-09-12")},
+		{ReservationID: 3, RoomID: 103, RoomStatus: "Booked", Stay: stay("2025-09-09", "2025-09-11")},
+		{ReservationID: 4, RoomID: 104, RoomStatus: "Booked", Stay: stay("2025-09-10", "2025-09-14")},
+		{ReservationID: 5, RoomID: 104, RoomStatus: "Booked", Stay: stay("2025-09-11", "2025-09-13")},
+	}
+	got := findDiscrepancies(day, stays, []int{101, 103, 104, 105})
+
+	want := []struct {
+		kind   string
+		roomID int
+	}{
+		{discrepancyRoomNotBooked, 102},
+		{discrepancyOverstay, 103},
+		{discrepancyRoomVacant, 105},
+		{discrepancyDoubleOccupancy, 104},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d discrepancies, got %d: %+v", len(want), len(got), got)
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || got[i].RoomID != w.roomID {
+			t.Errorf("discrepancy %d: expected %s on room %d, got %s on room %d", i, w.kind, w.roomID, got[i].Kind, got[i].RoomID)
+		}
+	}
+}
+
+func TestAuditDue(t *testing.T) {
+	day, _ := time.Parse(dateLayout, "2025-09-10")
+	tests := []struct {
+		now  time.Time
+		want bool
+	}{
+		// A second run after midnight must not close the day just begun.
+		{time.Date(2025, 9, 10, 0, 5, 0, 0, time.Local), false},
+		{time.Date(2025, 9, 10, 23, 59, 0, 0, time.Local), false},
+		{time.Date(2025, 9, 11, 2, 0, 0, 0, time.Local), true},
+		{time.Date(2025, 9, 14, 2, 0, 0, 0, time.Local), true},
+		{time.Date(2025, 9, 9, 23, 0, 0, 0, time.Local), false},
+	}
+	for _, test := range tests {
+		if got := auditDue(day, test.now); got != test.want {
+			t.Errorf("closing %s at %s: expected %v, got %v", day.Format(dateLayout), test.now.Format(time.DateTime), test.want, got)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chargeNoShow is the Reservation_Charges.charge_type of a no-show penalty.
+const chargeNoShow = "no_show"
+
+// noShowCutoff is how long after the start of its check-in date a confirmed
+// reservation that has not checked in becomes a no-show. The default of 30h
+// is 6am the next morning.
+var noShowCutoff = 30 * time.Hour
+
+// initNoShowJob reads NO_SHOW_CUTOFF and schedules the no-show job on
+// NO_SHOW_INTERVAL (default five past every hour).
+func initNoShowJob() {
+	if v := os.Getenv("NO_SHOW_CUTOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatal("NO_SHOW_CUTOFF must be a positive duration")
+		}
+		noShowCutoff = d
+	}
+
+	registerJob("no-show-detection", "NO_SHOW_INTERVAL", "5 * * * *", func() error {
+		n, err := markNoShows(time.Now())
+		if n > 0 {
+			log.Printf("Marked %d reservations as no-shows", n)
+		}
+		return err
+	})
+}
+
+// noShowLastCheckIn is the latest check-in date that is a no-show at now.
+func noShowLastCheckIn(now time.Time) string {
+	return now.Add(-noShowCutoff).Format(dateLayout)
+}
+
+// noShow is the outcome of marking a reservation as a no-show: the penalty
+// charged and the nights of its room that were released.
+type noShow struct {
+	penalty  float64
+	roomID   int
+	released stayRange
+}
+
+// markNoShows marks confirmed reservations past the cutoff as No-show, posts
+// the no-show penalty from the policy captured at booking, and offers the
+// nights from today on to the waitlist.
+func markNoShows(now time.Time) (int, error) {
+	rows, err := db.Query("SELECT reservation_id FROM Reservations WHERE status = 'Confirmed' AND check_in_date <= ?",
+		noShowLastCheckIn(now))
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		ns, ok, err := markNoShow(id, now)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			continue
+		}
+		n++
+		if ns.released.CheckOut.After(ns.released.CheckIn) {
+			releaseToWaitlist(ns.roomID, ns.released)
+		}
+	}
+	return n, nil
+}
+
+// markNoShow marks one reservation as a no-show in its own transaction. It
+// reports false if the reservation was checked in or changed meanwhile.
+func markNoShow(reservationID int, now time.Time) (noShow, bool, error) {
+	var ns noShow
+	tx, err := db.Begin()
+	if err != nil {
+		return ns, false, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var total float64
+	var stay stayRange
+	err = tx.QueryRow(`SELECT room_id, status, check_in_date, check_out_date, total_price
+		FROM Reservations WHERE reservation_id = ? FOR UPDATE`, reservationID).
+		Scan(&ns.roomID, &status, &stay.CheckIn, &stay.CheckOut, &total)
+	if err != nil {
+		return ns, false, err
+	}
+	if status != "Confirmed" || stay.CheckIn.Format(dateLayout) > noShowLastCheckIn(now) {
+		return ns, false, nil
+	}
+
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'No-show', no_show_at = ? WHERE reservation_id = ?", now, reservationID); err != nil {
+		return ns, false, err
+	}
+	policy, err := reservationPolicy(tx, reservationID)
+	if err != nil {
+		return ns, false, err
+	}
+	if policy != nil {
+		ns.penalty = penaltyAmount(policy.NoShowPenalty, total, stay)
+	}
+	if ns.penalty > 0 {
+		if err := postCharge(tx, reservationID, chargeNoShow, ns.penalty, "No-show under "+policy.Name+" policy"); err != nil {
+			return ns, false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return ns, false, err
+	}
+
+	today, _ := time.Parse(dateLayout, now.Format(dateLayout))
+	ns.released = stayRange{CheckIn: today, CheckOut: stay.CheckOut}
+	if stay.CheckIn.After(today) {
+		ns.released.CheckIn = stay.CheckIn
+	}
+	return ns, true, nil
+}
+
+// scanNoShows handles POST /no-shows/scan
+// Runs the no-show job immediately.
+func scanNoShows(c *gin.Context) {
+	n, err := markNoShows(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error marking no-shows", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"no_shows": n})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoShowLastCheckIn(t *testing.T) {
+	saved := noShowCutoff
+	defer func() { noShowCutoff = saved }()
+	noShowCutoff = 30 * time.Hour
+
+	tests := []struct {
+		now  string
+		want string
+	}{
+		// A 2025-09-10 arrival becomes a no-show at 06:00 on the 11th.
+		{"2025-09-11 05:59", "2025-09-09"},
+		{"2025-09-11 06:00", "2025-09-10"},
+		{"2025-09-11 23:00", "2025-09-10"},
+	}
+	for _, test := range tests {
+		now, err := time.Parse("2006-01-02 15:04", test.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := noShowLastCheckIn(now); got != test.want {
+			t.Errorf("at %s: expected %s, got %s", test.now, test.want, got)
+		}
+	}
+}
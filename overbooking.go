@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxOverbookingPercent caps the allowance staff can set for a room type.
+const maxOverbookingPercent = 50
+
+// OverbookingAllowance is a row of Overbooking_Allowances: how far beyond its
+// room count a room type may be booked each night.
+type OverbookingAllowance struct {
+	RoomType  string    `json:"room_type"`
+	Percent   float64   `json:"percent"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OverbookedNight is a night on which a room type has more reservations than
+// rooms to put them in.
+type OverbookedNight struct {
+	Date         string `json:"date"`
+	RoomType     string `json:"room_type"`
+	Rooms        int    `json:"rooms"`
+	Booked       int    `json:"booked"`
+	OverbookedBy int    `json:"overbooked_by"`
+}
+
+// overbookingLimit is the number of reservations rooms can take on one night
+// with a pct allowance.
+func overbookingLimit(rooms int, pct float64) int {
+	// The epsilon keeps e.g. 20 rooms at 15% at 23 despite float rounding.
+	return int(math.Floor(float64(rooms)*(100+pct)/100 + 1e-9))
+}
+
+// nightlyCounts returns how many stays cover each night of window.
+func nightlyCounts(stays []stayRange, window stayRange) []int {
+	counts := make([]int, window.Nights())
+	for _, s := range stays {
+		for i := range counts {
+			night := window.CheckIn.AddDate(0, 0, i)
+			if !night.Before(s.CheckIn) && night.Before(s.CheckOut) {
+				counts[i]++
+			}
+		}
+	}
+	return counts
+}
+
+// projectOverbookedNights lists the nights of window on which a room type has
+// more stays than rooms, in date then room type order.
+func projectOverbookedNights(rooms map[string]int, stays map[string][]stayRange, window stayRange) []OverbookedNight {
+	nights := []OverbookedNight{}
+	for roomType, typeStays := range stays {
+		for i, booked := range nightlyCounts(typeStays, window) {
+			if booked > rooms[roomType] {
+				nights = append(nights, OverbookedNight{
+					Date:         window.CheckIn.AddDate(0, 0, i).Format(dateLayout),
+					RoomType:     roomType,
+					Rooms:        rooms[roomType],
+					Booked:       booked,
+					OverbookedBy: booked - rooms[roomType],
+				})
+			}
+		}
+	}
+	sort.Slice(nights, func(i, j int) bool {
+		if nights[i].Date != nights[j].Date {
+			return nights[i].Date < nights[j].Date
+		}
+		return nights[i].RoomType < nights[j].RoomType
+	})
+	return nights
+}
+
+// typeStays returns the occupying reservations of a room type that overlap
+// window.
+func typeStays(q queryExecer, roomType string, window stayRange) ([]stayRange, error) {
+	rows, err := q.Query(`
+		SELECT res.check_in_date, res.check_out_date
+		FROM Reservations res JOIN Rooms r ON r.room_id = res.room_id
+		WHERE r.room_type = ? AND res.status IN (`+occupyingStatuses+`)
+		  AND res.check_in_date < ? AND res.check_out_date > ?`,
+		roomType, window.CheckOut.Format(dateLayout), window.CheckIn.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stays []stayRange
+	for rows.Next() {
+		var s stayRange
+		if err := rows.Scan(&s.CheckIn, &s.CheckOut); err != nil {
+			return nil, err
+		}
+		stays = append(stays, s)
+	}
+	return stays, rows.Err()
+}
+
+// overbookingCapacity returns how many more reservations of a room type the
+// overbooking allowance accepts on the busiest night of stay. It is zero or
+// less when the type has no allowance or it is used up.
+func overbookingCapacity(q queryExecer, roomType string, stay stayRange) (int, error) {
+	var pct float64
+	err := q.QueryRow("SELECT percent FROM Overbooking_Allowances WHERE room_type = ?", roomType).Scan(&pct)
+	if err == sql.ErrNoRows || (err == nil && pct <= 0) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var rooms int
+	if err := q.QueryRow("SELECT COUNT(*) FROM Rooms WHERE room_type = ? AND status <> 'Maintenance'", roomType).Scan(&rooms); err != nil {
+		return 0, err
+	}
+	stays, err := typeStays(q, roomType, stay)
+	if err != nil {
+		return 0, err
+	}
+	peak := 0
+	for _, n := range nightlyCounts(stays, stay) {
+		peak = max(peak, n)
+	}
+	return overbookingLimit(rooms, pct) - peak, nil
+}
+
+// canOverbook decides whether a stay may be booked into roomID even though
+// roomConflict found it already reserved. Guests are only overbooked once
+// every room of the type is taken. The allowance row is locked so concurrent
+// overbookings of a type are counted one at a time.
+func canOverbook(tx *sql.Tx, roomID int, stay stayRange) (bool, error) {
+	var roomType string
+	if err := tx.QueryRow("SELECT room_type FROM Rooms WHERE room_id = ?", roomID).Scan(&roomType); err != nil {
+		return false, err
+	}
+	var locked string
+	err := tx.QueryRow("SELECT room_type FROM Overbooking_Allowances WHERE room_type = ? FOR UPDATE", roomType).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	free, err := freeRoomCount(tx, roomType, stay)
+	if err != nil || free > 0 {
+		return false, err
+	}
+	remaining, err := overbookingCapacity(tx, roomType, stay)
+	return remaining > 0, err
+}
+
+// getOverbookingAllowances handles GET /overbooking
+func getOverbookingAllowances(c *gin.Context) {
+	rows, err := db.Query("SELECT room_type, percent, updated_at FROM Overbooking_Allowances ORDER BY room_type")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching overbooking allowances", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	allowances := []OverbookingAllowance{}
+	for rows.Next() {
+		var a OverbookingAllowance
+		if err := rows.Scan(&a.RoomType, &a.Percent, &a.UpdatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning overbooking allowance", "details": err.Error()})
+			return
+		}
+		allowances = append(allowances, a)
+	}
+	c.JSON(http.StatusOK, allowances)
+}
+
+// updateOverbookingAllowance handles PUT /overbooking/:room_type
+func updateOverbookingAllowance(c *gin.Context) {
+	roomType := c.Param("room_type")
+	if !roomTypes[roomType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "room_type must be Single, Double, Suite or Deluxe"})
+		return
+	}
+	var req struct {
+		Percent *float64 `json:"percent"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Percent == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percent is required"})
+		return
+	}
+	if *req.Percent < 0 || *req.Percent > maxOverbookingPercent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percent must be between 0 and 50"})
+		return
+	}
+
+	_, err := db.Exec(`INSERT INTO Overbooking_Allowances (room_type, percent) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE percent = VALUES(percent)`, roomType, *req.Percent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating overbooking allowance", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, OverbookingAllowance{RoomType: roomType, Percent: *req.Percent, UpdatedAt: time.Now()})
+}
+
+// getOverbookingReport handles GET /overbooking/report
+// Lists nights between ?from= and ?to= (default the next 30 days, at most a
+// year) on which a room type has more reservations than rooms, i.e. guests
+// who will have to be walked unless others cancel or no-show.
+func getOverbookingReport(c *gin.Context) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today.Format(dateLayout), today.AddDate(0, 0, 30).Format(dateLayout)
+	if v := c.Query("from"); v != "" {
+		from = v
+	}
+	if v := c.Query("to"); v != "" {
+		to = v
+	}
+	window, err := parseStay(from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be dates in YYYY-MM-DD format with to after from"})
+		return
+	}
+	if window.Nights() > 366 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The report covers at most a year"})
+		return
+	}
+
+	rooms := map[string]int{}
+	stays := map[string][]stayRange{}
+	for roomType := range roomTypes {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM Rooms WHERE room_type = ? AND status <> 'Maintenance'", roomType).Scan(&n); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting rooms", "details": err.Error()})
+			return
+		}
+		rooms[roomType] = n
+		if stays[roomType], err = typeStays(db, roomType, window); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reservations", "details": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   window.CheckIn.Format(dateLayout),
+		"to":     window.CheckOut.Format(dateLayout),
+		"nights": projectOverbookedNights(rooms, stays, window),
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestOverbookingLimit(t *testing.T) {
+	tests := []struct {
+		rooms int
+		pct   float64
+		want  int
+	}{
+		{10, 0, 10},
+		{10, 10, 11},
+		{20, 15, 23},
+		{7, 10, 7},
+		{7, 15, 8},
+		{0, 50, 0},
+	}
+	for _, test := range tests {
+		if got := overbookingLimit(test.rooms, test.pct); got != test.want {
+			t.Errorf("%d rooms at %v%%: expected %d, got %d", test.rooms, test.pct, test.want, got)
+		}
+	}
+}
+
+func TestProjectOverbookedNights(t *testing.T) {
+	stay := func(in, out string) stayRange {
+		s, err := parseStay(in, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	window := stay("2025-07-01", "2025-07-05")
+	rooms := map[string]int{"Suite": 2, "Single": 1}
+	stays := map[string][]stayRange{
+		"Suite": {
+			stay("2025-06-29", "2025-07-03"),
+			stay("2025-07-01", "2025-07-02"),
+			stay("2025-07-02", "2025-07-06"),
+		},
+		"Single": {
+			stay("2025-07-04", "2025-07-05"),
+			stay("2025-07-04", "2025-07-08"),
+		},
+	}
+
+	got := projectOverbookedNights(rooms, stays, window)
+	want := []OverbookedNight{
+		{Date: "2025-07-04", RoomType: "Single", Rooms: 1, Booked: 2, OverbookedBy: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d overbooked nights, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("night %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	// A third overlapping suite on 2025-07-02 pushes that night over.
+	stays["Suite"] = append(stays["Suite"], stay("2025-07-02", "2025-07-03"))
+	got = projectOverbookedNights(rooms, stays, window)
+	if len(got) != 2 || got[0].Date != "2025-07-02" || got[0].RoomType != "Suite" || got[0].Booked != 3 {
+		t.Errorf("expected the suite night first, got %+v", got)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// listQuery is the parsed form of the list conventions shared by the
+// collection endpoints:
+//
+//	?limit=50            page size (1-200)
+//	?sort=-created_at    sort field, "-" prefix for descending
+//	?cursor=...          opaque next_cursor from the previous page
+type listQuery struct {
+	Limit   int
+	SortCol string
+	Desc    bool
+	IDCol   string
+	Cursor  *listCursor
+}
+
+// listCursor marks the last row of a page. Value is the row's sort column as
+// MySQL renders it with CAST(... AS CHAR), so it compares correctly when sent
+// back.
+type listCursor struct {
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// listPage is the response envelope for paginated lists.
+type listPage[T any] struct {
+	Data       []T     `json:"data"`
+	Total      int     `json:"total"`
+	Limit      int     `json:"limit"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// parseListQuery reads limit, sort and cursor. sortable maps the sort names
+// accepted from clients to SQL columns; idCol is the unique column used to
+// break ties so pages never overlap.
+func parseListQuery(c *gin.Context, sortable map[string]string, defaultSort, idCol string) (listQuery, error) {
+	q := listQuery{Limit: defaultListLimit, IDCol: idCol}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		q.Limit = n
+	}
+
+	field := c.DefaultQuery("sort", defaultSort)
+	if strings.HasPrefix(field, "-") {
+		q.Desc = true
+		field = field[1:]
+	}
+	col, ok := sortable[field]
+	if !ok {
+		names := make([]string, 0, len(sortable))
+		for name := range sortable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return q, fmt.Errorf("sort must be one of %s (prefix with - for descending)", strings.Join(names, ", "))
+	}
+	q.SortCol = col
+
+	if v := c.Query("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid cursor")
+		}
+		var cur listCursor
+		if err := json.Unmarshal(raw, &cur); err != nil {
+			return q, fmt.Errorf("invalid cursor")
+		}
+		q.Cursor = &cur
+	}
+	return q, nil
+}
+
+// sortValueExpr is selected alongside each row so the next cursor can be built.
+func (q listQuery) sortValueExpr() string {
+	return "CAST(" + q.SortCol + " AS CHAR)"
+}
+
+// keyset returns the condition (to append after another condition) that
+// starts the page after the cursor.
+func (q listQuery) keyset() (string, []interface{}) {
+	if q.Cursor == nil {
+		return "", nil
+	}
+	op := ">"
+	if q.Desc {
+		op = "<"
+	}
+	cond := fmt.Sprintf(" AND (%s %s ? OR (%s = ? AND %s %s ?))", q.SortCol, op, q.SortCol, q.IDCol, op)
+	return cond, []interface{}{q.Cursor.Value, q.Cursor.Value, q.Cursor.ID}
+}
+
+// orderLimit returns the ORDER BY and LIMIT clause. One extra row is fetched
+// to tell whether another page exists.
+func (q listQuery) orderLimit() string {
+	dir := "ASC"
+	if q.Desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", q.SortCol, dir, q.IDCol, dir, q.Limit+1)
+}
+
+// newListPage trims the extra row fetched by orderLimit and builds the
+// envelope. keys holds the cursor for each item, in the same order.
+func newListPage[T any](items []T, keys []listCursor, q listQuery, total int) listPage[T] {
+	page := listPage[T]{Data: items, Total: total, Limit: q.Limit}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	if len(items) > q.Limit {
+		page.Data = items[:q.Limit]
+		raw, _ := json.Marshal(keys[q.Limit-1])
+		next := base64.RawURLEncoding.EncodeToString(raw)
+		page.NextCursor = &next
+	}
+	return page
+}
+
+// searchTerms splits a free-text query into alphanumeric words.
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// fullTextMatch returns a condition searching cols for every word in q, using
+// the FULLTEXT index on those columns when every word is long enough to be
+// indexed and falling back to LIKE otherwise.
+func fullTextMatch(q string, cols ...string) (string, []interface{}) {
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return "", nil
+	}
+
+	// InnoDB does not index words shorter than innodb_ft_min_token_size (3).
+	indexed := true
+	for _, t := range terms {
+		if len([]rune(t)) < 3 {
+			indexed = false
+			break
+		}
+	}
+
+	if indexed {
+		parts := make([]string, len(terms))
+		for i, t := range terms {
+			parts[i] = "+" + t + "*"
+		}
+		return fmt.Sprintf(" AND MATCH(%s) AGAINST (? IN BOOLEAN MODE)", strings.Join(cols, ", ")),
+			[]interface{}{strings.Join(parts, " ")}
+	}
+
+	var cond strings.Builder
+	var args []interface{}
+	haystack := "CONCAT_WS(' ', " + strings.Join(cols, ", ") + ")"
+	for _, t := range terms {
+		cond.WriteString(" AND " + haystack + " LIKE ?")
+		args = append(args, "%"+t+"%")
+	}
+	return cond.String(), args
+}
+
+// equalityFilters returns conditions for each query parameter in filters
+// (parameter name to SQL column) that is present in the request.
+func equalityFilters(c *gin.Context, filters map[string]string) (string, []interface{}) {
+	var cond strings.Builder
+	var args []interface{}
+	for param, col := range filters {
+		if v, ok := c.GetQuery(param); ok && v != "" {
+			cond.WriteString(" AND " + col + " = ?")
+			args = append(args, v)
+		}
+	}
+	return cond.String(), args
+}
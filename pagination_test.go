@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newListContext(target string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
+
+func TestListCursorRoundTrip(t *testing.T) {
+	sorts := map[string]string{"last_name": "last_name", "guest_id": "guest_id"}
+
+	c := newListContext("/guests?limit=2&sort=-last_name")
+	lq, err := parseListQuery(c, sorts, "last_name", "guest_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lq.Limit != 2 || lq.SortCol != "last_name" || !lq.Desc {
+		t.Fatalf("unexpected query %+v", lq)
+	}
+
+	// Three rows for a limit of two: the extra row is trimmed and signals a next page.
+	items := []string{"c", "b", "a"}
+	keys := []listCursor{{"Smith", 3}, {"Jones", 7}, {"Doe", 1}}
+	page := newListPage(items, keys, lq, 3)
+	if len(page.Data) != 2 || page.NextCursor == nil {
+		t.Fatalf("expected two items and a next cursor, got %+v", page)
+	}
+
+	c = newListContext("/guests?limit=2&sort=-last_name&cursor=" + *page.NextCursor)
+	lq, err = parseListQuery(c, sorts, "last_name", "guest_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lq.Cursor == nil || *lq.Cursor != keys[1] {
+		t.Fatalf("cursor did not round trip: %+v", lq.Cursor)
+	}
+	cond, args := lq.keyset()
+	if cond != " AND (last_name < ? OR (last_name = ? AND guest_id < ?))" || len(args) != 3 {
+		t.Errorf("unexpected keyset %q %v", cond, args)
+	}
+
+	last := newListPage(items[:1], keys[:1], lq, 3)
+	if last.NextCursor != nil {
+		t.Errorf("expected no next cursor on the last page")
+	}
+}
+
+func TestParseListQueryRejectsBadInput(t *testing.T) {
+	sorts := map[string]string{"guest_id": "guest_id"}
+	for _, target := range []string{
+		"/guests?limit=0",
+		"/guests?limit=1000",
+		"/guests?sort=password_hash",
+		"/guests?cursor=not-a-cursor",
+	} {
+		if _, err := parseListQuery(newListContext(target), sorts, "guest_id", "guest_id"); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+}
+
+func TestFullTextMatchFallsBackForShortTerms(t *testing.T) {
+	cond, args := fullTextMatch("ann smith", "first_name", "last_name")
+	if cond != " AND MATCH(first_name, last_name) AGAINST (? IN BOOLEAN MODE)" || args[0] != "+ann* +smith*" {
+		t.Errorf("unexpected full-text condition %q %v", cond, args)
+	}
+
+	cond, args = fullTextMatch("jo", "first_name", "last_name")
+	if cond != " AND CONCAT_WS(' ', first_name, last_name) LIKE ?" || args[0] != "%jo%" {
+		t.Errorf("unexpected fallback condition %q %v", cond, args)
+	}
+
+	if cond, _ := fullTextMatch("  ", "first_name"); cond != "" {
+		t.Errorf("expected no condition for an empty query, got %q", cond)
+	}
+}
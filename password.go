@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the longest password bcrypt will hash.
+const bcryptMaxBytes = 72
+
+// passwordPolicy holds the rules checked by validatePassword.
+type passwordPolicy struct {
+	minLength int
+	// breached holds upper-case hex SHA-1 hashes of known breached passwords.
+	breached map[string]struct{}
+}
+
+var passwordRules = passwordPolicy{minLength: 8}
+
+// initPasswordPolicy reads PASSWORD_MIN_LENGTH and loads the optional
+// breached-password list named by PASSWORD_BREACHED_LIST.
+func initPasswordPolicy() {
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > bcryptMaxBytes {
+			log.Fatalf("PASSWORD_MIN_LENGTH must be between 1 and %d", bcryptMaxBytes)
+		}
+		passwordRules.minLength = n
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		breached, err := loadBreachedPasswords(path)
+		if err != nil {
+			log.Fatal("Error loading PASSWORD_BREACHED_LIST:", err)
+		}
+		passwordRules.breached = breached
+		log.Printf("Loaded %d breached passwords", len(breached))
+	}
+}
+
+// loadBreachedPasswords reads a breached-password file. Each line is either a
+// plain password or a SHA-1 hash in the Have I Been Pwned "HASH:count" format,
+// so the offline HIBP download can be used directly.
+func loadBreachedPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			breached[strings.ToUpper(hash)] = struct{}{}
+		} else {
+			breached[sha1Hex(line)] = struct{}{}
+		}
+	}
+	return breached, scanner.Err()
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// minEmailLocalInPassword is the shortest email local part validate looks
+// for in a password.
+const minEmailLocalInPassword = 4
+
+// validate returns a user-facing error when password breaks the policy.
+func (p passwordPolicy) validate(password, email string) error {
+	if utf8.RuneCountInString(password) < p.minLength {
+		return fmt.Errorf("Password must be at least %d characters long", p.minLength)
+	}
+	if len(password) > bcryptMaxBytes {
+		return fmt.Errorf("Password must be at most %d bytes long", bcryptMaxBytes)
+	}
+	// Very short local parts such as "a" would match almost any password.
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); utf8.RuneCountInString(local) >= minEmailLocalInPassword && strings.Contains(strings.ToLower(password), local) {
+		return errors.New("Password must not contain your email address")
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return errors.New("This password has appeared in a data breach; please choose a different one")
+	}
+	return nil
+}
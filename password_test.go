@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	contents := "password123\n" + sha1Hex("letmein-please") + ":4821\n"
+	if err := os.WriteFile(list, []byte(contents), 0600); err != nil {
+		t.Fatalf("Could not write breached list: %v", err)
+	}
+	breached, err := loadBreachedPasswords(list)
+	if err != nil {
+		t.Fatalf("loadBreachedPasswords: %v", err)
+	}
+	policy := passwordPolicy{minLength: 8, breached: breached}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		valid    bool
+	}{
+		{"empty", "", "johnsmith@example.com", false},
+		{"too short", "abc123", "johnsmith@example.com", false},
+		{"too long for bcrypt", string(make([]byte, 73)), "johnsmith@example.com", false},
+		{"contains email", "xXjohnsmithXx", "johnsmith@example.com", false},
+		{"short email local part", "correct horse battery", "a@example.com", true},
+		{"contains four letter local part", "my-jsmi-password", "jsmi@example.com", false},
+		{"breached plain entry", "password123", "johnsmith@example.com", false},
+		{"breached hash entry", "letmein-please", "johnsmith@example.com", false},
+		{"acceptable", "correct horse battery", "johnsmith@example.com", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.validate(test.password, test.email)
+			if test.valid && err != nil {
+				t.Errorf("%s: expected password to be accepted, got %v", test.name, err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("%s: expected password to be rejected", test.name)
+			}
+		})
+	}
+}
+
+func TestLockoutDurationBacksOffExponentially(t *testing.T) {
+	policy := lockoutPolicy{baseLockout: time.Minute, maxLockout: time.Hour}
+
+	expected := map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		6:  32 * time.Minute,
+		7:  time.Hour,
+		50: time.Hour,
+	}
+	for lockouts, want := range expected {
+		if got := policy.lockoutDuration(lockouts); got != want {
+			t.Errorf("lockout #%d: expected %v but got %v", lockouts, want, got)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// exportRows runs query and returns every row as a column-name keyed map, so
+// an export always includes all columns without a struct per table.
+func exportRows(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			// DECIMAL and VARCHAR columns arrive as []byte.
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// userExportFiles lists the files in a data export and the query for each.
+// Credentials (password hash, TOTP secret, recovery codes) are left out.
+var userExportFiles = []struct {
+	name  string
+	query string
+}{
+	{"account.json", "SELECT user_id, email, role, email_verified, totp_enabled, created_at FROM Users WHERE user_id = ?"},
+	{"preferences.json", "SELECT preferred_language, contact_method, marketing_opt_in, updated_at FROM User_Preferences WHERE user_id = ?"},
+	{"guests.json", "SELECT guest_id, first_name, last_name, email, phone FROM Guests WHERE user_id = ?"},
+	{"reservations.json", `SELECT r.* FROM Reservations r JOIN Guests g ON g.guest_id = r.guest_id WHERE g.user_id = ?`},
+	{"payments.json", `SELECT p.* FROM Payments p JOIN Reservations r ON r.reservation_id = p.reservation_id
+		JOIN Guests g ON g.guest_id = r.guest_id WHERE g.user_id = ?`},
+	{"guest_preferences.json", `SELECT p.guest_id, p.category, p.preference FROM Guest_Preferences p JOIN Guests g ON g.guest_id = p.guest_id WHERE g.user_id = ?`},
+	{"reservation_requests.json", `SELECT q.* FROM Reservation_Requests q JOIN Reservations r ON r.reservation_id = q.reservation_id
+		JOIN Guests g ON g.guest_id = r.guest_id WHERE g.user_id = ?`},
+	{"reviews.json", `SELECT v.* FROM Reviews v JOIN Guests g ON g.guest_id = v.guest_id WHERE g.user_id = ?`},
+	{"loyalty_ledger.json", "SELECT entry_type, points, reservation_id, payment_id, description, created_at FROM Loyalty_Ledger WHERE user_id = ?"},
+	{"waitlist.json", "SELECT waitlist_id, room_type, check_in_date, check_out_date, status, room_id, offered_at, created_at FROM Waitlist WHERE user_id = ?"},
+	{"room_holds.json", "SELECT hold_id, room_id, check_in_date, check_out_date, expires_at, created_at FROM Room_Holds WHERE user_id = ?"},
+	{"security_events.json", "SELECT event_type, ip_address, details, created_at FROM Audit_Log WHERE user_id = ?"},
+}
+
+// exportMyData handles GET /me/export
+// It returns a zip of JSON files holding everything stored about the caller.
+func exportMyData(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range userExportFiles {
+		rows, err := exportRows(f.query, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting " + f.name, "details": err.Error()})
+			return
+		}
+		w, err := zw.Create(f.name)
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(rows)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error writing export", "details": err.Error()})
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error writing export", "details": err.Error()})
+		return
+	}
+
+	recordAudit(auditDataExport, userID, c.GetString("email"), c.ClientIP(), "")
+
+	filename := fmt.Sprintf("gatornest-export-%d-%s.zip", userID, time.Now().Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// anonymizeGuests scrubs the personal data of the guests matched by where
+// (a condition on Guests with its arguments). Reservations and Payments are
+// kept for accounting; they only point at the guest by ID.
+func anonymizeGuests(tx *sql.Tx, where string, args ...interface{}) (int64, error) {
+	// Rows pointing at the guests are scrubbed first, while where still
+	// matches them.
+	inGuests := " IN (SELECT guest_id FROM Guests WHERE " + where + ")"
+
+	if _, err := tx.Exec("UPDATE Reviews SET review_text = NULL WHERE guest_id"+inGuests, args...); err != nil {
+		return 0, err
+	}
+	// Preferences and request details can hold health and dietary information.
+	if _, err := tx.Exec("DELETE FROM Guest_Preferences WHERE guest_id"+inGuests, args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE Reservation_Requests SET details = NULL, status_note = NULL
+		WHERE reservation_id IN (SELECT reservation_id FROM Reservations WHERE guest_id`+inGuests+")", args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM Guest_Duplicates WHERE guest_id_a"+inGuests+" OR guest_id_b"+inGuests, append(args, args...)...); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+		UPDATE Guests SET first_name = 'Erased', last_name = 'Guest',
+			email = CONCAT('erased-', guest_id, '@erased.invalid'), phone = NULL,
+			user_id = NULL, erased_at = ?
+		WHERE `+where, append([]interface{}{time.Now()}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// userErasure is what eraseMyData does to each table holding rows of the
+// account, other than Guests (anonymizeGuests) and Loyalty_Ledger, which is
+// kept as accounting history against the anonymised account.
+var userErasure = []struct{ table, stmt string }{
+	{"User_Recovery_Codes", "DELETE FROM User_Recovery_Codes WHERE user_id = ?"},
+	{"User_Preferences", "DELETE FROM User_Preferences WHERE user_id = ?"},
+	{"Auth_Tokens", "DELETE FROM Auth_Tokens WHERE user_id = ?"},
+	{"Room_Holds", "DELETE FROM Room_Holds WHERE user_id = ?"},
+	{"Waitlist", "UPDATE Waitlist SET status = 'cancelled' WHERE user_id = ? AND status IN ('waiting', 'offered')"},
+}
+
+// eraseMyData handles POST /me/erase
+// The caller confirms with their password. Their guest records and the
+// account itself are anonymised rather than deleted, so the loyalty ledger
+// and other accounting history stay intact, and userErasure removes their
+// preferences, tokens, recovery codes and holds.
+func eraseMyData(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required to erase your account"})
+		return
+	}
+	if claims.Role != "guest" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Staff accounts must be removed by an administrator"})
+		return
+	}
+
+	var hash, email string
+	if err := db.QueryRow("SELECT password_hash, email FROM Users WHERE user_id = ?", claims.UserID).Scan(&hash, &email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing account", "details": err.Error()})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing account", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	guests, err := anonymizeGuests(tx, "user_id = ?", claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing guest records", "details": err.Error()})
+		return
+	}
+	// Audit entries are kept as a security record but lose the address and IP.
+	if _, err := tx.Exec("UPDATE Audit_Log SET subject = NULL, ip_address = NULL WHERE user_id = ? OR subject = ?", claims.UserID, email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing account", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM Login_Failures WHERE scope = ? AND subject = ?", lockoutScopeAccount, strings.ToLower(email)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing account", "details": err.Error()})
+		return
+	}
+	for _, e := range userErasure {
+		if _, err := tx.Exec(e.stmt, claims.UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing account", "details": err.Error()})
+			return
+		}
+	}
+	// An empty password hash never matches, so the account cannot be used.
+	if _, err := tx.Exec(`
+		UPDATE Users SET email = CONCAT('erased-', user_id, '@erased.invalid'), password_hash = '',
+			email_verified = FALSE, totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL, erased_at = ?
+		WHERE user_id = ?`, time.Now(), claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing account", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing account", "details": err.Error()})
+		return
+	}
+
+	recordAudit(auditDataErasure, claims.UserID, "", "", fmt.Sprintf("account erased by owner; %d guest records anonymised", guests))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Your account has been erased"})
+}
+
+// eraseGuest handles POST /guests/:id/erase
+// Staff use it for erasure requests from guests without an online account.
+func eraseGuest(c *gin.Context) {
+	id := c.Param("id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing guest", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	n, err := anonymizeGuests(tx, "guest_id = ? AND erased_at IS NULL", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing guest", "details": err.Error()})
+		return
+	}
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found or already erased"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing guest", "details": err.Error()})
+		return
+	}
+
+	recordAudit(auditDataErasure, c.GetInt("user_id"), "guest:"+id, c.ClientIP(), "guest anonymised by staff")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Guest personal data erased"})
+}
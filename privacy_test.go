@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestExportCoversPersonalData fails when a table holding rows of a user or
+// guest is left out of the data export.
+func TestExportCoversPersonalData(t *testing.T) {
+	// Credentials and internal bookkeeping are deliberately not exported.
+	skipped := map[string]bool{"User_Recovery_Codes": true, "Auth_Tokens": true, "Guest_Duplicates": true}
+
+	keys := append(schemaForeignKeys(t, "Users"), schemaForeignKeys(t, "Guests")...)
+	for _, key := range keys {
+		table, column := key[0], key[1]
+		if skipped[table] || (column != "user_id" && column != "guest_id") {
+			continue
+		}
+		found := false
+		for _, f := range userExportFiles {
+			if strings.Contains(f.query, "FROM "+table+" ") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s.%s holds personal data but is not in userExportFiles", table, column)
+		}
+	}
+}
+
+// TestErasureKeepsAccountingHistory checks that erasing an account deals with
+// every table pointing at it without deleting the Users row, which would
+// cascade or be refused by Loyalty_Ledger.
+func TestErasureKeepsAccountingHistory(t *testing.T) {
+	handled := map[string]bool{"Guests": true, "Loyalty_Ledger": true}
+	for _, e := range userErasure {
+		handled[e.table] = true
+		if !strings.Contains(e.stmt, e.table+" ") || !strings.Contains(e.stmt, "user_id = ?") {
+			t.Errorf("%s: statement %q does not target the account's rows", e.table, e.stmt)
+		}
+		if e.table == "Loyalty_Ledger" || strings.Contains(e.stmt, "FROM Users") {
+			t.Errorf("%s: erasure must not delete accounting history", e.table)
+		}
+	}
+	for _, key := range schemaForeignKeys(t, "Users") {
+		// Other columns record which staff member acted, not whose data it is.
+		if key[1] == "user_id" && !handled[key[0]] {
+			t.Errorf("%s.user_id references Users but is not handled by eraseMyData", key[0])
+		}
+	}
+}
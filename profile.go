@@ -0,0 +1,295 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// UserPreferences holds the account-level settings stored in User_Preferences.
+type UserPreferences struct {
+	PreferredLanguage string `json:"preferred_language"`
+	ContactMethod     string `json:"contact_method"` // "email", "phone" or "sms"
+	MarketingOptIn    bool   `json:"marketing_opt_in"`
+}
+
+var defaultUserPreferences = UserPreferences{PreferredLanguage: "en", ContactMethod: "email"}
+
+var validContactMethods = map[string]bool{"email": true, "phone": true, "sms": true}
+
+// normalize fills in default preferences and validates the contact method.
+func (p *UserPreferences) normalize() (string, bool) {
+	if p.PreferredLanguage == "" {
+		p.PreferredLanguage = defaultUserPreferences.PreferredLanguage
+	}
+	if p.ContactMethod == "" {
+		p.ContactMethod = defaultUserPreferences.ContactMethod
+	}
+	if !validContactMethods[p.ContactMethod] {
+		return "contact_method must be email, phone or sms", false
+	}
+	return "", true
+}
+
+// normalizeProfileGuest validates the guest section of PUT /me, defaulting
+// its email to the account's.
+func normalizeProfileGuest(g *Guest, accountEmail string) (string, bool) {
+	if g.FirstName == "" || g.LastName == "" {
+		return "first_name and last_name are required", false
+	}
+	if g.Email == "" {
+		g.Email = accountEmail
+	}
+	if !isValidEmail(g.Email) {
+		return "Invalid email format", false
+	}
+	phone, err := normalizePhone(g.Phone)
+	if err != nil {
+		return err.Error(), false
+	}
+	g.Phone = phone
+	return "", true
+}
+
+// endedStayStatuses are the Reservations.status values of stays that are
+// over or will not happen, which /me leaves out of upcoming_stays.
+var endedStayStatuses = map[string]bool{"Cancelled": true, "Checked-out": true, "Walked": true, "No-show": true}
+
+// loadUserPreferences returns the user's preferences, or the defaults if none
+// have been saved yet.
+func loadUserPreferences(userID int) (UserPreferences, error) {
+	p := defaultUserPreferences
+	err := db.QueryRow("SELECT preferred_language, contact_method, marketing_opt_in FROM User_Preferences WHERE user_id = ?", userID).
+		Scan(&p.PreferredLanguage, &p.ContactMethod, &p.MarketingOptIn)
+	if err == sql.ErrNoRows {
+		return defaultUserPreferences, nil
+	}
+	return p, err
+}
+
+// loadUserGuests returns the Guests records linked to the user.
+func loadUserGuests(userID int) ([]Guest, error) {
+	rows, err := db.Query("SELECT guest_id, first_name, last_name, email, phone, profile_incomplete FROM Guests WHERE user_id = ? ORDER BY guest_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guests := []Guest{}
+	for rows.Next() {
+		g := Guest{UserID: userID}
+		if err := rows.Scan(&g.GuestID, &g.FirstName, &g.LastName, &g.Email, &g.Phone, &g.ProfileIncomplete); err != nil {
+			return nil, err
+		}
+		guests = append(guests, g)
+	}
+	return guests, rows.Err()
+}
+
+// loadUpcomingStays returns reservations for any of the user's guests that
+// have not ended and whose status is not in endedStayStatuses, soonest first.
+func loadUpcomingStays(userID int) ([]Reservation, error) {
+	rows, err := db.Query(`
+		SELECT r.reservation_id, r.guest_id, r.room_id, r.check_in_date, r.check_out_date,
+		       r.status, r.total_price, r.created_at, g.first_name, g.last_name, g.email
+		FROM Reservations r
+		JOIN Guests g ON g.guest_id = r.guest_id
+		WHERE g.user_id = ? AND r.check_out_date >= CURDATE()
+		ORDER BY r.check_in_date`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stays := []Reservation{}
+	for rows.Next() {
+		r := Reservation{UserID: userID}
+		var checkIn, checkOut time.Time
+		if err := rows.Scan(&r.ReservationID, &r.GuestID, &r.RoomID, &checkIn, &checkOut,
+			&r.Status, &r.TotalPrice, &r.CreatedAt, &r.FirstName, &r.LastName, &r.Email); err != nil {
+			return nil, err
+		}
+		if endedStayStatuses[r.Status] {
+			continue
+		}
+		r.CheckInDate = checkIn.Format(dateLayout)
+		r.CheckOutDate = checkOut.Format(dateLayout)
+		stays = append(stays, r)
+	}
+	return stays, rows.Err()
+}
+
+// getMe handles GET /me
+func getMe(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	var email, role string
+	var emailVerified, totpEnabled bool
+	var createdAt time.Time
+	err := db.QueryRow("SELECT email, role, email_verified, totp_enabled, created_at FROM Users WHERE user_id = ?", claims.UserID).
+		Scan(&email, &role, &emailVerified, &totpEnabled, &createdAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching profile", "details": err.Error()})
+		return
+	}
+
+	guests, err := loadUserGuests(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching guest records", "details": err.Error()})
+		return
+	}
+	prefs, err := loadUserPreferences(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching preferences", "details": err.Error()})
+		return
+	}
+	stays, err := loadUpcomingStays(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching upcoming stays", "details": err.Error()})
+		return
+	}
+	loyalty, err := loadLoyaltyAccount(claims.UserID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching loyalty account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": gin.H{
+			"user_id":            claims.UserID,
+			"email":              email,
+			"role":               role,
+			"email_verified":     emailVerified,
+			"two_factor_enabled": totpEnabled,
+			"created_at":         createdAt,
+		},
+		"guests":         guests,
+		"preferences":    prefs,
+		"upcoming_stays": stays,
+		"loyalty":        loyalty,
+	})
+}
+
+// updateMe handles PUT /me
+// The guest section updates one of the caller's own Guests records (the only
+// one if guest_id is omitted, or a new one if none exists yet). Either
+// section may be left out.
+func updateMe(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	var req struct {
+		Guest       *Guest           `json:"guest"`
+		Preferences *UserPreferences `json:"preferences"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+
+	if p := req.Preferences; p != nil {
+		if msg, ok := p.normalize(); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+	if g := req.Guest; g != nil {
+		if msg, ok := normalizeProfileGuest(g, claims.Email); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if g := req.Guest; g != nil {
+		if g.GuestID == 0 {
+			var ids []int
+			rows, err := tx.Query("SELECT guest_id FROM Guests WHERE user_id = ?", claims.UserID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile", "details": err.Error()})
+				return
+			}
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile", "details": err.Error()})
+					return
+				}
+				ids = append(ids, id)
+			}
+			rows.Close()
+			if len(ids) > 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "guest_id is required when the account has several guest records"})
+				return
+			}
+			if len(ids) == 1 {
+				g.GuestID = ids[0]
+			}
+		}
+
+		var result sql.Result
+		if g.GuestID == 0 {
+			result, err = tx.Exec("INSERT INTO Guests (first_name, last_name, email, phone, user_id) VALUES (?, ?, ?, ?, ?)",
+				g.FirstName, g.LastName, g.Email, g.Phone, claims.UserID)
+		} else {
+			result, err = tx.Exec("UPDATE Guests SET first_name = ?, last_name = ?, email = ?, phone = ? WHERE guest_id = ? AND user_id = ?",
+				g.FirstName, g.LastName, g.Email, g.Phone, g.GuestID, claims.UserID)
+		}
+		if err != nil {
+			if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+				c.JSON(http.StatusConflict, gin.H{"error": "Email or phone is already used by another guest"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating guest", "details": err.Error()})
+			return
+		}
+		if g.GuestID == 0 {
+			id, _ := result.LastInsertId()
+			g.GuestID = int(id)
+		} else if n, _ := result.RowsAffected(); n == 0 {
+			// MySQL also reports 0 rows when nothing changed, so check
+			// whether the guest belongs to the caller at all.
+			var exists int
+			err := tx.QueryRow("SELECT 1 FROM Guests WHERE guest_id = ? AND user_id = ?", g.GuestID, claims.UserID).Scan(&exists)
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating guest", "details": err.Error()})
+				return
+			}
+		}
+	}
+
+	if p := req.Preferences; p != nil {
+		_, err := tx.Exec(`
+			INSERT INTO User_Preferences (user_id, preferred_language, contact_method, marketing_opt_in) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE preferred_language = VALUES(preferred_language),
+				contact_method = VALUES(contact_method), marketing_opt_in = VALUES(marketing_opt_in)`,
+			claims.UserID, p.PreferredLanguage, p.ContactMethod, p.MarketingOptIn)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating preferences", "details": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile", "details": err.Error()})
+		return
+	}
+
+	getMe(c)
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestUserPreferencesNormalize(t *testing.T) {
+	p := UserPreferences{}
+	if msg, ok := p.normalize(); !ok {
+		t.Fatalf("expected empty preferences to take the defaults, got %q", msg)
+	}
+	if p != defaultUserPreferences {
+		t.Errorf("expected %+v, got %+v", defaultUserPreferences, p)
+	}
+
+	p = UserPreferences{PreferredLanguage: "es", ContactMethod: "sms", MarketingOptIn: true}
+	if _, ok := p.normalize(); !ok || p.PreferredLanguage != "es" || p.ContactMethod != "sms" {
+		t.Errorf("expected given preferences to be kept, got %+v", p)
+	}
+
+	p = UserPreferences{ContactMethod: "pigeon"}
+	if _, ok := p.normalize(); ok {
+		t.Errorf("expected an unknown contact_method to be rejected")
+	}
+}
+
+func TestNormalizeProfileGuest(t *testing.T) {
+	phone := func(s string) *string { return &s }
+	tests := []struct {
+		name      string
+		guest     Guest
+		wantOK    bool
+		wantEmail string
+		wantPhone string // "" means nil
+	}{
+		{"missing last name", Guest{FirstName: "Ada"}, false, "", ""},
+		{"email defaults to the account's", Guest{FirstName: "Ada", LastName: "Lovelace"}, true, "ada@example.com", ""},
+		{"own email kept", Guest{FirstName: "Ada", LastName: "Lovelace", Email: "ada@work.example.com"}, true, "ada@work.example.com", ""},
+		{"invalid email", Guest{FirstName: "Ada", LastName: "Lovelace", Email: "not-an-email"}, false, "", ""},
+		{"phone normalised", Guest{FirstName: "Ada", LastName: "Lovelace", Phone: phone("(352) 555-0123")}, true, "ada@example.com", "3525550123"},
+		{"invalid phone", Guest{FirstName: "Ada", LastName: "Lovelace", Phone: phone("555-01")}, false, "", ""},
+	}
+	for _, test := range tests {
+		g := test.guest
+		_, ok := normalizeProfileGuest(&g, "ada@example.com")
+		if ok != test.wantOK {
+			t.Errorf("%s: expected ok=%v, got %v", test.name, test.wantOK, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if g.Email != test.wantEmail {
+			t.Errorf("%s: expected email %q, got %q", test.name, test.wantEmail, g.Email)
+		}
+		if (test.wantPhone == "") != (g.Phone == nil) || (g.Phone != nil && *g.Phone != test.wantPhone) {
+			t.Errorf("%s: expected phone %q, got %v", test.name, test.wantPhone, g.Phone)
+		}
+	}
+}
+
+func TestEndedStayStatuses(t *testing.T) {
+	upcoming := map[string]bool{
+		"Pending":     true,
+		"Confirmed":   true,
+		"Checked-in":  true,
+		"Checked-out": false,
+		"Cancelled":   false,
+		"Walked":      false,
+		"No-show":     false,
+	}
+	for status, want := range upcoming {
+		if got := !endedStayStatuses[status]; got != want {
+			t.Errorf("%s: expected upcoming=%v, got %v", status, want, got)
+		}
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// clockLayout is the format of shift start and end times.
+const clockLayout = "15:04"
+
+// shiftDefaults are the usual hours of each Staff_Schedule.shift_time, used
+// when a shift or template gives no times of its own.
+var shiftDefaults = map[string][2]string{
+	"Morning":   {"06:00", "14:00"},
+	"Afternoon": {"14:00", "22:00"},
+	"Night":     {"22:00", "06:00"},
+}
+
+// weekdays are the values of Shift_Templates.weekday.
+var weekdays = map[string]time.Weekday{
+	"Sunday": time.Sunday, "Monday": time.Monday, "Tuesday": time.Tuesday, "Wednesday": time.Wednesday,
+	"Thursday": time.Thursday, "Friday": time.Friday, "Saturday": time.Saturday,
+}
+
+// Schedule is a row of Staff_Schedule: one staff member's shift on a date.
+type Schedule struct {
+	ScheduleID int    `json:"schedule_id,omitempty"`
+	StaffID    int    `json:"staff_id"`
+	ShiftDate  string `json:"shift_date"` // YYYY-MM-DD
+	ShiftTime  string `json:"shift_time"` // "Morning", "Afternoon", "Night"
+	// StartTime and EndTime (HH:MM) default to the shift_time's usual hours.
+	// An end at or before the start is on the following day.
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// TemplateID is set on shifts generated from a Shift_Templates row.
+	TemplateID *int `json:"template_id,omitempty"`
+}
+
+// shiftClock validates a shift_time and start/end pair, filling in the
+// shift's usual hours when both times are empty.
+func shiftClock(shift string, start, end *string) (string, bool) {
+	hours, ok := shiftDefaults[shift]
+	if !ok {
+		return "shift_time must be Morning, Afternoon or Night", false
+	}
+	if *start == "" && *end == "" {
+		*start, *end = hours[0], hours[1]
+	}
+	if _, err := time.Parse(clockLayout, *start); err != nil {
+		return "start_time must be a time in HH:MM format", false
+	}
+	if _, err := time.Parse(clockLayout, *end); err != nil {
+		return "end_time must be a time in HH:MM format", false
+	}
+	if *start == *end {
+		return "end_time must differ from start_time", false
+	}
+	return "", true
+}
+
+// normalize validates a schedule from a request and fills in default times.
+func (s *Schedule) normalize() (string, bool) {
+	if s.StaffID <= 0 {
+		return "staff_id is required", false
+	}
+	if _, err := time.Parse(dateLayout, s.ShiftDate); err != nil {
+		return "shift_date must be a date in YYYY-MM-DD format", false
+	}
+	return shiftClock(s.ShiftTime, &s.StartTime, &s.EndTime)
+}
+
+// window returns when the shift starts and ends. It assumes normalize has
+// accepted the schedule.
+func (s Schedule) window() (time.Time, time.Time) {
+	start, _ := time.Parse(dateLayout+" "+clockLayout, s.ShiftDate+" "+s.StartTime)
+	end, _ := time.Parse(dateLayout+" "+clockLayout, s.ShiftDate+" "+s.EndTime)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// ShiftTemplate is a row of Shift_Templates: a shift a staff member works
+// every week, from which concrete Staff_Schedule rows are generated.
+type ShiftTemplate struct {
+	TemplateID int    `json:"template_id"`
+	StaffID    int    `json:"staff_id"`
+	Weekday    string `json:"weekday"`
+	ShiftTime  string `json:"shift_time"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	Active     bool   `json:"active"`
+}
+
+// normalize validates a template from a request and fills in default times.
+func (t *ShiftTemplate) normalize() (string, bool) {
+	if t.StaffID <= 0 {
+		return "staff_id is required", false
+	}
+	if _, ok := weekdays[t.Weekday]; !ok {
+		return "weekday must be a day name such as Monday", false
+	}
+	return shiftClock(t.ShiftTime, &t.StartTime, &t.EndTime)
+}
+
+// expandTemplates returns the shifts the templates call for on each date
+// from through to, inclusive.
+func expandTemplates(templates []ShiftTemplate, from, to time.Time) []Schedule {
+	var shifts []Schedule
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		for _, t := range templates {
+			if weekdays[t.Weekday] != d.Weekday() {
+				continue
+			}
+			id := t.TemplateID
+			shifts = append(shifts, Schedule{
+				StaffID:    t.StaffID,
+				ShiftDate:  d.Format(dateLayout),
+				ShiftTime:  t.ShiftTime,
+				StartTime:  t.StartTime,
+				EndTime:    t.EndTime,
+				TemplateID: &id,
+			})
+		}
+	}
+	return shifts
+}
+
+// registerScheduleRoutes adds the staff roster endpoints to the
+// authenticated routes. Staff may read rosters; only managers may change
+// shifts, the templates shifts are generated from, or the coverage
+// minimums that guard shift removal.
+func registerScheduleRoutes(auth gin.IRoutes) {
+	auth.POST("/schedule", RequireManager(), addToSchedule)
+	auth.DELETE("/schedule/:id", RequireManager(), removeFromSchedule)
+	auth.PUT("/schedule/:id", RequireManager(), updateSchedule)
+	auth.GET("/schedules", RequireStaff(), getAllSchedules)
+	auth.GET("/shift-templates", RequireStaff(), getShiftTemplates)
+	auth.POST("/shift-templates", RequireManager(), createShiftTemplate)
+	auth.PUT("/shift-templates/:id", RequireManager(), updateShiftTemplate)
+	auth.DELETE("/shift-templates/:id", RequireManager(), deleteShiftTemplate)
+	auth.POST("/shift-templates/generate", RequireManager(), generateFromTemplates)
+	auth.GET("/shift-coverage", RequireStaff(), getShiftCoverage)
+	auth.PUT("/shift-coverage/:role/:shift_time", RequireManager(), updateShiftCoverage)
+	auth.GET("/shift-coverage/report", RequireStaff(), getCoverageReport)
+}
+
+// maxGenerateDays bounds how far one request can generate shifts.
+const maxGenerateDays = 92
+
+// initShiftGeneration schedules the weekly job, on SHIFT_GENERATION_SCHEDULE
+// (default Sunday 1am), that generates shifts from the active templates for
+// the next SHIFT_GENERATION_WEEKS weeks (default 2).
+func initShiftGeneration() {
+	registerJob("shift-generation", "SHIFT_GENERATION_SCHEDULE", "0 1 * * 0", func() error {
+		from, _ := time.Parse(dateLayout, time.Now().Format(dateLayout))
+		to := from.AddDate(0, 0, 7*envInt("SHIFT_GENERATION_WEEKS", 2)-1)
+		created, skipped, err := generateShifts(from, to)
+		if len(created) > 0 {
+			log.Printf("Generated %d shifts from templates", len(created))
+		}
+		for _, s := range skipped {
+			log.Printf("Skipped the %s shift on %s for staff %d: %s", s.Shift.ShiftTime, s.Shift.ShiftDate, s.Shift.StaffID, s.Violations[0].Message)
+		}
+		return err
+	})
+}
+
+// activeTemplates returns the templates currently in use.
+func activeTemplates() ([]ShiftTemplate, error) {
+	rows, err := db.Query("SELECT " + shiftTemplateColumns + " FROM Shift_Templates WHERE active ORDER BY template_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []ShiftTemplate
+	for rows.Next() {
+		t, err := scanShiftTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// generateShifts adds the shifts the active templates call for between from
+// and to. Shifts already scheduled, by hand or by an earlier run, are left
+// as they are; those that would break the labour rules are skipped.
+func generateShifts(from, to time.Time) ([]Schedule, []SkippedShift, error) {
+	templates, err := activeTemplates()
+	if err != nil {
+		return nil, nil, err
+	}
+	created, skipped := []Schedule{}, []SkippedShift{}
+	for _, s := range expandTemplates(templates, from, to) {
+		ok, violations, err := generateShift(&s)
+		if err != nil {
+			return created, skipped, err
+		}
+		if ok {
+			created = append(created, s)
+		} else if len(violations) > 0 {
+			skipped = append(skipped, SkippedShift{Shift: s, Violations: violations})
+		}
+	}
+	return created, skipped, nil
+}
+
+// scheduleColumns are the Staff_Schedule columns scanned by scanSchedule.
+const scheduleColumns = `schedule_id, staff_id, shift_date, shift_time,
+	TIME_FORMAT(start_time, '%H:%i'), TIME_FORMAT(end_time, '%H:%i'), template_id`
+
+func scanSchedule(row interface{ Scan(...interface{}) error }, extra ...interface{}) (Schedule, error) {
+	var s Schedule
+	var day time.Time
+	dest := append([]interface{}{&s.ScheduleID, &s.StaffID, &day, &s.ShiftTime, &s.StartTime, &s.EndTime, &s.TemplateID}, extra...)
+	err := row.Scan(dest...)
+	s.ShiftDate = day.Format(dateLayout)
+	return s, err
+}
+
+// scheduleSorts and scheduleFilters are the list options accepted by GET /schedules.
+var (
+	scheduleSorts = map[string]string{
+		"schedule_id": "schedule_id",
+		"staff_id":    "staff_id",
+		"shift_date":  "shift_date",
+	}
+	scheduleFilters = map[string]string{
+		"staff_id":   "staff_id",
+		"shift_date": "shift_date",
+		"shift_time": "shift_time",
+	}
+)
+
+// getAllSchedules handles GET /schedules
+// Returns shifts one page at a time; ?from= and ?to= bound shift_date.
+func getAllSchedules(c *gin.Context) {
+	lq, err := parseListQuery(c, scheduleSorts, "schedule_id", "schedule_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filters, args := equalityFilters(c, scheduleFilters)
+	where := " WHERE TRUE" + filters
+	for param, cond := range map[string]string{"from": " AND shift_date >= ?", "to": " AND shift_date <= ?"} {
+		if v := c.Query(param); v != "" {
+			if _, err := time.Parse(dateLayout, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a YYYY-MM-DD date"})
+				return
+			}
+			where += cond
+			args = append(args, v)
+		}
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Staff_Schedule"+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count schedules", "details": err.Error()})
+		return
+	}
+
+	keyset, keysetArgs := lq.keyset()
+	rows, err := db.Query("SELECT "+scheduleColumns+", "+lq.sortValueExpr()+
+		" FROM Staff_Schedule"+where+keyset+lq.orderLimit(), append(args, keysetArgs...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schedules", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	var keys []listCursor
+	for rows.Next() {
+		var k listCursor
+		s, err := scanSchedule(rows, &k.Value)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse schedule", "details": err.Error()})
+			return
+		}
+		k.ID = s.ScheduleID
+		schedules = append(schedules, s)
+		keys = append(keys, k)
+	}
+
+	c.JSON(http.StatusOK, newListPage(schedules, keys, lq, total))
+}
+
+// errShiftTaken is returned when the staff member already has that shift on
+// that date.
+var errShiftTaken = errors.New("the staff member already has that shift on that date")
+
+// saveSchedule inserts s, or updates the row s.ScheduleID when it is set.
+func saveSchedule(q queryExecer, s *Schedule) error {
+	var err error
+	if s.ScheduleID == 0 {
+		var result sql.Result
+		result, err = q.Exec("INSERT INTO Staff_Schedule (staff_id, shift_date, shift_time, start_time, end_time) VALUES (?, ?, ?, ?, ?)",
+			s.StaffID, s.ShiftDate, s.ShiftTime, s.StartTime, s.EndTime)
+		if err == nil {
+			id, _ := result.LastInsertId()
+			s.ScheduleID = int(id)
+		}
+	} else {
+		_, err = q.Exec("UPDATE Staff_Schedule SET staff_id = ?, shift_date = ?, shift_time = ?, start_time = ?, end_time = ? WHERE schedule_id = ?",
+			s.StaffID, s.ShiftDate, s.ShiftTime, s.StartTime, s.EndTime, s.ScheduleID)
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return errShiftTaken
+	}
+	return err
+}
+
+// ScheduledShift is a shift added by POST /schedule, with the coverage its
+// shift is still short of on that date.
+type ScheduledShift struct {
+	Schedule
+	CoverageShortfalls []ScheduleViolation `json:"coverage_shortfalls"`
+}
+
+// addToSchedule handles POST /schedule
+// A shift that breaks the labour rules is rejected with 422 and the list of
+// violations.
+func addToSchedule(c *gin.Context) {
+	var s Schedule
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	s.ScheduleID = 0
+	if msg, ok := s.normalize(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add schedule", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	violations, err := checkShift(tx, s)
+	if err == errStaffNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Staff member not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add schedule", "details": err.Error()})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The shift breaks scheduling rules", "violations": violations})
+		return
+	}
+
+	if err := saveSchedule(tx, &s); err != nil {
+		if err == errShiftTaken {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add schedule", "details": err.Error()})
+		return
+	}
+	day, _ := time.Parse(dateLayout, s.ShiftDate)
+	shortfalls, err := scheduledShortfalls(tx, day, day)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add schedule", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add schedule", "details": err.Error()})
+		return
+	}
+	added := ScheduledShift{Schedule: s, CoverageShortfalls: []ScheduleViolation{}}
+	for _, v := range shortfalls {
+		if v.ShiftTime == s.ShiftTime {
+			added.CoverageShortfalls = append(added.CoverageShortfalls, v)
+		}
+	}
+	c.JSON(http.StatusCreated, added)
+}
+
+// updateSchedule handles PUT /schedule/:id
+// Replaces the shift with the given schedule_id. The new shift must keep to
+// the labour rules, and moving the old one must not leave its shift short of
+// the coverage Shift_Coverage requires; otherwise 422 lists the violations.
+func updateSchedule(c *gin.Context) {
+	var s Schedule
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if msg, ok := s.normalize(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := scanSchedule(tx.QueryRow("SELECT "+scheduleColumns+" FROM Staff_Schedule WHERE schedule_id = ? FOR UPDATE", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+		return
+	}
+	s.ScheduleID = current.ScheduleID
+	s.TemplateID = current.TemplateID
+
+	violations, err := checkShift(tx, s)
+	if err == errStaffNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Staff member not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+		return
+	}
+	var coverage *slotCoverage
+	moved := s.StaffID != current.StaffID || s.ShiftDate != current.ShiftDate || s.ShiftTime != current.ShiftTime
+	if moved {
+		if coverage, err = lockSlotCoverage(tx, current); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+			return
+		}
+	}
+	if err := saveSchedule(tx, &s); err != nil {
+		if err == errShiftTaken {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+		return
+	}
+	if moved {
+		lost, err := checkCoverageLoss(tx, coverage)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+			return
+		}
+		violations = append(violations, lost...)
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The change breaks scheduling rules", "violations": violations})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// removeFromSchedule handles DELETE /schedule/:id
+// Deletes the shift with the given schedule_id, unless that would leave a
+// covered shift short of the coverage Shift_Coverage requires (422).
+func removeFromSchedule(c *gin.Context) {
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := scanSchedule(tx.QueryRow("SELECT "+scheduleColumns+" FROM Staff_Schedule WHERE schedule_id = ? FOR UPDATE", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "details": err.Error()})
+		return
+	}
+	coverage, err := lockSlotCoverage(tx, current)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM Staff_Schedule WHERE schedule_id = ?", current.ScheduleID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "details": err.Error()})
+		return
+	}
+	violations, err := checkCoverageLoss(tx, coverage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "details": err.Error()})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Removing the shift breaks scheduling rules", "violations": violations})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule removed"})
+}
+
+// shiftTemplateColumns are the Shift_Templates columns scanned by
+// scanShiftTemplate.
+const shiftTemplateColumns = `template_id, staff_id, weekday, shift_time,
+	TIME_FORMAT(start_time, '%H:%i'), TIME_FORMAT(end_time, '%H:%i'), active`
+
+func scanShiftTemplate(row interface{ Scan(...interface{}) error }) (ShiftTemplate, error) {
+	var t ShiftTemplate
+	err := row.Scan(&t.TemplateID, &t.StaffID, &t.Weekday, &t.ShiftTime, &t.StartTime, &t.EndTime, &t.Active)
+	return t, err
+}
+
+// getShiftTemplates handles GET /shift-templates
+// ?staff_id= limits the list to one staff member.
+func getShiftTemplates(c *gin.Context) {
+	query := "SELECT " + shiftTemplateColumns + " FROM Shift_Templates"
+	var args []interface{}
+	if v := c.Query("staff_id"); v != "" {
+		query += " WHERE staff_id = ?"
+		args = append(args, v)
+	}
+	rows, err := db.Query(query+" ORDER BY staff_id, FIELD(weekday, 'Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday', 'Sunday'), start_time", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching shift templates", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	templates := []ShiftTemplate{}
+	for rows.Next() {
+		t, err := scanShiftTemplate(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning shift template", "details": err.Error()})
+			return
+		}
+		templates = append(templates, t)
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+// createShiftTemplate handles POST /shift-templates
+func createShiftTemplate(c *gin.Context) {
+	t := ShiftTemplate{Active: true}
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if msg, ok := t.normalize(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	result, err := db.Exec("INSERT INTO Shift_Templates (staff_id, weekday, shift_time, start_time, end_time, active) VALUES (?, ?, ?, ?, ?, ?)",
+		t.StaffID, t.Weekday, t.ShiftTime, t.StartTime, t.EndTime, t.Active)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The staff member already has a template for that shift"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating shift template", "details": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	t.TemplateID = int(id)
+	c.JSON(http.StatusCreated, t)
+}
+
+// updateShiftTemplate handles PUT /shift-templates/:id
+// Shifts already generated from the template are not changed.
+func updateShiftTemplate(c *gin.Context) {
+	var t ShiftTemplate
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if msg, ok := t.normalize(); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	result, err := db.Exec("UPDATE Shift_Templates SET staff_id = ?, weekday = ?, shift_time = ?, start_time = ?, end_time = ?, active = ? WHERE template_id = ?",
+		t.StaffID, t.Weekday, t.ShiftTime, t.StartTime, t.EndTime, t.Active, c.Param("id"))
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The staff member already has a template for that shift"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating shift template", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists int
+		if db.QueryRow("SELECT 1 FROM Shift_Templates WHERE template_id = ?", c.Param("id")).Scan(&exists) == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shift template not found"})
+			return
+		}
+	}
+	t.TemplateID, _ = strconv.Atoi(c.Param("id"))
+	c.JSON(http.StatusOK, t)
+}
+
+// deleteShiftTemplate handles DELETE /shift-templates/:id
+// Shifts already generated from the template are kept.
+func deleteShiftTemplate(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM Shift_Templates WHERE template_id = ?", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting shift template", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shift template not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Shift template deleted"})
+}
+
+// generateFromTemplates handles POST /shift-templates/generate
+// Creates the shifts the active templates call for from "from" through "to"
+// (at most maxGenerateDays days) and returns those created, those skipped
+// for breaking the labour rules, and the shifts in the range still short of
+// the coverage Shift_Coverage requires.
+func generateFromTemplates(c *gin.Context) {
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	from, err := time.Parse(dateLayout, req.From)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+		return
+	}
+	to, err := time.Parse(dateLayout, req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+		return
+	}
+	if to.Before(from) || to.Sub(from) >= maxGenerateDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to must be on or after from and within %d days of it", maxGenerateDays)})
+		return
+	}
+
+	created, skipped, err := generateShifts(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating shifts", "details": err.Error()})
+		return
+	}
+	shortfalls, err := scheduledShortfalls(db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting scheduled staff", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"created": created, "skipped": skipped, "coverage_shortfalls": shortfalls})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestScheduleNormalize(t *testing.T) {
+	s := Schedule{StaffID: 1, ShiftDate: "2025-09-10", ShiftTime: "Night"}
+	if msg, ok := s.normalize(); !ok {
+		t.Fatalf("expected a valid schedule, got %q", msg)
+	}
+	if s.StartTime != "22:00" || s.EndTime != "06:00" {
+		t.Errorf("expected the Night shift's usual hours, got %s-%s", s.StartTime, s.EndTime)
+	}
+
+	tests := []struct {
+		name string
+		s    Schedule
+	}{
+		{"no staff", Schedule{ShiftDate: "2025-09-10", ShiftTime: "Morning"}},
+		{"weekday instead of date", Schedule{StaffID: 1, ShiftDate: "Friday", ShiftTime: "Morning"}},
+		{"unknown shift", Schedule{StaffID: 1, ShiftDate: "2025-09-10", ShiftTime: "Evening"}},
+		{"bad start time", Schedule{StaffID: 1, ShiftDate: "2025-09-10", ShiftTime: "Morning", StartTime: "7am", EndTime: "15:00"}},
+		{"only an end time", Schedule{StaffID: 1, ShiftDate: "2025-09-10", ShiftTime: "Morning", EndTime: "15:00"}},
+		{"empty shift", Schedule{StaffID: 1, ShiftDate: "2025-09-10", ShiftTime: "Morning", StartTime: "07:00", EndTime: "07:00"}},
+	}
+	for _, test := range tests {
+		if _, ok := test.s.normalize(); ok {
+			t.Errorf("%s: expected validation to fail", test.name)
+		}
+	}
+}
+
+func TestScheduleWindow(t *testing.T) {
+	tests := []struct {
+		start, end         string
+		wantStart, wantEnd string
+	}{
+		{"06:00", "14:00", "2025-09-10 06:00", "2025-09-10 14:00"},
+		{"22:00", "06:00", "2025-09-10 22:00", "2025-09-11 06:00"},
+	}
+	for _, test := range tests {
+		s := Schedule{ShiftDate: "2025-09-10", StartTime: test.start, EndTime: test.end}
+		start, end := s.window()
+		if got := start.Format("2006-01-02 15:04"); got != test.wantStart {
+			t.Errorf("%s-%s: expected start %s, got %s", test.start, test.end, test.wantStart, got)
+		}
+		if got := end.Format("2006-01-02 15:04"); got != test.wantEnd {
+			t.Errorf("%s-%s: expected end %s, got %s", test.start, test.end, test.wantEnd, got)
+		}
+	}
+}
+
+func TestExpandTemplates(t *testing.T) {
+	templates := []ShiftTemplate{
+		{TemplateID: 1, StaffID: 3, Weekday: "Monday", ShiftTime: "Morning", StartTime: "06:00", EndTime: "14:00"},
+		{TemplateID: 2, StaffID: 4, Weekday: "Wednesday", ShiftTime: "Night", StartTime: "22:00", EndTime: "06:00"},
+	}
+	// 2025-09-08 is a Monday; two weeks give each template two shifts.
+	from, _ := time.Parse(dateLayout, "2025-09-08")
+	to, _ := time.Parse(dateLayout, "2025-09-21")
+	got := expandTemplates(templates, from, to)
+
+	want := []struct {
+		staffID int
+		date    string
+	}{
+		{3, "2025-09-08"}, {4, "2025-09-10"}, {3, "2025-09-15"}, {4, "2025-09-17"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d shifts, got %d: %+v", len(want), len(got), got)
+	}
+	for i, w := range want {
+		if got[i].StaffID != w.staffID || got[i].ShiftDate != w.date {
+			t.Errorf("shift %d: expected staff %d on %s, got staff %d on %s", i, w.staffID, w.date, got[i].StaffID, got[i].ShiftDate)
+		}
+		if got[i].TemplateID == nil {
+			t.Errorf("shift %d: expected template_id to be set", i)
+		}
+	}
+}
+
+func TestRequireManager(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		role string
+		want int
+	}{
+		{"guest", http.StatusForbidden},
+		{"staff", http.StatusForbidden},
+		{"manager", http.StatusOK},
+		{"admin", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set("role", test.role)
+
+		RequireManager()(c)
+		if c.IsAborted() != (test.want != http.StatusOK) || (c.IsAborted() && w.Code != test.want) {
+			t.Errorf("role %q: expected %d, got %d (aborted %v)", test.role, test.want, w.Code, c.IsAborted())
+		}
+	}
+}
+
+func TestScheduleRoutesManagerOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	routes := []struct {
+		method, path string
+	}{
+		{http.MethodPost, "/schedule"},
+		{http.MethodPut, "/schedule/1"},
+		{http.MethodDelete, "/schedule/1"},
+		{http.MethodPost, "/shift-templates"},
+		{http.MethodPut, "/shift-templates/1"},
+		{http.MethodDelete, "/shift-templates/1"},
+		{http.MethodPost, "/shift-templates/generate"},
+		{http.MethodPut, "/shift-coverage/Reception/Morning"},
+	}
+
+	for _, role := range []string{"guest", "staff", "manager", "admin"} {
+		router := gin.New()
+		router.Use(gin.RecoveryWithWriter(io.Discard), func(c *gin.Context) {
+			c.Set("role", role)
+		})
+		registerScheduleRoutes(router)
+
+		forbidden := role != "manager" && role != "admin"
+		for _, route := range routes {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(route.method, route.path, nil))
+			if (w.Code == http.StatusForbidden) != forbidden {
+				t.Errorf("%s %s as %q: got %d", route.method, route.path, role, w.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The scheduling rules a ScheduleViolation can name.
+const (
+	ruleOverlap        = "overlap"
+	ruleMinRest        = "min_rest"
+	ruleMaxWeeklyHours = "max_weekly_hours"
+	ruleMinCoverage    = "min_coverage"
+)
+
+// labourPolicy holds the per-staff limits, set by initLabourPolicy.
+type labourPolicy struct {
+	minRest   time.Duration // time off between the end of one shift and the start of the next
+	maxWeekly time.Duration // hours worked in a Monday to Sunday week
+}
+
+var labourRules = labourPolicy{minRest: 8 * time.Hour, maxWeekly: 48 * time.Hour}
+
+// initLabourPolicy reads MIN_REST_HOURS and MAX_WEEKLY_HOURS.
+func initLabourPolicy() {
+	labourRules.minRest = time.Duration(envInt("MIN_REST_HOURS", int(labourRules.minRest/time.Hour))) * time.Hour
+	labourRules.maxWeekly = time.Duration(envInt("MAX_WEEKLY_HOURS", int(labourRules.maxWeekly/time.Hour))) * time.Hour
+}
+
+// staffJobRoles are the values of Staff.role.
+var staffJobRoles = map[string]bool{"Manager": true, "Receptionist": true, "Housekeeping": true, "Security": true}
+
+// ScheduleViolation is a scheduling rule a change to Staff_Schedule would
+// break.
+type ScheduleViolation struct {
+	Rule      string `json:"rule"`
+	Message   string `json:"message"`
+	StaffID   int    `json:"staff_id,omitempty"`
+	ShiftDate string `json:"shift_date"`
+	ShiftTime string `json:"shift_time"`
+	// ConflictingID is the other shift of an overlap or min_rest violation.
+	ConflictingID int `json:"conflicting_schedule_id,omitempty"`
+	// Role is the under-covered role of a min_coverage violation.
+	Role string `json:"role,omitempty"`
+}
+
+// weekOf returns the Monday of the week containing day.
+func weekOf(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// checkStaffShifts checks s against the same staff member's other shifts,
+// which must include every shift of s's week and those within two days of
+// it.
+func checkStaffShifts(s Schedule, others []Schedule, p labourPolicy) []ScheduleViolation {
+	var violations []ScheduleViolation
+	add := func(rule, msg string, other int) {
+		violations = append(violations, ScheduleViolation{
+			Rule: rule, Message: msg, StaffID: s.StaffID, ShiftDate: s.ShiftDate, ShiftTime: s.ShiftTime, ConflictingID: other,
+		})
+	}
+
+	start, end := s.window()
+	day, _ := time.Parse(dateLayout, s.ShiftDate)
+	monday := weekOf(day)
+	weekly := end.Sub(start)
+	for _, o := range others {
+		if o.ScheduleID == s.ScheduleID {
+			continue
+		}
+		oStart, oEnd := o.window()
+		switch {
+		case start.Before(oEnd) && oStart.Before(end):
+			add(ruleOverlap, fmt.Sprintf("Overlaps the %s shift on %s (%s-%s)", o.ShiftTime, o.ShiftDate, o.StartTime, o.EndTime), o.ScheduleID)
+		case !oStart.Before(end) && oStart.Sub(end) < p.minRest:
+			add(ruleMinRest, fmt.Sprintf("Leaves %g hours before the %s shift on %s; at least %g are required",
+				oStart.Sub(end).Hours(), o.ShiftTime, o.ShiftDate, p.minRest.Hours()), o.ScheduleID)
+		case !start.Before(oEnd) && start.Sub(oEnd) < p.minRest:
+			add(ruleMinRest, fmt.Sprintf("Starts %g hours after the %s shift on %s; at least %g are required",
+				start.Sub(oEnd).Hours(), o.ShiftTime, o.ShiftDate, p.minRest.Hours()), o.ScheduleID)
+		}
+		if d, err := time.Parse(dateLayout, o.ShiftDate); err == nil && !d.Before(monday) && d.Before(monday.AddDate(0, 0, 7)) {
+			weekly += oEnd.Sub(oStart)
+		}
+	}
+	if weekly > p.maxWeekly {
+		add(ruleMaxWeeklyHours, fmt.Sprintf("Brings the week of %s to %g hours; the limit is %g",
+			monday.Format(dateLayout), weekly.Hours(), p.maxWeekly.Hours()), 0)
+	}
+	return violations
+}
+
+// CoverageRequirement is a row of Shift_Coverage: the fewest staff of a role
+// that must be scheduled on every shift of a shift_time.
+type CoverageRequirement struct {
+	Role      string `json:"role"`
+	ShiftTime string `json:"shift_time"`
+	MinStaff  int    `json:"min_staff"`
+}
+
+// coverageSlot identifies the staff of one role on one shift.
+type coverageSlot struct {
+	Date, ShiftTime, Role string
+}
+
+// coverageShortfalls lists, in date then requirement order, the shifts from
+// through to on which fewer staff are scheduled than required. counts holds
+// the staff scheduled in each slot.
+func coverageShortfalls(reqs []CoverageRequirement, counts map[coverageSlot]int, from, to time.Time) []ScheduleViolation {
+	var violations []ScheduleViolation
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format(dateLayout)
+		for _, r := range reqs {
+			if n := counts[coverageSlot{date, r.ShiftTime, r.Role}]; n < r.MinStaff {
+				violations = append(violations, ScheduleViolation{
+					Rule:      ruleMinCoverage,
+					Message:   fmt.Sprintf("%d of the %d %s staff required are scheduled", n, r.MinStaff, r.Role),
+					ShiftDate: date,
+					ShiftTime: r.ShiftTime,
+					Role:      r.Role,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// errStaffNotFound is returned by checkShift when the staff member does not
+// exist.
+var errStaffNotFound = errors.New("staff member not found")
+
+// checkShift checks s against the labour rules. The staff member's row is
+// locked so their shifts are checked and changed one at a time.
+func checkShift(tx *sql.Tx, s Schedule) ([]ScheduleViolation, error) {
+	var locked int
+	err := tx.QueryRow("SELECT staff_id FROM Staff WHERE staff_id = ? FOR UPDATE", s.StaffID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil, errStaffNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	day, _ := time.Parse(dateLayout, s.ShiftDate)
+	monday := weekOf(day)
+	from := minTime(monday, day.AddDate(0, 0, -2))
+	to := maxTime(monday.AddDate(0, 0, 6), day.AddDate(0, 0, 2))
+	rows, err := tx.Query("SELECT "+scheduleColumns+" FROM Staff_Schedule WHERE staff_id = ? AND shift_date BETWEEN ? AND ? AND schedule_id <> ?",
+		s.StaffID, from.Format(dateLayout), to.Format(dateLayout), s.ScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var others []Schedule
+	for rows.Next() {
+		o, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		others = append(others, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return checkStaffShifts(s, others, labourRules), nil
+}
+
+// slotCoverage is the staff of one role scheduled on one shift, with the
+// Shift_Coverage requirement for it.
+type slotCoverage struct {
+	Requirement CoverageRequirement
+	Date        string
+	Staff       int
+}
+
+// countSlotStaff counts the staff of role scheduled on shiftTime on date.
+func countSlotStaff(q queryExecer, date, shiftTime, role string) (int, error) {
+	var n int
+	err := q.QueryRow(`SELECT COUNT(*) FROM Staff_Schedule ss JOIN Staff s ON s.staff_id = ss.staff_id
+		WHERE ss.shift_date = ? AND ss.shift_time = ? AND s.role = ?`, date, shiftTime, role).Scan(&n)
+	return n, err
+}
+
+// lockSlotCoverage counts the staff on s's shift of the same role as s's
+// staff member, before s is moved or removed. The requirement row is locked
+// so concurrent removals are counted one at a time. It returns nil if the
+// shift has no requirement.
+func lockSlotCoverage(tx *sql.Tx, s Schedule) (*slotCoverage, error) {
+	cov := slotCoverage{Requirement: CoverageRequirement{ShiftTime: s.ShiftTime}, Date: s.ShiftDate}
+	r := &cov.Requirement
+	if err := tx.QueryRow("SELECT role FROM Staff WHERE staff_id = ?", s.StaffID).Scan(&r.Role); err != nil {
+		return nil, err
+	}
+	err := tx.QueryRow("SELECT min_staff FROM Shift_Coverage WHERE role = ? AND shift_time = ? FOR UPDATE", r.Role, r.ShiftTime).Scan(&r.MinStaff)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cov.Staff, err = countSlotStaff(tx, s.ShiftDate, s.ShiftTime, r.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &cov, nil
+}
+
+// checkCoverageLoss checks, once a shift has been moved or removed, that the
+// slot counted by lockSlotCoverage beforehand has not lost the coverage its
+// requirement calls for.
+func checkCoverageLoss(tx *sql.Tx, before *slotCoverage) ([]ScheduleViolation, error) {
+	if before == nil {
+		return nil, nil
+	}
+	after, err := countSlotStaff(tx, before.Date, before.Requirement.ShiftTime, before.Requirement.Role)
+	if err != nil {
+		return nil, err
+	}
+	return coverageLost(*before, after), nil
+}
+
+// coverageLost reports the shortfall left when the staff on a slot drop from
+// before.Staff to after. Only a change that takes a covered slot below its
+// requirement counts: a slot already short may still lose a shift added to
+// it by mistake.
+func coverageLost(before slotCoverage, after int) []ScheduleViolation {
+	r := before.Requirement
+	if before.Staff < r.MinStaff || after >= r.MinStaff {
+		return nil
+	}
+	day, _ := time.Parse(dateLayout, before.Date)
+	return coverageShortfalls([]CoverageRequirement{r}, map[coverageSlot]int{{before.Date, r.ShiftTime, r.Role}: after}, day, day)
+}
+
+// scheduledShortfalls lists the shifts from through to that are short of
+// the staff Shift_Coverage requires, as coverageShortfalls does.
+func scheduledShortfalls(q queryExecer, from, to time.Time) ([]ScheduleViolation, error) {
+	reqs, err := coverageRequirements()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.Query(`SELECT ss.shift_date, ss.shift_time, s.role, COUNT(*)
+		FROM Staff_Schedule ss JOIN Staff s ON s.staff_id = ss.staff_id
+		WHERE ss.shift_date BETWEEN ? AND ?
+		GROUP BY ss.shift_date, ss.shift_time, s.role`, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[coverageSlot]int{}
+	for rows.Next() {
+		var day time.Time
+		var slot coverageSlot
+		var n int
+		if err := rows.Scan(&day, &slot.ShiftTime, &slot.Role, &n); err != nil {
+			return nil, err
+		}
+		slot.Date = day.Format(dateLayout)
+		counts[slot] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	shortfalls := coverageShortfalls(reqs, counts, from, to)
+	if shortfalls == nil {
+		shortfalls = []ScheduleViolation{}
+	}
+	return shortfalls, nil
+}
+
+// SkippedShift is a shift generateShifts did not create because it breaks
+// the labour rules.
+type SkippedShift struct {
+	Shift      Schedule            `json:"shift"`
+	Violations []ScheduleViolation `json:"violations"`
+}
+
+// generateShift adds one shift expanded from a template. It reports false
+// when the staff member already has the shift or when it breaks the labour
+// rules, returning the violations in the latter case.
+func generateShift(s *Schedule) (bool, []ScheduleViolation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, nil, err
+	}
+	defer tx.Rollback()
+
+	violations, err := checkShift(tx, *s)
+	if err != nil {
+		return false, nil, err
+	}
+	result, err := tx.Exec(`INSERT IGNORE INTO Staff_Schedule (staff_id, shift_date, shift_time, start_time, end_time, template_id)
+		VALUES (?, ?, ?, ?, ?, ?)`, s.StaffID, s.ShiftDate, s.ShiftTime, s.StartTime, s.EndTime, s.TemplateID)
+	if err != nil {
+		return false, nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil, nil
+	}
+	if len(violations) > 0 {
+		return false, violations, nil
+	}
+	id, _ := result.LastInsertId()
+	s.ScheduleID = int(id)
+	return true, nil, tx.Commit()
+}
+
+// getShiftCoverage handles GET /shift-coverage
+func getShiftCoverage(c *gin.Context) {
+	reqs, err := coverageRequirements()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching coverage requirements", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reqs)
+}
+
+// coverageRequirements returns Shift_Coverage in shift then role order.
+func coverageRequirements() ([]CoverageRequirement, error) {
+	rows, err := db.Query("SELECT role, shift_time, min_staff FROM Shift_Coverage ORDER BY FIELD(shift_time, 'Morning', 'Afternoon', 'Night'), role")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reqs := []CoverageRequirement{}
+	for rows.Next() {
+		var r CoverageRequirement
+		if err := rows.Scan(&r.Role, &r.ShiftTime, &r.MinStaff); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, r)
+	}
+	return reqs, rows.Err()
+}
+
+// updateShiftCoverage handles PUT /shift-coverage/:role/:shift_time
+// A min_staff of 0 removes the requirement.
+func updateShiftCoverage(c *gin.Context) {
+	r := CoverageRequirement{Role: c.Param("role"), ShiftTime: c.Param("shift_time")}
+	if !staffJobRoles[r.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be Manager, Receptionist, Housekeeping or Security"})
+		return
+	}
+	if _, ok := shiftDefaults[r.ShiftTime]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "shift_time must be Morning, Afternoon or Night"})
+		return
+	}
+	var req struct {
+		MinStaff *int `json:"min_staff"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.MinStaff == nil || *req.MinStaff < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_staff must be zero or more"})
+		return
+	}
+	r.MinStaff = *req.MinStaff
+
+	var err error
+	if r.MinStaff == 0 {
+		_, err = db.Exec("DELETE FROM Shift_Coverage WHERE role = ? AND shift_time = ?", r.Role, r.ShiftTime)
+	} else {
+		_, err = db.Exec(`INSERT INTO Shift_Coverage (role, shift_time, min_staff) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE min_staff = VALUES(min_staff)`, r.Role, r.ShiftTime, r.MinStaff)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating coverage requirement", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// getCoverageReport handles GET /shift-coverage/report
+// Lists the shifts between ?from= and ?to= (default the next 14 days, at most
+// maxGenerateDays) that have fewer staff of a role than Shift_Coverage
+// requires.
+func getCoverageReport(c *gin.Context) {
+	from, _ := time.Parse(dateLayout, time.Now().Format(dateLayout))
+	to := from.AddDate(0, 0, 13)
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(dateLayout, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(dateLayout, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+	}
+	if to.Before(from) || to.Sub(from) >= maxGenerateDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to must be on or after from and within %d days of it", maxGenerateDays)})
+		return
+	}
+
+	shortfalls, err := scheduledShortfalls(db, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting scheduled staff", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":       from.Format(dateLayout),
+		"to":         to.Format(dateLayout),
+		"shortfalls": shortfalls,
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckStaffShifts(t *testing.T) {
+	policy := labourPolicy{minRest: 8 * time.Hour, maxWeekly: 48 * time.Hour}
+	shift := func(id int, date, slot string) Schedule {
+		s := Schedule{ScheduleID: id, StaffID: 1, ShiftDate: date, ShiftTime: slot}
+		if msg, ok := s.normalize(); !ok {
+			t.Fatal(msg)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		s      Schedule
+		others []Schedule
+		want   []string
+	}{
+		{"no other shifts", shift(0, "2025-09-10", "Morning"), nil, nil},
+		{"afternoon then morning", shift(0, "2025-09-11", "Morning"),
+			[]Schedule{shift(1, "2025-09-10", "Afternoon")}, nil},
+		{"night then morning", shift(0, "2025-09-11", "Morning"),
+			[]Schedule{shift(1, "2025-09-10", "Night")}, []string{ruleMinRest}},
+		{"morning then same night", shift(0, "2025-09-10", "Morning"),
+			[]Schedule{shift(1, "2025-09-10", "Night")}, nil},
+		{"double shift", shift(0, "2025-09-10", "Afternoon"),
+			[]Schedule{shift(1, "2025-09-10", "Morning")}, []string{ruleMinRest}},
+		{"overlap", Schedule{StaffID: 1, ShiftDate: "2025-09-10", ShiftTime: "Morning", StartTime: "10:00", EndTime: "18:00"},
+			[]Schedule{shift(1, "2025-09-10", "Afternoon")}, []string{ruleOverlap}},
+		{"the shift being edited", shift(1, "2025-09-10", "Morning"),
+			[]Schedule{shift(1, "2025-09-10", "Morning")}, nil},
+		{"sixth shift of the week", shift(0, "2025-09-13", "Morning"), []Schedule{
+			shift(1, "2025-09-08", "Morning"), shift(2, "2025-09-09", "Morning"), shift(3, "2025-09-10", "Morning"),
+			shift(4, "2025-09-11", "Morning"), shift(5, "2025-09-12", "Morning"),
+		}, nil},
+		{"seventh shift of the week", shift(0, "2025-09-14", "Morning"), []Schedule{
+			shift(1, "2025-09-08", "Morning"), shift(2, "2025-09-09", "Morning"), shift(3, "2025-09-10", "Morning"),
+			shift(4, "2025-09-11", "Morning"), shift(5, "2025-09-12", "Morning"), shift(6, "2025-09-13", "Morning"),
+			shift(7, "2025-09-15", "Morning"),
+		}, []string{ruleMaxWeeklyHours}},
+	}
+	for _, test := range tests {
+		got := checkStaffShifts(test.s, test.others, policy)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: expected %v, got %+v", test.name, test.want, got)
+			continue
+		}
+		for i, rule := range test.want {
+			if got[i].Rule != rule {
+				t.Errorf("%s: expected %s, got %s", test.name, rule, got[i].Rule)
+			}
+		}
+	}
+}
+
+func TestCoverageShortfalls(t *testing.T) {
+	reqs := []CoverageRequirement{
+		{Role: "Receptionist", ShiftTime: "Morning", MinStaff: 1},
+		{Role: "Housekeeping", ShiftTime: "Morning", MinStaff: 2},
+	}
+	counts := map[coverageSlot]int{
+		{"2025-09-10", "Morning", "Receptionist"}:   1,
+		{"2025-09-10", "Morning", "Housekeeping"}:   1,
+		{"2025-09-11", "Morning", "Receptionist"}:   2,
+		{"2025-09-11", "Morning", "Housekeeping"}:   2,
+		{"2025-09-12", "Afternoon", "Receptionist"}: 1,
+	}
+	from, _ := time.Parse(dateLayout, "2025-09-10")
+	to, _ := time.Parse(dateLayout, "2025-09-12")
+	got := coverageShortfalls(reqs, counts, from, to)
+
+	want := []coverageSlot{
+		{"2025-09-10", "Morning", "Housekeeping"},
+		{"2025-09-12", "Morning", "Receptionist"},
+		{"2025-09-12", "Morning", "Housekeeping"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d shortfalls, got %d: %+v", len(want), len(got), got)
+	}
+	for i, w := range want {
+		if g := (coverageSlot{got[i].ShiftDate, got[i].ShiftTime, got[i].Role}); g != w {
+			t.Errorf("shortfall %d: expected %+v, got %+v", i, w, g)
+		}
+	}
+}
+
+func TestCoverageLost(t *testing.T) {
+	req := CoverageRequirement{Role: "Receptionist", ShiftTime: "Night", MinStaff: 2}
+	tests := []struct {
+		name          string
+		before, after int
+		want          bool
+	}{
+		{"covered shift left short", 2, 1, true},
+		{"covered shift stays covered", 3, 2, false},
+		// A shift added by mistake to an already short slot can still go.
+		{"already short", 1, 0, false},
+		{"already short, staff unchanged", 1, 1, false},
+		{"staff swapped within the slot", 2, 2, false},
+	}
+	for _, test := range tests {
+		got := coverageLost(slotCoverage{Requirement: req, Date: "2025-09-10", Staff: test.before}, test.after)
+		if (len(got) > 0) != test.want {
+			t.Errorf("%s: expected a violation %v, got %+v", test.name, test.want, got)
+			continue
+		}
+		if test.want && (got[0].Rule != ruleMinCoverage || got[0].ShiftDate != "2025-09-10" || got[0].Role != "Receptionist") {
+			t.Errorf("%s: unexpected violation %+v", test.name, got[0])
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of Guest_Preferences.category.
+var preferenceCategories = map[string]bool{
+	"room": true, "bedding": true, "accessibility": true, "dietary": true, "other": true,
+}
+
+// Values of Reservation_Requests.request_type.
+var requestTypes = map[string]bool{
+	"late_check_in": true, "early_check_in": true, "late_check_out": true, "extra_bed": true,
+	"crib": true, "accessibility": true, "dietary": true, "other": true,
+}
+
+// Values of Reservation_Requests.status. Requests start as requested and are
+// closed by staff as fulfilled or declined.
+const (
+	requestStatusRequested = "requested"
+	requestStatusFulfilled = "fulfilled"
+	requestStatusDeclined  = "declined"
+)
+
+// GuestPreference is a standing preference kept on the guest's profile and
+// applied to every stay.
+type GuestPreference struct {
+	PreferenceID int    `json:"preference_id"`
+	Category     string `json:"category"`
+	Preference   string `json:"preference"`
+}
+
+// ReservationRequest is a special request for a single stay.
+type ReservationRequest struct {
+	RequestID     int        `json:"request_id"`
+	ReservationID int        `json:"reservation_id"`
+	RequestType   string     `json:"request_type"`
+	Details       string     `json:"details"`
+	Status        string     `json:"status"`
+	StatusNote    string     `json:"status_note,omitempty"`
+	HandledBy     *int       `json:"handled_by,omitempty"`
+	HandledAt     *time.Time `json:"handled_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// validateRequests checks the type and details length of each request.
+func validateRequests(reqs []ReservationRequest) (string, bool) {
+	for _, r := range reqs {
+		if !requestTypes[r.RequestType] {
+			return "Unknown request_type " + strconv.Quote(r.RequestType), false
+		}
+		if len(r.Details) > 500 {
+			return "Request details must be at most 500 characters", false
+		}
+	}
+	return "", true
+}
+
+// insertReservationRequests stores new requests for a reservation.
+func insertReservationRequests(q queryExecer, reservationID int, reqs []ReservationRequest) error {
+	for i := range reqs {
+		result, err := q.Exec("INSERT INTO Reservation_Requests (reservation_id, request_type, details) VALUES (?, ?, ?)",
+			reservationID, reqs[i].RequestType, reqs[i].Details)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		reqs[i].RequestID = int(id)
+		reqs[i].ReservationID = reservationID
+		reqs[i].Status = requestStatusRequested
+	}
+	return nil
+}
+
+// reservationAccessible reports whether the reservation exists and belongs to
+// one of the caller's guests (any reservation for staff).
+func reservationAccessible(c *gin.Context, reservationID string) (bool, error) {
+	query := "SELECT 1 FROM Reservations r JOIN Guests g ON g.guest_id = r.guest_id WHERE r.reservation_id = ?"
+	args := []interface{}{reservationID}
+	if !isStaff(c) {
+		query += " AND g.user_id = ?"
+		args = append(args, c.GetInt("user_id"))
+	}
+	var exists int
+	err := db.QueryRow(query, args...).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// getGuestPreferences handles GET /guests/:id/preferences
+func getGuestPreferences(c *gin.Context) {
+	id := c.Param("id")
+	ok, err := guestAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching preferences", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+		return
+	}
+
+	rows, err := db.Query("SELECT preference_id, category, preference FROM Guest_Preferences WHERE guest_id = ? ORDER BY category, preference_id", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching preferences", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	prefs := []GuestPreference{}
+	for rows.Next() {
+		var p GuestPreference
+		if err := rows.Scan(&p.PreferenceID, &p.Category, &p.Preference); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning preference", "details": err.Error()})
+			return
+		}
+		prefs = append(prefs, p)
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// replaceGuestPreferences handles PUT /guests/:id/preferences
+// The body is the complete list of preferences; anything not in it is removed.
+func replaceGuestPreferences(c *gin.Context) {
+	id := c.Param("id")
+	var prefs []GuestPreference
+	if err := c.ShouldBindJSON(&prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	for _, p := range prefs {
+		if !preferenceCategories[p.Category] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category must be room, bedding, accessibility, dietary or other"})
+			return
+		}
+		if p.Preference == "" || len(p.Preference) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "preference must be 1 to 255 characters"})
+			return
+		}
+	}
+
+	ok, err := guestAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating preferences", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Guest not found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating preferences", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM Guest_Preferences WHERE guest_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating preferences", "details": err.Error()})
+		return
+	}
+	for i := range prefs {
+		result, err := tx.Exec("INSERT INTO Guest_Preferences (guest_id, category, preference) VALUES (?, ?, ?)",
+			id, prefs[i].Category, prefs[i].Preference)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating preferences", "details": err.Error()})
+			return
+		}
+		pid, _ := result.LastInsertId()
+		prefs[i].PreferenceID = int(pid)
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating preferences", "details": err.Error()})
+		return
+	}
+
+	if prefs == nil {
+		prefs = []GuestPreference{}
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+// scanReservationRequests reads rows selected with reservationRequestColumns.
+func scanReservationRequests(rows *sql.Rows) ([]ReservationRequest, error) {
+	defer rows.Close()
+	reqs := []ReservationRequest{}
+	for rows.Next() {
+		var r ReservationRequest
+		if err := rows.Scan(&r.RequestID, &r.ReservationID, &r.RequestType, &r.Details, &r.Status,
+			&r.StatusNote, &r.HandledBy, &r.HandledAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, r)
+	}
+	return reqs, rows.Err()
+}
+
+const reservationRequestColumns = `q.request_id, q.reservation_id, q.request_type, COALESCE(q.details, ''), q.status,
+	COALESCE(q.status_note, ''), q.handled_by, q.handled_at, q.created_at`
+
+// getReservationRequests handles GET /reservations/:id/requests
+func getReservationRequests(c *gin.Context) {
+	id := c.Param("id")
+	ok, err := reservationAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching requests", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+
+	rows, err := db.Query("SELECT "+reservationRequestColumns+" FROM Reservation_Requests q WHERE q.reservation_id = ? ORDER BY q.request_id", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching requests", "details": err.Error()})
+		return
+	}
+	reqs, err := scanReservationRequests(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning requests", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reqs)
+}
+
+// addReservationRequest handles POST /reservations/:id/requests
+func addReservationRequest(c *gin.Context) {
+	id := c.Param("id")
+	var req ReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	reqs := []ReservationRequest{req}
+	if msg, ok := validateRequests(reqs); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ok, err := reservationAccessible(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding request", "details": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+
+	reservationID, _ := strconv.Atoi(id)
+	if err := insertReservationRequests(db, reservationID, reqs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding request", "details": err.Error()})
+		return
+	}
+	reqs[0].CreatedAt = time.Now()
+	c.JSON(http.StatusCreated, reqs[0])
+}
+
+// updateReservationRequestStatus handles PUT /reservation-requests/:id/status
+// Staff close a request as fulfilled or declined (or reopen it).
+func updateReservationRequestStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+
+	var err error
+	var result sql.Result
+	switch req.Status {
+	case requestStatusFulfilled, requestStatusDeclined:
+		result, err = db.Exec("UPDATE Reservation_Requests SET status = ?, status_note = ?, handled_by = ?, handled_at = ? WHERE request_id = ?",
+			req.Status, req.Note, c.GetInt("user_id"), time.Now(), c.Param("id"))
+	case requestStatusRequested:
+		result, err = db.Exec("UPDATE Reservation_Requests SET status = ?, status_note = ?, handled_by = NULL, handled_at = NULL WHERE request_id = ?",
+			req.Status, req.Note, c.Param("id"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be requested, fulfilled or declined"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating request", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists int
+		err := db.QueryRow("SELECT 1 FROM Reservation_Requests WHERE request_id = ?", c.Param("id")).Scan(&exists)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Request not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating request", "details": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Request updated", "status": req.Status})
+}
+
+// reservationRequestSorts and reservationRequestFilters are the list options
+// accepted by GET /reservation-requests.
+var (
+	reservationRequestSorts = map[string]string{
+		"request_id":    "q.request_id",
+		"check_in_date": "r.check_in_date",
+	}
+	reservationRequestFilters = map[string]string{
+		"status":         "q.status",
+		"request_type":   "q.request_type",
+		"reservation_id": "q.reservation_id",
+		"room_id":        "r.room_id",
+	}
+)
+
+// getOpenRequests handles GET /reservation-requests
+// It is the front desk and housekeeping worklist: requests across all
+// reservations, by default those still open for stays arriving soonest.
+// ?from= and ?to= (YYYY-MM-DD) limit it to stays overlapping those dates.
+func getOpenRequests(c *gin.Context) {
+	lq, err := parseListQuery(c, reservationRequestSorts, "check_in_date", "q.request_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where, args := equalityFilters(c, reservationRequestFilters)
+	where = " WHERE TRUE" + where
+	if c.Query("status") == "" {
+		where += " AND q.status = ?"
+		args = append(args, requestStatusRequested)
+	}
+	for param, cond := range map[string]string{"from": " AND r.check_out_date >= ?", "to": " AND r.check_in_date <= ?"} {
+		if v := c.Query(param); v != "" {
+			if _, err := time.Parse(dateLayout, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a date in YYYY-MM-DD format"})
+				return
+			}
+			where += cond
+			args = append(args, v)
+		}
+	}
+
+	const from = " FROM Reservation_Requests q JOIN Reservations r ON r.reservation_id = q.reservation_id"
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting requests", "details": err.Error()})
+		return
+	}
+
+	keyset, keysetArgs := lq.keyset()
+	rows, err := db.Query("SELECT "+reservationRequestColumns+", r.room_id, r.check_in_date, "+lq.sortValueExpr()+
+		from+where+keyset+lq.orderLimit(), append(args, keysetArgs...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching requests", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	type worklistItem struct {
+		ReservationRequest
+		RoomID      int    `json:"room_id"`
+		CheckInDate string `json:"check_in_date"`
+	}
+	var items []worklistItem
+	var keys []listCursor
+	for rows.Next() {
+		var it worklistItem
+		var k listCursor
+		var checkIn time.Time
+		if err := rows.Scan(&it.RequestID, &it.ReservationID, &it.RequestType, &it.Details, &it.Status,
+			&it.StatusNote, &it.HandledBy, &it.HandledAt, &it.CreatedAt, &it.RoomID, &checkIn, &k.Value); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning request", "details": err.Error()})
+			return
+		}
+		it.CheckInDate = checkIn.Format(dateLayout)
+		k.ID = it.RequestID
+		items = append(items, it)
+		keys = append(keys, k)
+	}
+	c.JSON(http.StatusOK, newListPage(items, keys, lq, total))
+}
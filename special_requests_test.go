@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		reqs []ReservationRequest
+		ok   bool
+	}{
+		{"none", nil, true},
+		{"valid", []ReservationRequest{{RequestType: "extra_bed"}, {RequestType: "dietary", Details: "Nut allergy"}}, true},
+		{"unknown type", []ReservationRequest{{RequestType: "helicopter"}}, false},
+		{"details too long", []ReservationRequest{{RequestType: "other", Details: strings.Repeat("x", 501)}}, false},
+	}
+	for _, test := range tests {
+		if _, ok := validateRequests(test.reqs); ok != test.ok {
+			t.Errorf("%s: expected ok=%v, got %v", test.name, test.ok, ok)
+		}
+	}
+}
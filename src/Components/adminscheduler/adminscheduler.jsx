@@ -11,19 +11,87 @@ const daysOfWeek = ['Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Sat
 //const staffOptions = ['Alice', 'Bob', 'Charlie', 'Diana', 'Ethan', 'Fiona', 'George', 'Hannah'];
 const timeSlots = ['Morning', 'Afternoon', 'Night'];
 
+// Dates are handled as local YYYY-MM-DD strings, the format /schedules uses.
+const toDateString = (d) => {
+  const month = String(d.getMonth() + 1).padStart(2, '0');
+  const day = String(d.getDate()).padStart(2, '0');
+  return `${d.getFullYear()}-${month}-${day}`;
+};
+
+const mondayOf = (d) => {
+  const monday = new Date(d.getFullYear(), d.getMonth(), d.getDate());
+  monday.setDate(monday.getDate() - ((monday.getDay() + 6) % 7));
+  return monday;
+};
+
+const weekDates = (monday) => daysOfWeek.map((_, i) => {
+  const d = new Date(monday);
+  d.setDate(monday.getDate() + i);
+  return toDateString(d);
+});
+
+// Spells out the scheduling rules a rejected change breaks (422 responses).
+const failureMessage = (err, fallback) => {
+  const violations = err.response?.data?.violations;
+  if (!violations?.length) return fallback;
+  return [err.response.data.error, ...violations.map(v => `- ${v.shift_date} ${v.shift_time}: ${v.message}`)].join('\n');
+};
+
+const authHeaders = () => ({
+  'Authorization': `Bearer ${localStorage.getItem('token')}`,
+  'Content-Type': 'application/json'
+});
+
 const StaffScheduler = () => {
   const [selectedRoomType, setSelectedRoomType] = useState(roomTypes[0]);
   const [roomCount, setRoomCount] = useState('');
   const [roomAvailability, setRoomAvailability] = useState({});
-  const [selectedDay, setSelectedDay] = useState('Monday');
+  const [weekStart, setWeekStart] = useState(() => mondayOf(new Date()));
+  const [selectedDay, setSelectedDay] = useState(() => toDateString(new Date()));
   const [selectedStaff, setSelectedStaff] = useState([]);
   const [selectedSlot, setSelectedSlot] = useState('Morning');
   const [schedule, setSchedule] = useState({});
   const [editing, setEditing] = useState({});
   const [staffOptions, setStaffOptions] = useState([]);
   const [reverseStaffMap, setReverseStaffMap] = useState({});
+  const [staffMap, setStaffMap] = useState({});
+
+  const dates = weekDates(weekStart);
+
+  // Groups /schedules rows by shift_date, keeping schedule_id for edits.
+  const groupByDate = (entries, names) => {
+    const grouped = {};
+    (entries || []).forEach(({ schedule_id, staff_id, shift_date, shift_time }) => {
+      const name = names[staff_id] || `Staff ${staff_id}`;
+      if (!grouped[shift_date]) grouped[shift_date] = [];
+      grouped[shift_date].push({ schedule_id, name, slot: shift_time });
+    });
+    return grouped;
+  };
 
   useEffect(() => {
+    const shown = weekDates(weekStart);
+    const from = shown[0];
+    const to = shown[6];
+
+    // /schedules is paginated; follow next_cursor until every page is loaded.
+    const fetchAllSchedules = async () => {
+      const all = [];
+      let cursor = null;
+      do {
+        const res = await axios.get("http://localhost:3000/schedules", {
+          params: { limit: 200, from, to, ...(cursor ? { cursor } : {}) },
+          headers: {
+            'Authorization': `Bearer ${localStorage.getItem('token')}`, // If using JWT token for auth
+            'Content-Type': 'application/json'
+          }
+        });
+        all.push(...res.data.data);
+        cursor = res.data.next_cursor;
+      } while (cursor);
+      return all;
+    };
+
     const fetchSchedulesAndStaff = async () => {
       try {
         const [staffRes, scheduleRes] = await Promise.all([
@@ -34,17 +102,11 @@ const StaffScheduler = () => {
               'Content-Type': 'application/json'
           }
           }),
-          axios.get("http://localhost:3000/schedules", {
-            headers: {
-              'Authorization': `Bearer ${localStorage.getItem('token')}`, // If using JWT token for auth
-                
-              'Content-Type': 'application/json'
-            }
-          })
+          fetchAllSchedules()
         ]);
 
         const staffList = staffRes.data;
-        const scheduleList = scheduleRes.data;
+        const scheduleList = scheduleRes;
         setStaffOptions(staffList.map(staff => staff.first_name));
 
         // Create map: staff_id -> first_name
@@ -52,6 +114,7 @@ const StaffScheduler = () => {
         staffList.forEach(staff => {
           staffMap[staff.staff_id] = staff.first_name;
         });
+        setStaffMap(staffMap);
 
         const reverseStaffMap = {};
         staffList.forEach(staff => {
@@ -60,37 +123,23 @@ const StaffScheduler = () => {
         setReverseStaffMap(reverseStaffMap);
 
 
-        console.log(staffMap);
-        console.log(scheduleList);
-
-        // Organize schedule by weekday
-        const parsedSchedule = {};
-
-        (scheduleList || []).forEach(entry => {
-          const { staff_id, shift_date, shift_time } = entry;
-
-          const dayOfWeek = shift_date;
-
-
-          const name = staffMap[staff_id] || `Staff ${staff_id}`;
-          if (!parsedSchedule[dayOfWeek]) parsedSchedule[dayOfWeek] = [];
-          parsedSchedule[dayOfWeek].push({ name, slot: shift_time });
-
-          console.log('Parsed:', { shift_date, dayOfWeek, name, slot: shift_time });
-          console.log('Staff Name:', staffMap[staff_id]);
-
-        });
-
-        setSchedule(parsedSchedule);
-        console.log("Final schedule state:", schedule);
-
+        setSchedule(groupByDate(scheduleList, staffMap));
       } catch (err) {
         console.error("Error fetching schedules or staff:", err);
       }
     };
 
     fetchSchedulesAndStaff();
-  }, []);
+  }, [weekStart]);
+
+  const changeWeek = (weeks) => {
+    setWeekStart(prev => {
+      const next = new Date(prev);
+      next.setDate(prev.getDate() + weeks * 7);
+      setSelectedDay(toDateString(next));
+      return next;
+    });
+  };
 
 
   const handleRoomSave = (e) => {
@@ -121,50 +170,43 @@ const StaffScheduler = () => {
     setEditing({
       day,
       index,
+      schedule_id: entry.schedule_id,
       name: entry.name,
       slot: entry.slot
     });
   };
 
   const saveEditedEntry = async () => {
-    const { day, index, name, slot } = editing;
+    const { day, index, schedule_id, name, slot } = editing;
     const staff_id = reverseStaffMap[name];
 
     try {
-      await axios.put(`http://localhost:3000/schedule/${staff_id}`, null, {
-        params: {
-          shift_date: day,
-          new_shift_time: slot
-        },
-        headers: {
-          'Authorization': `Bearer ${localStorage.getItem('token')}`,
-          'Content-Type': 'application/json'
-        }
+      await axios.put(`http://localhost:3000/schedule/${schedule_id}`, {
+        staff_id,
+        shift_date: day,
+        shift_time: slot
+      }, {
+        headers: authHeaders()
       });
 
       setSchedule(prev => {
         const updated = [...prev[day]];
-        updated[index] = { name, slot };
+        updated[index] = { schedule_id, name, slot };
         return { ...prev, [day]: updated };
     });
 
     setEditing({});
     } catch (err) {
       console.error("Failed to update schedule:", err);
-      alert("Failed to update schedule on server.");
+      alert(failureMessage(err, "Failed to update schedule on server."));
     }
   };
 
   const deleteEntry = async (day, index) => {
     const entry = schedule[day][index];
-    const staff_id = reverseStaffMap[entry.name];
   
     try {
-      await axios.delete(`http://localhost:3000/schedule/${staff_id}`, {
-        params: {
-          shift_date: day,
-          shift_time: entry.slot,
-        },
+      await axios.delete(`http://localhost:3000/schedule/${entry.schedule_id}`, {
         headers: {
           'Authorization': `Bearer ${localStorage.getItem('token')}`,
         },
@@ -182,7 +224,7 @@ const StaffScheduler = () => {
       }
     } catch (err) {
       console.error("Failed to delete schedule:", err);
-      alert("Failed to delete schedule from the server.");
+      alert(failureMessage(err, "Failed to delete schedule from the server."));
     }
   };
 
@@ -203,18 +245,48 @@ const StaffScheduler = () => {
       // Update local state
       setSchedule(prev => ({
         ...prev,
-        [day]: [...(prev[day] || []), { name: staffName, slot }]
+        [day]: [...(prev[day] || []), { schedule_id: res.data.schedule_id, name: staffName, slot }]
       }));
   
       //alert("Staff assigned successfully!");
     } catch (err) {
       console.error("Failed to assign staff:", err);
-      alert("Failed to assign staff to schedule.");
+      alert(failureMessage(err, "Failed to assign staff to schedule."));
+    }
+  };
+
+  // Fills the shown week from the staff members' weekly shift templates.
+  const generateWeek = async () => {
+    try {
+      const res = await axios.post("http://localhost:3000/shift-templates/generate", {
+        from: dates[0],
+        to: dates[6],
+      }, {
+        headers: authHeaders()
+      });
+
+      const created = groupByDate(res.data.created, staffMap);
+      setSchedule(prev => {
+        const merged = { ...prev };
+        Object.entries(created).forEach(([day, entries]) => {
+          merged[day] = [...(merged[day] || []), ...entries];
+        });
+        return merged;
+      });
+
+      const skipped = res.data.skipped || [];
+      if (skipped.length) {
+        alert(`${skipped.length} shift(s) were skipped because they break scheduling rules:\n` +
+          skipped.map(s => `- ${s.shift.shift_date} ${s.shift.shift_time}: ${s.violations[0].message}`).join('\n'));
+      }
+    } catch (err) {
+      console.error("Failed to generate shifts:", err);
+      alert("Failed to generate shifts from templates.");
     }
   };
   
 
-  const today = new Date().toLocaleString('en-US', { weekday: 'long' });
+  const today = toDateString(new Date());
   console.log('day today:', today);
   const todayStaff = schedule[today] || [];
 
@@ -264,11 +336,11 @@ const StaffScheduler = () => {
         <h3>Assign Housekeeping Staff</h3>
         <div className="formGroup">
           <label>Select Day</label>
-          <select value={selectedDay} onChange={e => setSelectedDay(e.target.value)}>
-            {daysOfWeek.map(day => (
-              <option key={day} value={day}>{day}</option>
-            ))}
-          </select>
+          <input
+            type="date"
+            value={selectedDay}
+            onChange={e => setSelectedDay(e.target.value)}
+          />
         </div>
 
         <div className="formGroup">
@@ -304,13 +376,19 @@ const StaffScheduler = () => {
       {/* Weekly Schedule */}
       <div className="fullSchedule">
         <h3>Weekly Schedule</h3>
-        {daysOfWeek.map(day => (
+        <div className="weekNav">
+          <button type="button" onClick={() => changeWeek(-1)}>Previous Week</button>
+          <span>Week of {dates[0]}</span>
+          <button type="button" onClick={() => changeWeek(1)}>Next Week</button>
+          <button type="button" className="generateBtn" onClick={generateWeek}>Generate from Templates</button>
+        </div>
+        {dates.map((day, i) => (
           <div key={day} className="dayBlock">
-            <h4>{day}</h4>
+            <h4>{daysOfWeek[i]} {day}</h4>
             <ul>
               {(schedule[day] || []).length > 0 ? (
                 schedule[day].map((entry, idx) => (
-                  <li key={idx} className="editableEntry">
+                  <li key={entry.schedule_id || idx} className="editableEntry">
                     {editing.day === day && editing.index === idx ? (
                       <>
                         <select
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238 Appendix B.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; authenticator apps use the last 6.
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		step, ok := verifyTOTP(rfc6238Secret, want, time.Unix(unix, 0), 0)
+		if !ok {
+			t.Errorf("time %d: expected %s to verify", unix, want)
+		}
+		if step != unix/totpPeriod {
+			t.Errorf("time %d: expected step %d but got %d", unix, unix/totpPeriod, step)
+		}
+	}
+}
+
+func TestTOTPWindowAndReplay(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code := "081804"
+
+	if _, ok := verifyTOTP(rfc6238Secret, code, now.Add(totpPeriod*time.Second), 0); !ok {
+		t.Error("expected code from the previous period to be accepted")
+	}
+	if _, ok := verifyTOTP(rfc6238Secret, code, now.Add(3*totpPeriod*time.Second), 0); ok {
+		t.Error("expected code from three periods ago to be rejected")
+	}
+	step, _ := verifyTOTP(rfc6238Secret, code, now, 0)
+	if _, ok := verifyTOTP(rfc6238Secret, code, now, step); ok {
+		t.Error("expected an already used code to be rejected")
+	}
+	if _, ok := verifyTOTP(rfc6238Secret, "123456", now, 0); ok {
+		t.Error("expected a wrong code to be rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := totpProvisioningURI("JBSWY3DPEHPK3PXP", "admin@gmail.com")
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("Could not parse URI: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("unexpected URI: %s", uri)
+	}
+	if !strings.Contains(parsed.Path, "admin@gmail.com") {
+		t.Errorf("expected account label in %s", uri)
+	}
+	if parsed.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || parsed.Query().Get("issuer") != totpIssuer {
+		t.Errorf("unexpected query in %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code format %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) != recoveryCodeCount {
+		t.Errorf("expected %d unique codes, got %d", recoveryCodeCount, len(seen))
+	}
+	if normalizeRecoveryCode("AB12C-34DEF") != normalizeRecoveryCode("ab12c34def") {
+		t.Error("expected recovery codes to match regardless of dash and case")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recoveryCodeCount is how many recovery codes are issued at a time.
+const recoveryCodeCount = 10
+
+// twoFactorRequiredRoles lists the Users.role values that must use 2FA.
+var twoFactorRequiredRoles = map[string]bool{"manager": true, "admin": true}
+
+// initTwoFactorPolicy reads TWO_FACTOR_REQUIRED_ROLES, a comma-separated list
+// of roles that must enrol in 2FA before using the API.
+func initTwoFactorPolicy() {
+	v, ok := os.LookupEnv("TWO_FACTOR_REQUIRED_ROLES")
+	if !ok {
+		return
+	}
+	twoFactorRequiredRoles = map[string]bool{}
+	for _, role := range strings.Split(v, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			twoFactorRequiredRoles[role] = true
+		}
+	}
+}
+
+// RequireTwoFactor rejects sessions whose role requires 2FA but that were not
+// established with a second factor. It runs after AuthMiddleware; the /2fa
+// routes are left outside it so those users can still enrol.
+func RequireTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*Claims)
+		if twoFactorRequiredRoles[claims.Role] && !claims.MFA {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                          "Two-factor authentication is required for your role",
+				"two_factor_enrollment_required": true,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkSecondFactor validates a TOTP or recovery code presented at login.
+// A matched TOTP step is recorded so the same code cannot be replayed.
+func checkSecondFactor(userID int, secret string, lastStep int64, totpCode, recoveryCode string, now time.Time) (bool, error) {
+	if totpCode != "" {
+		step, ok := verifyTOTP(secret, totpCode, now, lastStep)
+		if !ok {
+			return false, nil
+		}
+		// The step condition makes concurrent use of the same code fail.
+		res, err := db.Exec("UPDATE Users SET totp_last_step = ? WHERE user_id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)",
+			step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, _ := res.RowsAffected()
+		return n == 1, nil
+	}
+
+	res, err := db.Exec("UPDATE User_Recovery_Codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now, userID, hashAuthToken(normalizeRecoveryCode(recoveryCode)))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and issues new ones.
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM User_Recovery_Codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec("INSERT INTO User_Recovery_Codes (user_id, code_hash) VALUES (?, ?)",
+			userID, hashAuthToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// enrollTwoFactor handles POST /2fa/enroll
+// It generates a new secret and returns the provisioning URI to show as a QR
+// code. 2FA is not active until the first code is confirmed.
+func enrollTwoFactor(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+
+	var enabled bool
+	if err := db.QueryRow("SELECT totp_enabled FROM Users WHERE user_id = ?", claims.UserID).Scan(&enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting 2FA enrollment", "details": err.Error()})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating 2FA secret"})
+		return
+	}
+	if _, err := db.Exec("UPDATE Users SET totp_secret = ?, totp_last_step = NULL WHERE user_id = ?", secret, claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting 2FA enrollment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": totpProvisioningURI(secret, claims.Email),
+	})
+}
+
+// confirmTwoFactor handles POST /2fa/confirm
+// The first valid code activates 2FA and returns the recovery codes (shown
+// only once) together with a new token that carries the second factor.
+func confirmTwoFactor(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	err := db.QueryRow("SELECT totp_secret, totp_enabled FROM Users WHERE user_id = ?", claims.UserID).Scan(&secret, &enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming 2FA", "details": err.Error()})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment with POST /2fa/enroll first"})
+		return
+	}
+	step, ok := verifyTOTP(secret.String, req.Code, time.Now(), 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming 2FA", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE Users SET totp_enabled = TRUE, totp_last_step = ? WHERE user_id = ?", step, claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming 2FA", "details": err.Error()})
+		return
+	}
+	codes, err := replaceRecoveryCodes(tx, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming 2FA", "details": err.Error()})
+		return
+	}
+
+	tokenString, err := issueToken(claims.UserID, claims.Email, claims.Role, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+		"token":          tokenString,
+	})
+}
+
+// regenerateRecoveryCodes handles POST /2fa/recovery-codes
+func regenerateRecoveryCodes(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	if !claims.MFA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Log in with your second factor to manage recovery codes"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// disableTwoFactor handles POST /2fa/disable
+func disableTwoFactor(c *gin.Context) {
+	claims := c.MustGet("claims").(*Claims)
+	if twoFactorRequiredRoles[claims.Role] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	if !claims.MFA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Log in with your second factor to disable 2FA"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling 2FA", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE Users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL WHERE user_id = ?", claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling 2FA", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM User_Recovery_Codes WHERE user_id = ?", claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling 2FA", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling 2FA", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
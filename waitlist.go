@@ -0,0 +1,401 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Waitlist.status values. An entry is offered a room by putting a hold on it
+// in the guest's name; booking with that hold marks the entry booked.
+const (
+	waitlistWaiting   = "waiting"
+	waitlistOffered   = "offered"
+	waitlistBooked    = "booked"
+	waitlistExpired   = "expired"
+	waitlistCancelled = "cancelled"
+)
+
+// waitlistOfferTTL is how long a guest has to book a room offered from the
+// waitlist before it passes to the next guest.
+var waitlistOfferTTL = 2 * time.Hour
+
+// WaitlistEntry is a row of Waitlist.
+type WaitlistEntry struct {
+	WaitlistID   int        `json:"waitlist_id"`
+	UserID       int        `json:"user_id"`
+	RoomType     string     `json:"room_type"`
+	CheckInDate  string     `json:"check_in_date"`
+	CheckOutDate string     `json:"check_out_date"`
+	Status       string     `json:"status"`
+	RoomID       *int       `json:"room_id,omitempty"`
+	HoldID       *int       `json:"hold_id,omitempty"`
+	OfferedAt    *time.Time `json:"offered_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// WaitlistOffer is sent to a guest when a room is held for them.
+type WaitlistOffer struct {
+	WaitlistID int
+	Email      string
+	RoomType   string
+	Hold       RoomHold
+}
+
+// WaitlistNotifier tells waitlisted guests about rooms held for them.
+type WaitlistNotifier interface {
+	NotifyOffer(offer WaitlistOffer) error
+}
+
+// waitlistNotifier is the WaitlistNotifier used when offering rooms.
+var waitlistNotifier WaitlistNotifier = mailWaitlistNotifier{}
+
+// mailWaitlistNotifier emails the offer, including the hold token, through
+// the configured Mailer.
+type mailWaitlistNotifier struct{}
+
+func (mailWaitlistNotifier) NotifyOffer(o WaitlistOffer) error {
+	return mailer.Send(MailMessage{
+		To:      o.Email,
+		Subject: "A room is available for your GatorNest Inn stay",
+		Body: fmt.Sprintf("Good news! A %s room has opened up for %s to %s and we are holding it for you until %s.\n\nBook it here before the hold expires:\n\n%s/book?hold_token=%s\n",
+			o.RoomType, o.Hold.CheckInDate, o.Hold.CheckOutDate, o.Hold.ExpiresAt.Format(time.RFC1123), appBaseURL(), o.Hold.Token),
+	})
+}
+
+// initWaitlist reads the offer window from the environment and starts the
+// job that passes unclaimed offers on.
+func initWaitlist() {
+	waitlistOfferTTL = time.Duration(envInt("WAITLIST_OFFER_MINUTES", int(waitlistOfferTTL/time.Minute))) * time.Minute
+
+	registerJob("waitlist-offers", "WAITLIST_SWEEP_INTERVAL", "* * * * *", func() error {
+		n, err := expireWaitlistOffers()
+		if n > 0 {
+			log.Printf("Expired %d unclaimed waitlist offers", n)
+		}
+		return err
+	})
+}
+
+// waitlistCandidate is a waiting entry that may be offered a freed room.
+type waitlistCandidate struct {
+	id, userID int
+	email      string
+	stay       stayRange
+	createdAt  time.Time
+}
+
+// matchWaitlist picks the candidates to offer a room freed for freed, oldest
+// entry first. A candidate matches if its stay overlaps freed, does not
+// overlap a stay already picked and is not refused by conflict, which
+// reports whether the room is otherwise taken for the stay.
+func matchWaitlist(candidates []waitlistCandidate, freed stayRange, conflict func(stayRange) (bool, error)) ([]waitlistCandidate, error) {
+	ordered := append([]waitlistCandidate(nil), candidates...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if !ordered[i].createdAt.Equal(ordered[j].createdAt) {
+			return ordered[i].createdAt.Before(ordered[j].createdAt)
+		}
+		return ordered[i].id < ordered[j].id
+	})
+
+	var picked []waitlistCandidate
+next:
+	for _, c := range ordered {
+		if !c.stay.overlaps(freed) {
+			continue
+		}
+		for _, p := range picked {
+			if c.stay.overlaps(p.stay) {
+				continue next
+			}
+		}
+		taken, err := conflict(c.stay)
+		if err != nil {
+			return nil, err
+		}
+		if !taken {
+			picked = append(picked, c)
+		}
+	}
+	return picked, nil
+}
+
+// offerFreedRoom offers roomID to waitlisted guests, oldest entry first, now
+// that freed is no longer booked. Every waiting entry for the room's type
+// whose whole stay fits gets a hold, so one long cancellation can satisfy
+// several shorter requests.
+func offerFreedRoom(roomID int, freed stayRange) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockRooms(tx, []int{roomID}); err != nil {
+		return err
+	}
+	var roomType string
+	if err := tx.QueryRow("SELECT room_type FROM Rooms WHERE room_id = ?", roomID).Scan(&roomType); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT w.waitlist_id, w.user_id, u.email, w.check_in_date, w.check_out_date, w.created_at
+		FROM Waitlist w JOIN Users u ON u.user_id = w.user_id
+		WHERE w.room_type = ? AND w.status = ? AND w.check_in_date < ? AND w.check_out_date > ?
+		FOR UPDATE`,
+		roomType, waitlistWaiting, freed.CheckOut.Format(dateLayout), freed.CheckIn.Format(dateLayout))
+	if err != nil {
+		return err
+	}
+	var candidates []waitlistCandidate
+	for rows.Next() {
+		var c waitlistCandidate
+		if err := rows.Scan(&c.id, &c.userID, &c.email, &c.stay.CheckIn, &c.stay.CheckOut, &c.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	picked, err := matchWaitlist(candidates, freed, func(stay stayRange) (bool, error) {
+		conflict, err := roomConflict(tx, roomID, stay)
+		return conflict != "", err
+	})
+	if err != nil {
+		return err
+	}
+
+	var offers []WaitlistOffer
+	for _, c := range picked {
+		hold, err := insertRoomHold(tx, c.userID, roomID, c.stay, waitlistOfferTTL)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE Waitlist SET status = ?, room_id = ?, hold_id = ?, offered_at = ? WHERE waitlist_id = ?",
+			waitlistOffered, roomID, hold.HoldID, time.Now(), c.id); err != nil {
+			return err
+		}
+		offers = append(offers, WaitlistOffer{WaitlistID: c.id, Email: c.email, RoomType: roomType, Hold: hold})
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, o := range offers {
+		if err := waitlistNotifier.NotifyOffer(o); err != nil {
+			log.Printf("Error notifying waitlist entry %d: %v", o.WaitlistID, err)
+		}
+	}
+	return nil
+}
+
+// releaseToWaitlist offers a room freed by a cancellation, logging rather
+// than failing since the cancellation itself has already succeeded.
+func releaseToWaitlist(roomID int, freed stayRange) {
+	if err := offerFreedRoom(roomID, freed); err != nil {
+		log.Printf("Error offering room %d to the waitlist: %v", roomID, err)
+	}
+}
+
+// expireWaitlistOffers closes offers whose hold has expired or been released
+// without a booking, passing each room on to the next guest, and expires
+// waiting entries whose check-in date has passed.
+func expireWaitlistOffers() (int, error) {
+	if _, err := db.Exec("UPDATE Waitlist SET status = ? WHERE status = ? AND check_in_date < CURDATE()",
+		waitlistExpired, waitlistWaiting); err != nil {
+		return 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT waitlist_id, room_id, check_in_date, check_out_date FROM Waitlist w
+		WHERE status = ? AND NOT EXISTS (SELECT 1 FROM Room_Holds h WHERE h.hold_id = w.hold_id AND h.expires_at > ?)`,
+		waitlistOffered, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	type lapsed struct {
+		id, roomID int
+		stay       stayRange
+	}
+	var offers []lapsed
+	for rows.Next() {
+		var l lapsed
+		if err := rows.Scan(&l.id, &l.roomID, &l.stay.CheckIn, &l.stay.CheckOut); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		offers = append(offers, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, l := range offers {
+		// The status check guards against a booking that consumed the hold
+		// since the query above.
+		result, err := db.Exec("UPDATE Waitlist SET status = ? WHERE waitlist_id = ? AND status = ?",
+			waitlistExpired, l.id, waitlistOffered)
+		if err != nil {
+			return n, err
+		}
+		if changed, _ := result.RowsAffected(); changed == 0 {
+			continue
+		}
+		n++
+		if err := offerFreedRoom(l.roomID, l.stay); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// joinWaitlist handles POST /waitlist
+// Only sold-out stays can be waitlisted; if a room of the type is free the
+// available rooms are returned with 409 instead.
+func joinWaitlist(c *gin.Context) {
+	var entry WaitlistEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if !roomTypes[entry.RoomType] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "room_type must be Single, Double, Suite or Deluxe"})
+		return
+	}
+	stay, err := parseStay(entry.CheckInDate, entry.CheckOutDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	today, _ := time.Parse(dateLayout, time.Now().Format(dateLayout))
+	if stay.CheckIn.Before(today) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "check_in_date is in the past"})
+		return
+	}
+	entry.UserID = c.GetInt("user_id")
+
+	rooms, err := availableRooms(entry.RoomType, stay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking availability", "details": err.Error()})
+		return
+	}
+	if len(rooms) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Rooms are available for these dates; book one instead", "rooms": rooms})
+		return
+	}
+
+	var existing int
+	err = db.QueryRow(`SELECT waitlist_id FROM Waitlist WHERE user_id = ? AND room_type = ? AND check_in_date = ? AND check_out_date = ?
+		AND status IN (?, ?)`, entry.UserID, entry.RoomType, entry.CheckInDate, entry.CheckOutDate, waitlistWaiting, waitlistOffered).Scan(&existing)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already on the waitlist for this stay", "waitlist_id": existing})
+		return
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error joining waitlist", "details": err.Error()})
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO Waitlist (user_id, room_type, check_in_date, check_out_date) VALUES (?, ?, ?, ?)",
+		entry.UserID, entry.RoomType, entry.CheckInDate, entry.CheckOutDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error joining waitlist", "details": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	entry.WaitlistID = int(id)
+	entry.Status = waitlistWaiting
+	entry.CreatedAt = time.Now()
+	entry.RoomID, entry.HoldID, entry.OfferedAt = nil, nil, nil
+	c.JSON(http.StatusCreated, entry)
+}
+
+// waitlistFilters are the filters staff can apply to GET /waitlist.
+var waitlistFilters = map[string]string{
+	"status":    "status",
+	"room_type": "room_type",
+	"user_id":   "user_id",
+}
+
+// getWaitlist handles GET /waitlist
+// Guests see their own entries; staff see everyone's.
+func getWaitlist(c *gin.Context) {
+	where, args := " WHERE user_id = ?", []interface{}{c.GetInt("user_id")}
+	if isStaff(c) {
+		where, args = equalityFilters(c, waitlistFilters)
+		where = " WHERE TRUE" + where
+	}
+
+	rows, err := db.Query(`SELECT waitlist_id, user_id, room_type, check_in_date, check_out_date, status, room_id, hold_id, offered_at, created_at
+		FROM Waitlist`+where+" ORDER BY created_at, waitlist_id", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching waitlist", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var e WaitlistEntry
+		var in, out time.Time
+		if err := rows.Scan(&e.WaitlistID, &e.UserID, &e.RoomType, &in, &out, &e.Status, &e.RoomID, &e.HoldID, &e.OfferedAt, &e.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning waitlist", "details": err.Error()})
+			return
+		}
+		e.CheckInDate = in.Format(dateLayout)
+		e.CheckOutDate = out.Format(dateLayout)
+		entries = append(entries, e)
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// leaveWaitlist handles DELETE /waitlist/:id
+// Declining an offer releases its hold and passes the room on.
+func leaveWaitlist(c *gin.Context) {
+	var status string
+	var roomID, holdID *int
+	var in, out time.Time
+	err := db.QueryRow("SELECT status, room_id, hold_id, check_in_date, check_out_date FROM Waitlist WHERE waitlist_id = ? AND user_id = ?",
+		c.Param("id"), c.GetInt("user_id")).Scan(&status, &roomID, &holdID, &in, &out)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error leaving waitlist", "details": err.Error()})
+		return
+	}
+	if status != waitlistWaiting && status != waitlistOffered {
+		c.JSON(http.StatusConflict, gin.H{"error": "This waitlist entry is already " + status})
+		return
+	}
+
+	result, err := db.Exec("UPDATE Waitlist SET status = ? WHERE waitlist_id = ? AND status = ?", waitlistCancelled, c.Param("id"), status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error leaving waitlist", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This waitlist entry has just changed; try again"})
+		return
+	}
+	if status == waitlistOffered && holdID != nil {
+		if _, err := db.Exec("DELETE FROM Room_Holds WHERE hold_id = ?", *holdID); err != nil {
+			log.Printf("Error releasing hold %d: %v", *holdID, err)
+		}
+		releaseToWaitlist(*roomID, stayRange{CheckIn: in, CheckOut: out})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Removed from waitlist"})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingMailer keeps sent messages in memory.
+type recordingMailer struct {
+	sent []MailMessage
+}
+
+func (m *recordingMailer) Send(msg MailMessage) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestMailWaitlistNotifierSendsHoldToken(t *testing.T) {
+	rec := &recordingMailer{}
+	saved := mailer
+	mailer = rec
+	defer func() { mailer = saved }()
+
+	err := mailWaitlistNotifier{}.NotifyOffer(WaitlistOffer{
+		WaitlistID: 7,
+		Email:      "guest@example.com",
+		RoomType:   "Suite",
+		Hold: RoomHold{
+			Token:        "abc123",
+			RoomID:       4,
+			CheckInDate:  "2025-06-01",
+			CheckOutDate: "2025-06-04",
+			ExpiresAt:    time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NotifyOffer: %v", err)
+	}
+	if len(rec.sent) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(rec.sent))
+	}
+	msg := rec.sent[0]
+	if msg.To != "guest@example.com" {
+		t.Errorf("expected message to guest@example.com, got %q", msg.To)
+	}
+	for _, want := range []string{"Suite", "2025-06-01", "2025-06-04", "hold_token=abc123"} {
+		if !strings.Contains(msg.Body, want) {
+			t.Errorf("message body missing %q:\n%s", want, msg.Body)
+		}
+	}
+}
+
+func TestMatchWaitlist(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC) }
+	stay := func(in, out int) stayRange { return stayRange{CheckIn: day(in), CheckOut: day(out)} }
+	entry := func(id int, created time.Time, s stayRange) waitlistCandidate {
+		return waitlistCandidate{id: id, stay: s, createdAt: created}
+	}
+	early, late := day(1), day(2)
+
+	tests := []struct {
+		name       string
+		candidates []waitlistCandidate
+		freed      stayRange
+		taken      []stayRange // stays the room is otherwise booked for
+		want       []int
+	}{
+		{
+			name:       "oldest entry wins a contested stay",
+			candidates: []waitlistCandidate{entry(1, late, stay(10, 12)), entry(2, early, stay(10, 12))},
+			freed:      stay(10, 12),
+			want:       []int{2},
+		},
+		{
+			name:       "equal creation times fall back to id",
+			candidates: []waitlistCandidate{entry(5, early, stay(10, 12)), entry(3, early, stay(11, 13))},
+			freed:      stay(10, 13),
+			want:       []int{3},
+		},
+		{
+			name:       "one long cancellation serves several short stays",
+			candidates: []waitlistCandidate{entry(1, early, stay(10, 12)), entry(2, late, stay(12, 15)), entry(3, late, stay(11, 13))},
+			freed:      stay(10, 15),
+			want:       []int{1, 2},
+		},
+		{
+			name:       "stays outside the freed dates are skipped",
+			candidates: []waitlistCandidate{entry(1, early, stay(5, 10)), entry(2, late, stay(15, 16))},
+			freed:      stay(10, 15),
+		},
+		{
+			name:       "stay running past the freed dates needs the rest free",
+			candidates: []waitlistCandidate{entry(1, early, stay(12, 18)), entry(2, late, stay(13, 15))},
+			freed:      stay(10, 15),
+			taken:      []stayRange{stay(15, 17)},
+			want:       []int{2},
+		},
+	}
+	for _, test := range tests {
+		conflict := func(s stayRange) (bool, error) {
+			for _, b := range test.taken {
+				if s.overlaps(b) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		picked, err := matchWaitlist(test.candidates, test.freed, conflict)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var got []int
+		for _, c := range picked {
+			got = append(got, c.id)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PartnerProperty is a nearby hotel that takes guests the hotel cannot
+// accommodate.
+type PartnerProperty struct {
+	PartnerID int    `json:"partner_id"`
+	Name      string `json:"name"`
+	Address   string `json:"address,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+	Active    bool   `json:"active"`
+}
+
+// Walk records a reservation relocated to a partner property, with what the
+// guest was offered in compensation.
+type Walk struct {
+	WalkID             int       `json:"walk_id"`
+	ReservationID      int       `json:"reservation_id"`
+	PartnerID          int       `json:"partner_id"`
+	PartnerName        string    `json:"partner_name,omitempty"`
+	CompensationNotes  string    `json:"compensation_notes"`
+	CompensationAmount float64   `json:"compensation_amount"`
+	WalkedBy           int       `json:"walked_by"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// getPartners handles GET /partners
+// ?active=true limits the list to partners currently taking walks.
+func getPartners(c *gin.Context) {
+	query := "SELECT partner_id, name, COALESCE(address, ''), COALESCE(phone, ''), COALESCE(email, ''), COALESCE(notes, ''), active FROM Partner_Properties"
+	if c.Query("active") == "true" {
+		query += " WHERE active"
+	}
+	rows, err := db.Query(query + " ORDER BY name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching partners", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	partners := []PartnerProperty{}
+	for rows.Next() {
+		var p PartnerProperty
+		if err := rows.Scan(&p.PartnerID, &p.Name, &p.Address, &p.Phone, &p.Email, &p.Notes, &p.Active); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning partner", "details": err.Error()})
+			return
+		}
+		partners = append(partners, p)
+	}
+	c.JSON(http.StatusOK, partners)
+}
+
+// createPartner handles POST /partners
+func createPartner(c *gin.Context) {
+	p := PartnerProperty{Active: true}
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if p.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	result, err := db.Exec("INSERT INTO Partner_Properties (name, address, phone, email, notes, active) VALUES (?, ?, ?, ?, ?, ?)",
+		p.Name, p.Address, p.Phone, p.Email, p.Notes, p.Active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating partner", "details": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	p.PartnerID = int(id)
+	c.JSON(http.StatusCreated, p)
+}
+
+// updatePartner handles PUT /partners/:id
+func updatePartner(c *gin.Context) {
+	var p PartnerProperty
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	if p.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	result, err := db.Exec("UPDATE Partner_Properties SET name = ?, address = ?, phone = ?, email = ?, notes = ?, active = ? WHERE partner_id = ?",
+		p.Name, p.Address, p.Phone, p.Email, p.Notes, p.Active, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating partner", "details": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists int
+		if db.QueryRow("SELECT 1 FROM Partner_Properties WHERE partner_id = ?", c.Param("id")).Scan(&exists) == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Partner not found"})
+			return
+		}
+	}
+	p.PartnerID, _ = strconv.Atoi(c.Param("id"))
+	c.JSON(http.StatusOK, p)
+}
+
+// walkReservation handles POST /reservations/:id/walk
+// The reservation is marked Walked, which releases its room, and the
+// relocation is recorded against the partner property.
+func walkReservation(c *gin.Context) {
+	var req struct {
+		PartnerID          int     `json:"partner_id"`
+		CompensationNotes  string  `json:"compensation_notes"`
+		CompensationAmount float64 `json:"compensation_amount"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.PartnerID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "partner_id is required"})
+		return
+	}
+	if req.CompensationNotes == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "compensation_notes are required"})
+		return
+	}
+	if req.CompensationAmount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "compensation_amount cannot be negative"})
+		return
+	}
+	id := c.Param("id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error walking reservation", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM Reservations WHERE reservation_id = ? FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error walking reservation", "details": err.Error()})
+		return
+	}
+	if status != "Pending" && status != "Confirmed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending or confirmed reservations can be walked"})
+		return
+	}
+
+	var partnerName string
+	var active bool
+	err = tx.QueryRow("SELECT name, active FROM Partner_Properties WHERE partner_id = ?", req.PartnerID).Scan(&partnerName, &active)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "partner_id must be an active partner property"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error walking reservation", "details": err.Error()})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE Reservations SET status = 'Walked' WHERE reservation_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error walking reservation", "details": err.Error()})
+		return
+	}
+	walkedBy := c.GetInt("user_id")
+	result, err := tx.Exec("INSERT INTO Walks (reservation_id, partner_id, compensation_notes, compensation_amount, walked_by) VALUES (?, ?, ?, ?, ?)",
+		id, req.PartnerID, req.CompensationNotes, req.CompensationAmount, walkedBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording walk", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error walking reservation", "details": err.Error()})
+		return
+	}
+
+	walkID, _ := result.LastInsertId()
+	resID, _ := strconv.Atoi(id)
+	recordAudit(auditReservationWalk, walkedBy, id, c.ClientIP(), fmt.Sprintf("partner %d", req.PartnerID))
+	c.JSON(http.StatusCreated, Walk{
+		WalkID:             int(walkID),
+		ReservationID:      resID,
+		PartnerID:          req.PartnerID,
+		PartnerName:        partnerName,
+		CompensationNotes:  req.CompensationNotes,
+		CompensationAmount: req.CompensationAmount,
+		WalkedBy:           walkedBy,
+		CreatedAt:          time.Now(),
+	})
+}
+
+// getWalks handles GET /walks
+// ?from= and ?to= (YYYY-MM-DD) filter by the date the walk was recorded.
+func getWalks(c *gin.Context) {
+	where, args := " WHERE TRUE", []interface{}{}
+	for param, cond := range map[string]string{"from": " AND w.created_at >= ?", "to": " AND w.created_at < ? + INTERVAL 1 DAY"} {
+		if v := c.Query(param); v != "" {
+			if _, err := time.Parse(dateLayout, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a date in YYYY-MM-DD format"})
+				return
+			}
+			where += cond
+			args = append(args, v)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT w.walk_id, w.reservation_id, w.partner_id, p.name, w.compensation_notes, w.compensation_amount,
+		       COALESCE(w.walked_by, 0), w.created_at
+		FROM Walks w JOIN Partner_Properties p ON p.partner_id = w.partner_id`+where+`
+		ORDER BY w.created_at DESC`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching walks", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	walks := []Walk{}
+	for rows.Next() {
+		var w Walk
+		if err := rows.Scan(&w.WalkID, &w.ReservationID, &w.PartnerID, &w.PartnerName, &w.CompensationNotes,
+			&w.CompensationAmount, &w.WalkedBy, &w.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning walk", "details": err.Error()})
+			return
+		}
+		walks = append(walks, w)
+	}
+	c.JSON(http.StatusOK, walks)
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Work_Orders.status values. Open and in-progress orders keep their room out
+// of service.
+const (
+	workOrderOpen       = "open"
+	workOrderInProgress = "in_progress"
+	workOrderClosed     = "closed"
+)
+
+// workOrderPriorities are the values of Work_Orders.priority.
+var workOrderPriorities = map[string]bool{"low": true, "normal": true, "high": true, "urgent": true}
+
+// WorkOrder is a row of Work_Orders. The room is blocked in
+// Room_Availability from StartDate up to, but not including,
+// ExpectedEndDate, the day it is due back in service.
+type WorkOrder struct {
+	WorkOrderID     int        `json:"work_order_id"`
+	RoomID          int        `json:"room_id"`
+	Priority        string     `json:"priority"`
+	Description     string     `json:"description"`
+	AssignedStaffID *int       `json:"assigned_staff_id,omitempty"`
+	StartDate       string     `json:"start_date"`
+	ExpectedEndDate string     `json:"expected_end_date"`
+	Status          string     `json:"status"`
+	Resolution      *string    `json:"resolution,omitempty"`
+	CreatedBy       *int       `json:"created_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ClosedAt        *time.Time `json:"closed_at,omitempty"`
+}
+
+// validate checks the fields a caller supplies and returns the nights the
+// order blocks.
+func (w WorkOrder) validate() (stayRange, string, bool) {
+	if w.Description == "" {
+		return stayRange{}, "description is required", false
+	}
+	if !workOrderPriorities[w.Priority] {
+		return stayRange{}, "priority must be low, normal, high or urgent", false
+	}
+	start, err := time.Parse(dateLayout, w.StartDate)
+	if err != nil {
+		return stayRange{}, "start_date must be a date in YYYY-MM-DD format", false
+	}
+	end, err := time.Parse(dateLayout, w.ExpectedEndDate)
+	if err != nil {
+		return stayRange{}, "expected_end_date must be a date in YYYY-MM-DD format", false
+	}
+	if !end.After(start) {
+		return stayRange{}, "expected_end_date must be after start_date", false
+	}
+	return stayRange{CheckIn: start, CheckOut: end}, "", true
+}
+
+// initWorkOrders schedules the job on WORK_ORDER_SCHEDULE (default just
+// after midnight) that takes rooms out of service as their work orders start
+// and keeps overdue ones blocked until they are closed.
+func initWorkOrders() {
+	registerJob("maintenance-work-orders", "WORK_ORDER_SCHEDULE", "1 0 * * *", func() error {
+		n, err := refreshWorkOrders(time.Now())
+		if n > 0 {
+			log.Printf("Kept %d rooms out of service for maintenance", n)
+		}
+		return err
+	})
+}
+
+// blockedNights returns the nights from today on that an open order for
+// nights keeps blocked: its own, plus today once it is overdue, as
+// refreshWorkOrders blocks it.
+func blockedNights(nights stayRange, today time.Time) stayRange {
+	if !nights.CheckOut.After(today) {
+		nights.CheckOut = today.AddDate(0, 0, 1)
+	}
+	nights.CheckIn = maxTime(nights.CheckIn, today)
+	return nights
+}
+
+// stillBlocked returns the nights of lifted, from today on, that another
+// open order for other still needs blocked.
+func stillBlocked(lifted, other stayRange, today time.Time) (stayRange, bool) {
+	lifted, other = blockedNights(lifted, today), blockedNights(other, today)
+	shared := stayRange{CheckIn: maxTime(lifted.CheckIn, other.CheckIn), CheckOut: minTime(lifted.CheckOut, other.CheckOut)}
+	return shared, shared.CheckOut.After(shared.CheckIn)
+}
+
+// blockWorkOrderNights blocks the room for every night of nights, recording
+// the work order against each block. Nights already blocked are left alone,
+// so a night shared by overlapping orders is recorded against one of them
+// only; see reblockOpenOrders.
+func blockWorkOrderNights(q queryExecer, workOrderID, roomID int, nights stayRange) error {
+	for d := nights.CheckIn; d.Before(nights.CheckOut); d = d.AddDate(0, 0, 1) {
+		if _, err := q.Exec("INSERT IGNORE INTO Room_Availability (room_id, date, status, work_order_id) VALUES (?, ?, 'Maintenance', ?)",
+			roomID, d.Format(dateLayout), workOrderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reblockOpenOrders blocks again the nights of lifted that the room's other
+// open orders still cover, after exceptID's blocks from today on were
+// deleted. Past blocks are kept as the record of the room's history.
+func reblockOpenOrders(q queryExecer, roomID, exceptID int, lifted stayRange, today time.Time) error {
+	rows, err := q.Query("SELECT work_order_id, start_date, expected_end_date FROM Work_Orders WHERE room_id = ? AND work_order_id <> ? AND status IN (?, ?)",
+		roomID, exceptID, workOrderOpen, workOrderInProgress)
+	if err != nil {
+		return err
+	}
+	type other struct {
+		id     int
+		nights stayRange
+	}
+	var others []other
+	for rows.Next() {
+		var o other
+		if err := rows.Scan(&o.id, &o.nights.CheckIn, &o.nights.CheckOut); err != nil {
+			rows.Close()
+			return err
+		}
+		others = append(others, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range others {
+		if shared, ok := stillBlocked(lifted, o.nights, today); ok {
+			if err := blockWorkOrderNights(q, o.id, roomID, shared); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncRoomService sets the room's status from its work orders as of today:
+// Maintenance while an order that has started is still open, otherwise
+// Booked or Available depending on whether a guest is checked in.
+func syncRoomService(q queryExecer, roomID int, today string) error {
+	_, err := q.Exec(`
+		UPDATE Rooms SET status = CASE
+			WHEN EXISTS (SELECT 1 FROM Work_Orders w WHERE w.room_id = ? AND w.status IN (?, ?) AND w.start_date <= ?) THEN 'Maintenance'
+			WHEN EXISTS (SELECT 1 FROM Reservations res WHERE res.room_id = ? AND res.status = 'Checked-in') THEN 'Booked'
+			ELSE 'Available' END
+		WHERE room_id = ?`,
+		roomID, workOrderOpen, workOrderInProgress, today, roomID, roomID)
+	return err
+}
+
+// refreshWorkOrders takes the rooms of work orders starting today out of
+// service and blocks today for orders past their expected end, so a room
+// stays unsellable until its order is closed. It returns how many rooms are
+// out of service.
+func refreshWorkOrders(now time.Time) (int, error) {
+	today := now.Format(dateLayout)
+	rows, err := db.Query("SELECT work_order_id, room_id, expected_end_date FROM Work_Orders WHERE status IN (?, ?) AND start_date <= ?",
+		workOrderOpen, workOrderInProgress, today)
+	if err != nil {
+		return 0, err
+	}
+	type active struct {
+		id, roomID int
+		end        time.Time
+	}
+	var orders []active
+	for rows.Next() {
+		var a active
+		if err := rows.Scan(&a.id, &a.roomID, &a.end); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orders = append(orders, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rooms := map[int]bool{}
+	for _, a := range orders {
+		if a.end.Format(dateLayout) <= today {
+			day, _ := time.Parse(dateLayout, today)
+			if err := blockWorkOrderNights(db, a.id, a.roomID, stayRange{CheckIn: day, CheckOut: day.AddDate(0, 0, 1)}); err != nil {
+				return len(rooms), err
+			}
+		}
+		if !rooms[a.roomID] {
+			if err := syncRoomService(db, a.roomID, today); err != nil {
+				return len(rooms), err
+			}
+			rooms[a.roomID] = true
+		}
+	}
+	return len(rooms), nil
+}
+
+// affectedReservations lists the reservations holding the room on any of
+// nights, which the front desk will need to move.
+func affectedReservations(q queryExecer, roomID int, nights stayRange) ([]int, error) {
+	rows, err := q.Query(`SELECT reservation_id FROM Reservations WHERE room_id = ? AND status IN (`+occupyingStatuses+`)
+		AND check_in_date < ? AND check_out_date > ? ORDER BY check_in_date`,
+		roomID, nights.CheckOut.Format(dateLayout), nights.CheckIn.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// validStaffID reports whether id is a row of Staff.
+func validStaffID(q queryExecer, id int) (bool, error) {
+	var exists int
+	err := q.QueryRow("SELECT 1 FROM Staff WHERE staff_id = ?", id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// createWorkOrder handles POST /work-orders
+// Blocks the room for the order's nights. Reservations already holding
+// those nights are not moved but are listed in affected_reservations.
+func createWorkOrder(c *gin.Context) {
+	w := WorkOrder{Priority: "normal"}
+	if err := c.ShouldBindJSON(&w); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	nights, msg, ok := w.validate()
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating work order", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockRooms(tx, []int{w.RoomID}); err != nil {
+		if err == errRoomNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "room_id does not exist"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating work order", "details": err.Error()})
+		return
+	}
+	if w.AssignedStaffID != nil {
+		ok, err := validStaffID(tx, *w.AssignedStaffID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating work order", "details": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "assigned_staff_id does not exist"})
+			return
+		}
+	}
+
+	userID := c.GetInt("user_id")
+	result, err := tx.Exec(`INSERT INTO Work_Orders (room_id, priority, description, assigned_staff_id, start_date, expected_end_date, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, w.RoomID, w.Priority, w.Description, w.AssignedStaffID, w.StartDate, w.ExpectedEndDate, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating work order", "details": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	w.WorkOrderID = int(id)
+	if err := blockWorkOrderNights(tx, w.WorkOrderID, w.RoomID, nights); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error blocking room", "details": err.Error()})
+		return
+	}
+	if err := syncRoomService(tx, w.RoomID, time.Now().Format(dateLayout)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room status", "details": err.Error()})
+		return
+	}
+	affected, err := affectedReservations(tx, w.RoomID, nights)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating work order", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating work order", "details": err.Error()})
+		return
+	}
+
+	w.Status = workOrderOpen
+	w.CreatedBy = &userID
+	w.CreatedAt = time.Now()
+	c.JSON(http.StatusCreated, gin.H{"work_order": w, "affected_reservations": affected})
+}
+
+// workOrderColumns are the Work_Orders columns scanned by scanWorkOrder.
+const workOrderColumns = `work_order_id, room_id, priority, description, assigned_staff_id, start_date, expected_end_date,
+	status, resolution, created_by, created_at, closed_at`
+
+func scanWorkOrder(row interface{ Scan(...interface{}) error }) (WorkOrder, error) {
+	var w WorkOrder
+	var start, end time.Time
+	err := row.Scan(&w.WorkOrderID, &w.RoomID, &w.Priority, &w.Description, &w.AssignedStaffID, &start, &end,
+		&w.Status, &w.Resolution, &w.CreatedBy, &w.CreatedAt, &w.ClosedAt)
+	w.StartDate = start.Format(dateLayout)
+	w.ExpectedEndDate = end.Format(dateLayout)
+	return w, err
+}
+
+// getWorkOrders handles GET /work-orders
+// ?status=, ?room_id= and ?assigned_staff_id= narrow the list; by default
+// only open and in-progress orders are shown, most urgent first.
+func getWorkOrders(c *gin.Context) {
+	query := "SELECT " + workOrderColumns + " FROM Work_Orders WHERE TRUE"
+	var args []interface{}
+	if v := c.Query("status"); v != "" {
+		query += " AND status = ?"
+		args = append(args, v)
+	} else {
+		query += " AND status IN (?, ?)"
+		args = append(args, workOrderOpen, workOrderInProgress)
+	}
+	for _, param := range []string{"room_id", "assigned_staff_id"} {
+		if v := c.Query(param); v != "" {
+			query += " AND " + param + " = ?"
+			args = append(args, v)
+		}
+	}
+	rows, err := db.Query(query+" ORDER BY FIELD(priority, 'urgent', 'high', 'normal', 'low'), start_date, work_order_id", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching work orders", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	orders := []WorkOrder{}
+	for rows.Next() {
+		w, err := scanWorkOrder(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning work order", "details": err.Error()})
+			return
+		}
+		orders = append(orders, w)
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// getWorkOrder handles GET /work-orders/:id
+func getWorkOrder(c *gin.Context) {
+	w, err := scanWorkOrder(db.QueryRow("SELECT "+workOrderColumns+" FROM Work_Orders WHERE work_order_id = ?", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Work order not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching work order", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// updateWorkOrder handles PUT /work-orders/:id
+// Replaces the priority, description, assignee, dates and status
+// (open or in_progress) of an order that is not closed. Changing the dates
+// moves the room's blocks; nights no longer blocked go to the waitlist.
+func updateWorkOrder(c *gin.Context) {
+	var req WorkOrder
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON provided"})
+		return
+	}
+	nights, msg, ok := req.validate()
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if req.Status == "" {
+		req.Status = workOrderOpen
+	}
+	if req.Status != workOrderOpen && req.Status != workOrderInProgress {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open or in_progress; use POST /work-orders/:id/close to close an order"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating work order", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := scanWorkOrder(tx.QueryRow("SELECT "+workOrderColumns+" FROM Work_Orders WHERE work_order_id = ? FOR UPDATE", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Work order not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating work order", "details": err.Error()})
+		return
+	}
+	if current.Status == workOrderClosed {
+		c.JSON(http.StatusConflict, gin.H{"error": "The work order is closed"})
+		return
+	}
+	if req.AssignedStaffID != nil {
+		ok, err := validStaffID(tx, *req.AssignedStaffID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating work order", "details": err.Error()})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "assigned_staff_id does not exist"})
+			return
+		}
+	}
+	if err := lockRooms(tx, []int{current.RoomID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating work order", "details": err.Error()})
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE Work_Orders SET priority = ?, description = ?, assigned_staff_id = ?, start_date = ?, expected_end_date = ?, status = ?
+		WHERE work_order_id = ?`,
+		req.Priority, req.Description, req.AssignedStaffID, req.StartDate, req.ExpectedEndDate, req.Status, current.WorkOrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating work order", "details": err.Error()})
+		return
+	}
+	today, _ := time.Parse(dateLayout, time.Now().Format(dateLayout))
+	old, _, _ := current.validate()
+	if _, err := tx.Exec("DELETE FROM Room_Availability WHERE work_order_id = ? AND date >= ?", current.WorkOrderID, today.Format(dateLayout)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room blocks", "details": err.Error()})
+		return
+	}
+	if err := blockWorkOrderNights(tx, current.WorkOrderID, current.RoomID, blockedNights(nights, today)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room blocks", "details": err.Error()})
+		return
+	}
+	if err := reblockOpenOrders(tx, current.RoomID, current.WorkOrderID, old, today); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room blocks", "details": err.Error()})
+		return
+	}
+	if err := syncRoomService(tx, current.RoomID, today.Format(dateLayout)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room status", "details": err.Error()})
+		return
+	}
+	affected, err := affectedReservations(tx, current.RoomID, nights)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating work order", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating work order", "details": err.Error()})
+		return
+	}
+
+	if old.CheckIn.Before(nights.CheckIn) {
+		releaseToWaitlist(current.RoomID, stayRange{CheckIn: old.CheckIn, CheckOut: minTime(nights.CheckIn, old.CheckOut)})
+	}
+	if old.CheckOut.After(nights.CheckOut) {
+		releaseToWaitlist(current.RoomID, stayRange{CheckIn: maxTime(nights.CheckOut, old.CheckIn), CheckOut: old.CheckOut})
+	}
+
+	req.WorkOrderID = current.WorkOrderID
+	req.RoomID = current.RoomID
+	req.Resolution = current.Resolution
+	req.CreatedBy = current.CreatedBy
+	req.CreatedAt = current.CreatedAt
+	c.JSON(http.StatusOK, gin.H{"work_order": req, "affected_reservations": affected})
+}
+
+// closeWorkOrder handles POST /work-orders/:id/close
+// Records the resolution, lifts the remaining blocks and returns the room to
+// service unless another order still keeps it out. Nights freed early are
+// offered to the waitlist.
+func closeWorkOrder(c *gin.Context) {
+	var req struct {
+		Resolution string `json:"resolution"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Resolution == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resolution is required"})
+		return
+	}
+
+	now := time.Now()
+	today, _ := time.Parse(dateLayout, now.Format(dateLayout))
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing work order", "details": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var id, roomID int
+	var status string
+	var blocked stayRange
+	err = tx.QueryRow("SELECT work_order_id, room_id, status, start_date, expected_end_date FROM Work_Orders WHERE work_order_id = ? FOR UPDATE", c.Param("id")).
+		Scan(&id, &roomID, &status, &blocked.CheckIn, &blocked.CheckOut)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Work order not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing work order", "details": err.Error()})
+		return
+	}
+	if status == workOrderClosed {
+		c.JSON(http.StatusConflict, gin.H{"error": "The work order is already closed"})
+		return
+	}
+	if err := lockRooms(tx, []int{roomID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing work order", "details": err.Error()})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE Work_Orders SET status = ?, resolution = ?, closed_by = ?, closed_at = ? WHERE work_order_id = ?",
+		workOrderClosed, req.Resolution, c.GetInt("user_id"), now, c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing work order", "details": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM Room_Availability WHERE work_order_id = ? AND date >= ?", c.Param("id"), today.Format(dateLayout)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error lifting room blocks", "details": err.Error()})
+		return
+	}
+	if err := reblockOpenOrders(tx, roomID, id, blocked, today); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error lifting room blocks", "details": err.Error()})
+		return
+	}
+	if err := syncRoomService(tx, roomID, today.Format(dateLayout)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating room status", "details": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing work order", "details": err.Error()})
+		return
+	}
+
+	if freed := (stayRange{CheckIn: maxTime(blocked.CheckIn, today), CheckOut: blocked.CheckOut}); freed.CheckOut.After(freed.CheckIn) {
+		releaseToWaitlist(roomID, freed)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Work order closed", "room_id": roomID})
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
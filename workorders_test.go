@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkOrderValidate(t *testing.T) {
+	valid := WorkOrder{Priority: "high", Description: "Leaking shower", StartDate: "2025-09-10", ExpectedEndDate: "2025-09-12"}
+	nights, msg, ok := valid.validate()
+	if !ok {
+		t.Fatalf("expected a valid work order, got %q", msg)
+	}
+	if nights.Nights() != 2 {
+		t.Errorf("expected 2 blocked nights, got %d", nights.Nights())
+	}
+
+	tests := []struct {
+		name   string
+		change func(w *WorkOrder)
+	}{
+		{"no description", func(w *WorkOrder) { w.Description = "" }},
+		{"unknown priority", func(w *WorkOrder) { w.Priority = "critical" }},
+		{"bad start date", func(w *WorkOrder) { w.StartDate = "10/09/2025" }},
+		{"missing end date", func(w *WorkOrder) { w.ExpectedEndDate = "" }},
+		{"ends on start date", func(w *WorkOrder) { w.ExpectedEndDate = w.StartDate }},
+		{"ends before start date", func(w *WorkOrder) { w.ExpectedEndDate = "2025-09-09" }},
+	}
+	for _, test := range tests {
+		w := valid
+		test.change(&w)
+		if _, _, ok := w.validate(); ok {
+			t.Errorf("%s: expected validation to fail", test.name)
+		}
+	}
+}
+
+func TestStillBlocked(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 9, d, 0, 0, 0, 0, time.UTC) }
+	nights := func(in, out int) stayRange { return stayRange{CheckIn: day(in), CheckOut: day(out)} }
+	today := day(10)
+
+	tests := []struct {
+		name          string
+		lifted, other stayRange
+		want          stayRange // zero if nothing stays blocked
+	}{
+		{"other order covers the shared nights", nights(10, 15), nights(12, 18), nights(12, 15)},
+		{"other order inside the lifted one", nights(10, 20), nights(12, 14), nights(12, 14)},
+		{"orders do not overlap", nights(10, 12), nights(12, 14), stayRange{}},
+		{"past shared nights are left alone", nights(5, 13), nights(3, 12), nights(10, 12)},
+		{"overdue other order keeps today", nights(8, 14), nights(4, 9), nights(10, 11)},
+		{"both overdue share today", nights(3, 8), nights(4, 9), nights(10, 11)},
+		{"other order starts later", nights(10, 12), nights(14, 16), stayRange{}},
+	}
+	for _, test := range tests {
+		got, ok := stillBlocked(test.lifted, test.other, today)
+		if want := !test.want.CheckIn.IsZero(); ok != want || (ok && got != test.want) {
+			t.Errorf("%s: expected %v (%v), got %v (%v)", test.name, test.want, want, got, ok)
+		}
+	}
+}